@@ -0,0 +1,188 @@
+// filename: calendar.go
+// Description: Month and week availability calendars for the venue page
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// Calendar views
+const (
+	calendarMonth = "month"
+	calendarWeek  = "week"
+)
+
+// Calendar is a grid of days, Monday first, showing when a venue is busy
+type Calendar struct {
+	View     string
+	Title    string
+	Weeks    [][]CalendarDay
+	PrevDate string
+	NextDate string
+	Date     string
+}
+
+// CalendarDay is one cell of the calendar
+type CalendarDay struct {
+	Date    time.Time
+	InRange bool
+	Past    bool
+	Busy    []data.Interval
+	Free    bool
+}
+
+// Status sums up the day for styling: free, partial or full
+func (d CalendarDay) Status() string {
+	switch {
+	case !d.Free:
+		return "full"
+	case len(d.Busy) > 0:
+		return "partial"
+	default:
+		return "free"
+	}
+}
+
+// Summary describes a day with no free time left
+func (d CalendarDay) Summary() string {
+	closed := true
+	for _, b := range d.Busy {
+		switch b.Kind {
+		case data.BusyBlackout:
+			return "Unavailable"
+		case data.BusyBooked, data.BusyBuffer:
+			closed = false
+		}
+	}
+	if closed {
+		return "Closed"
+	}
+	return "Fully booked"
+}
+
+// calendarRange returns the days a calendar view shows for the anchor date.
+// Month views are padded out to whole weeks.
+func calendarRange(view string, anchor time.Time) (from, to time.Time) {
+	if view == calendarWeek {
+		from = startOfWeek(anchor)
+		return from, from.AddDate(0, 0, 7)
+	}
+
+	first := time.Date(anchor.Year(), anchor.Month(), 1, 0, 0, 0, 0, anchor.Location())
+	from = startOfWeek(first)
+	to = startOfWeek(first.AddDate(0, 1, 0).Add(-time.Nanosecond)).AddDate(0, 0, 7)
+	return from, to
+}
+
+// startOfWeek returns midnight on the Monday of the week containing t
+func startOfWeek(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// venueCalendar builds the calendar shown on the venue page from the view
+// and date query parameters, defaulting to the current month
+func (app *application) venueCalendar(r *http.Request, venue *data.Venue) (*Calendar, error) {
+	qs := r.URL.Query()
+
+	view := qs.Get("view")
+	if view != calendarWeek {
+		view = calendarMonth
+	}
+
+	v := validator.NewValidator()
+	anchor := app.readDate(qs, "date", v)
+	if anchor.IsZero() {
+		now := time.Now().In(app.location)
+		anchor = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, app.location)
+	}
+
+	from, to := calendarRange(view, anchor)
+	availability, err := app.reservation.Availability(venue, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &Calendar{View: view, Date: anchor.Format("2006-01-02")}
+	if view == calendarWeek {
+		cal.Title = "Week of " + from.Format("Jan 02, 2006")
+		cal.PrevDate = anchor.AddDate(0, 0, -7).Format("2006-01-02")
+		cal.NextDate = anchor.AddDate(0, 0, 7).Format("2006-01-02")
+	} else {
+		cal.Title = anchor.Format("January 2006")
+		cal.PrevDate = anchor.AddDate(0, -1, 1-anchor.Day()).Format("2006-01-02")
+		cal.NextDate = anchor.AddDate(0, 1, 1-anchor.Day()).Format("2006-01-02")
+	}
+
+	today := time.Now()
+	var week []CalendarDay
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		week = append(week, CalendarDay{
+			Date:    day,
+			InRange: view == calendarWeek || day.Month() == anchor.Month(),
+			Past:    !next.After(today),
+			Busy:    availability.BusyBetween(day, next),
+			Free:    availability.IsFreeBetween(day, next),
+		})
+		if len(week) == 7 {
+			cal.Weeks = append(cal.Weeks, week)
+			week = nil
+		}
+	}
+
+	return cal, nil
+}
+
+// venueAvailability returns the venue's free and busy intervals as JSON.
+// The range runs from the from date up to and including the to date, and
+// defaults to the next 30 days.
+func (app *application) venueAvailability(w http.ResponseWriter, r *http.Request) {
+	venue, ok := app.loadScheduleVenue(w, r)
+	if !ok {
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.NewValidator()
+	from := app.readDate(qs, "from", v)
+	to := app.readDate(qs, "to", v)
+
+	if from.IsZero() {
+		now := time.Now().In(app.location)
+		from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, app.location)
+	}
+	if to.IsZero() {
+		to = from.AddDate(0, 0, 29)
+	}
+	to = to.AddDate(0, 0, 1)
+
+	v.Check(to.After(from), "to", "must not be before the from date")
+	v.Check(to.Sub(from) <= data.MaxAvailabilityRange, "to", "must be within 92 days of the from date")
+
+	if !v.ValidData() {
+		err := app.writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": v.Errors})
+		if err != nil {
+			app.logger.Error("failed to write availability errors", "error", err)
+		}
+		return
+	}
+
+	availability, err := app.reservation.Availability(venue, from, to)
+	if err != nil {
+		app.logger.Error("failed to load availability", "venueID", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"availability": availability})
+	if err != nil {
+		app.logger.Error("failed to write availability", "error", err)
+	}
+}
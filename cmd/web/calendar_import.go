@@ -0,0 +1,272 @@
+// filename: calendar_import.go
+// Description: Importing external calendars as venue blackouts
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/ical"
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// calendarFetchTimeout is how long fetching one calendar URL may take
+const calendarFetchTimeout = 15 * time.Second
+
+// addCalendarSource registers an external calendar for the venue, from a URL
+// or an uploaded .ics file, and runs its first sync straight away
+func (app *application) addCalendarSource(w http.ResponseWriter, r *http.Request) {
+	venue, ok := app.loadScheduleVenue(w, r)
+	if !ok {
+		return
+	}
+
+	source := &data.CalendarSource{
+		VenueID: venue.ID,
+		Name:    strings.TrimSpace(r.PostFormValue("calendar_name")),
+		URL:     strings.TrimSpace(r.PostFormValue("calendar_url")),
+	}
+
+	v := validator.NewValidator()
+
+	file, _, err := r.FormFile("calendar_file")
+	switch {
+	case errors.Is(err, http.ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+	case err != nil:
+		http.Error(w, "Unable to read uploaded file", http.StatusBadRequest)
+		return
+	default:
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, data.MaxCalendarSize+1))
+		if err != nil {
+			http.Error(w, "Unable to read uploaded file", http.StatusBadRequest)
+			return
+		}
+		source.Content = string(content)
+
+		// Catch a bad file now rather than on the first sync
+		if len(content) <= data.MaxCalendarSize {
+			events, err := ical.Parse(bytes.NewReader(content))
+			v.Check(err == nil, "calendar_file", "is not a valid iCalendar (.ics) file")
+			if err == nil {
+				_, err = data.ImportedBlackouts(source, events, time.Now())
+				if err != nil {
+					v.AddError("calendar_file", err.Error())
+				}
+			}
+		}
+	}
+
+	data.ValidateCalendarSource(v, source)
+	if !v.ValidData() {
+		app.renderEditVenue(w, r, http.StatusUnprocessableEntity, venue, v.Errors)
+		return
+	}
+
+	err = app.calendars.Insert(source)
+	if err != nil {
+		app.logger.Error("failed to add calendar source", "venueID", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	count, err := app.syncCalendarSource(source)
+	if err != nil {
+		app.session.Put(r, "flash", "Calendar added, but the first sync failed: "+err.Error())
+	} else {
+		app.session.Put(r, "flash", fmt.Sprintf("Calendar added. %d upcoming events are now blocked out.", count))
+	}
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venue.ID), http.StatusSeeOther)
+}
+
+// syncCalendarSourceNow syncs one of the venue's calendars without waiting
+// for the sync job
+func (app *application) syncCalendarSourceNow(w http.ResponseWriter, r *http.Request) {
+	source, ok := app.loadCalendarSource(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := app.syncCalendarSource(source)
+	if err != nil {
+		app.session.Put(r, "flash", "Sync failed: "+err.Error())
+	} else {
+		app.session.Put(r, "flash", fmt.Sprintf("Calendar synced. %d upcoming events are blocked out.", count))
+	}
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", source.VenueID), http.StatusSeeOther)
+}
+
+// deleteCalendarSource stops importing one of the venue's calendars and
+// removes the blackouts it created
+func (app *application) deleteCalendarSource(w http.ResponseWriter, r *http.Request) {
+	source, ok := app.loadCalendarSource(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.calendars.Delete(source.ID, source.VenueID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to delete calendar source", "id", source.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Calendar removed.")
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", source.VenueID), http.StatusSeeOther)
+}
+
+// loadCalendarSource fetches the venue's calendar source named in the path,
+// writing the error response itself when it can't
+func (app *application) loadCalendarSource(w http.ResponseWriter, r *http.Request) (*data.CalendarSource, bool) {
+	venueID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	sourceID, err := strconv.ParseInt(r.PathValue("sourceID"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	source, err := app.calendars.Get(sourceID, venueID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return nil, false
+		}
+		app.logger.Error("failed to fetch calendar source", "id", sourceID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return source, true
+}
+
+// loadCalendarSources adds the venue's imported calendars to the edit page
+func (app *application) loadCalendarSources(td *TemplateData, venueID int64) error {
+	sources, err := app.calendars.GetForVenue(venueID)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		td.CalendarSources = append(td.CalendarSources, *source)
+	}
+	return nil
+}
+
+// syncCalendarSource reads the source's calendar and replaces its blackouts
+// with the events in it, returning how many there are. A failed sync is
+// recorded on the source for the owner to see, and the blackouts from the
+// last good sync stay in place.
+func (app *application) syncCalendarSource(source *data.CalendarSource) (int, error) {
+	blackouts, err := app.readCalendarSource(source)
+	if err == nil {
+		err = app.calendars.SaveSync(source, blackouts)
+		if err == nil {
+			return len(blackouts), nil
+		}
+		app.logger.Error("failed to save calendar sync", "id", source.ID, "error", err)
+		err = errors.New("could not save the imported events")
+	}
+
+	saveErr := app.calendars.SaveSyncError(source, err)
+	if saveErr != nil {
+		app.logger.Error("failed to record calendar sync error", "id", source.ID, "error", saveErr)
+	}
+	return 0, err
+}
+
+// readCalendarSource fetches or reads the source's calendar and turns its
+// events into blackouts
+func (app *application) readCalendarSource(source *data.CalendarSource) ([]data.Blackout, error) {
+	content := []byte(source.Content)
+	if !source.IsUpload() {
+		var err error
+		content, err = app.fetchCalendar(source.URL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	events, err := ical.Parse(bytes.NewReader(content))
+	if err != nil {
+		if errors.Is(err, ical.ErrNotCalendar) {
+			return nil, errors.New("the file is not an iCalendar (.ics) file")
+		}
+		if errors.Is(err, ical.ErrTooManyEvents) {
+			return nil, fmt.Errorf("the calendar has more than %d events", ical.MaxEvents)
+		}
+		return nil, fmt.Errorf("could not read the calendar: %w", err)
+	}
+
+	return data.ImportedBlackouts(source, events, time.Now())
+}
+
+// fetchCalendar downloads a calendar from its URL
+func (app *application) fetchCalendar(url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), calendarFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar URL: %w", err)
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	resp, err := app.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the calendar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the calendar server returned %s", resp.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, data.MaxCalendarSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the calendar: %w", err)
+	}
+	if len(content) > data.MaxCalendarSize {
+		return nil, errors.New("the calendar is larger than 5 MB")
+	}
+
+	return content, nil
+}
+
+// syncCalendars syncs every calendar source that is due. Failures are
+// recorded on each source, so one bad calendar doesn't hold up the rest.
+func (app *application) syncCalendars() error {
+	sources, err := app.calendars.FetchDue(time.Now().Add(-app.calendarSyncInterval))
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, source := range sources {
+		_, err := app.syncCalendarSource(source)
+		if err != nil {
+			failed++
+			app.logger.Warn("calendar sync failed", "id", source.ID, "venueID", source.VenueID, "error", err)
+		}
+	}
+
+	if len(sources) > 0 {
+		app.logger.Info("synced calendars", "count", len(sources), "failed", failed)
+	}
+	return nil
+}
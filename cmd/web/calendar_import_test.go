@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+)
+
+// calendarServer is a stand-in for an owner's calendar host. It serves a
+// calendar with two upcoming events, one cancelled and one already over.
+func calendarServer(t *testing.T) *httptest.Server {
+	tomorrow := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	stamp := func(at time.Time) string { return at.Format("20060102T150405Z") }
+	calendar := strings.ReplaceAll(fmt.Sprintf(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Stand-in//Calendar//EN
+BEGIN:VEVENT
+UID:wedding@example.com
+DTSTART:%s
+DTEND:%s
+SUMMARY:Wedding
+END:VEVENT
+BEGIN:VEVENT
+UID:cancelled@example.com
+DTSTART:%s
+DTEND:%s
+STATUS:CANCELLED
+END:VEVENT
+BEGIN:VEVENT
+UID:past@example.com
+DTSTART:%s
+DTEND:%s
+END:VEVENT
+BEGIN:VEVENT
+UID:yoga@example.com
+DTSTART:%s
+DURATION:PT1H
+RRULE:FREQ=WEEKLY;COUNT=2
+END:VEVENT
+END:VCALENDAR
+`,
+		stamp(tomorrow.Add(12*time.Hour)), stamp(tomorrow.Add(20*time.Hour)),
+		stamp(tomorrow.Add(9*time.Hour)), stamp(tomorrow.Add(10*time.Hour)),
+		stamp(tomorrow.AddDate(0, 0, -3)), stamp(tomorrow.AddDate(0, 0, -2)),
+		stamp(tomorrow.AddDate(0, 0, 1).Add(7*time.Hour)),
+	), "\n", "\r\n")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/venue.ics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/calendar")
+		fmt.Fprint(w, calendar)
+	})
+	mux.HandleFunc("/moved.ics", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/venue.ics", http.StatusFound)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>Sign in to see this calendar</body></html>")
+	})
+	mux.HandleFunc("/huge.ics", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("X", data.MaxCalendarSize+1))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestReadCalendarSourceFromURL(t *testing.T) {
+	srv := calendarServer(t)
+	app := &application{httpClient: newFetchClient(calendarFetchTimeout, true)}
+	tomorrow := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+
+	tests := []struct {
+		name string
+		path string
+		err  string
+	}{
+		{name: "calendar", path: "/venue.ics"},
+		{name: "redirect", path: "/moved.ics"},
+		{name: "not found", path: "/missing.ics", err: "the calendar server returned 404 Not Found"},
+		{name: "not a calendar", path: "/page", err: "the file is not an iCalendar (.ics) file"},
+		{name: "too large", path: "/huge.ics", err: "the calendar is larger than 5 MB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &data.CalendarSource{ID: 3, VenueID: 9, Name: "Bookings elsewhere", URL: srv.URL + tt.path}
+
+			blackouts, err := app.readCalendarSource(source)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("readCalendarSource = %v, %v; want error %q", blackouts, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []struct{ start, end time.Time }{
+				{tomorrow.Add(12 * time.Hour), tomorrow.Add(20 * time.Hour)},
+				{tomorrow.AddDate(0, 0, 1).Add(7 * time.Hour), tomorrow.AddDate(0, 0, 1).Add(8 * time.Hour)},
+				{tomorrow.AddDate(0, 0, 8).Add(7 * time.Hour), tomorrow.AddDate(0, 0, 8).Add(8 * time.Hour)},
+			}
+			if len(blackouts) != len(want) {
+				t.Fatalf("readCalendarSource made %d blackouts; want %d: %+v", len(blackouts), len(want), blackouts)
+			}
+			for i, b := range blackouts {
+				if !b.StartAt.Equal(want[i].start) || !b.EndAt.Equal(want[i].end) {
+					t.Errorf("blackout %d = %v to %v; want %v to %v", i, b.StartAt, b.EndAt, want[i].start, want[i].end)
+				}
+				if b.VenueID != 9 || b.SourceID != 3 || b.Reason != "Bookings elsewhere" {
+					t.Errorf("blackout %d = %+v; want the source's venue, ID and name", i, b)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCalendarSourceUpload(t *testing.T) {
+	app := &application{}
+	start := time.Now().UTC().Truncate(time.Hour).Add(48 * time.Hour)
+	source := &data.CalendarSource{VenueID: 9, Name: "Uploaded", Content: "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:a\r\nDTSTART:" + start.Format("20060102T150405Z") + "\r\nDURATION:PT2H\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"}
+
+	blackouts, err := app.readCalendarSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blackouts) != 1 || !blackouts[0].StartAt.Equal(start) || !blackouts[0].EndAt.Equal(start.Add(2*time.Hour)) {
+		t.Fatalf("readCalendarSource = %+v; want one blackout from %v for two hours", blackouts, start)
+	}
+}
+
+func TestFetchCalendarRefusesPrivateAddresses(t *testing.T) {
+	srv := calendarServer(t)
+	app := &application{httpClient: newFetchClient(calendarFetchTimeout, false)}
+
+	_, err := app.fetchCalendar(srv.URL + "/venue.ics")
+	if !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("fetchCalendar(%s) = %v; want errBlockedAddress", srv.URL, err)
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1::1", want: true},
+		{ip: "127.0.0.1", want: false},
+		{ip: "::1", want: false},
+		{ip: "::ffff:127.0.0.1", want: false},
+		{ip: "10.1.2.3", want: false},
+		{ip: "172.16.0.1", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "224.0.0.1", want: false},
+		{ip: "0.0.0.0", want: false},
+		{ip: "::", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := publicAddress(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("publicAddress(%s) = %v; want %v", tt.ip, got, tt.want)
+		}
+	}
+}
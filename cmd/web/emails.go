@@ -0,0 +1,169 @@
+// filename: emails.go
+// Description: Rendering queued emails and delivering them from the outbox
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/mailer"
+)
+
+const (
+	// emailBatchSize is the most emails one run of the delivery job sends
+	emailBatchSize = 20
+
+	// emailSendTimeout is how long sending one email may take
+	emailSendTimeout = 15 * time.Second
+
+	// emailLease is how long a claimed email is left alone by other workers.
+	// It has to outlast sending a whole batch.
+	emailLease = 10 * time.Minute
+
+	// emailMaxRetryDelay caps the wait between delivery attempts
+	emailMaxRetryDelay = time.Hour
+)
+
+// emailTemplate is one file from ui/email. The subject and plain body are
+// parsed as text and the HTML body as HTML, so only the HTML is escaped.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *template.Template
+}
+
+// newEmailTemplateCache loads the email templates from ./ui/email, keyed by
+// name without the .tmpl extension
+func newEmailTemplateCache() (map[string]emailTemplate, error) {
+	cache := map[string]emailTemplate{}
+
+	files, err := filepath.Glob("./ui/email/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+
+		text, err := texttemplate.ParseFiles(file)
+		if err != nil {
+			return nil, err
+		}
+		html, err := template.ParseFiles(file)
+		if err != nil {
+			return nil, err
+		}
+		cache[name] = emailTemplate{text: text, html: html}
+	}
+
+	return cache, nil
+}
+
+// renderEmail builds the message for a queued email from its template and
+// payload
+func (app *application) renderEmail(email *data.OutboxEmail) (mailer.Message, error) {
+	var payload data.ReservationEmail
+	err := json.Unmarshal(email.Payload, &payload)
+	if err != nil {
+		return mailer.Message{}, fmt.Errorf("could not read the email payload: %w", err)
+	}
+
+	return executeEmail(app.emailTemplates, email.Template, email.Recipient, payload)
+}
+
+// executeEmail fills in the named email template for the recipient
+func executeEmail(templates map[string]emailTemplate, name, to string, payload any) (mailer.Message, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return mailer.Message{}, fmt.Errorf("the email template %q does not exist", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	err := tmpl.text.ExecuteTemplate(&subject, "subject", payload)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	err = tmpl.text.ExecuteTemplate(&text, "plainBody", payload)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	err = tmpl.html.ExecuteTemplate(&html, "htmlBody", payload)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+// deliverEmails sends the emails that are due. A failed email is retried
+// later, waiting twice as long after each attempt, until it runs out of
+// attempts; one bad address doesn't hold up the rest of the batch.
+func (app *application) deliverEmails() error {
+	emails, err := app.outbox.ClaimDue(emailBatchSize, emailLease)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, email := range emails {
+		err := app.sendEmail(email)
+		if err != nil {
+			failed++
+			app.logger.Warn("email delivery failed", "id", email.ID, "template", email.Template,
+				"attempt", email.Attempts, "error", err)
+
+			retryAt := time.Now().Add(emailRetryDelay(email.Attempts))
+			err = app.outbox.MarkFailed(email, err, retryAt)
+			if err != nil {
+				app.logger.Error("failed to record email failure", "id", email.ID, "error", err)
+			}
+			continue
+		}
+
+		err = app.outbox.MarkSent(email.ID)
+		if err != nil {
+			app.logger.Error("failed to mark email sent", "id", email.ID, "error", err)
+		}
+	}
+
+	if len(emails) > 0 {
+		app.logger.Info("delivered emails", "count", len(emails)-failed, "failed", failed)
+	}
+	return nil
+}
+
+// sendEmail renders and sends one queued email
+func (app *application) sendEmail(email *data.OutboxEmail) error {
+	msg, err := app.renderEmail(email)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+	defer cancel()
+
+	return app.mailer.Send(ctx, msg)
+}
+
+// emailRetryDelay is how long to wait before trying an email again after its
+// nth attempt failed: one minute, doubling each time up to emailMaxRetryDelay
+func emailRetryDelay(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < emailMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, emailMaxRetryDelay)
+}
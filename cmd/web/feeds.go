@@ -0,0 +1,207 @@
+// filename: feeds.go
+// Description: iCalendar feeds of bookings for venues and customers
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/ical"
+)
+
+// Kinds of calendar feed. Each is signed separately so a token for one can't
+// be used for another.
+const (
+	feedVenue    = "venue"
+	feedCustomer = "customer"
+)
+
+// feedUIDDomain ends every event UID. It must never change, or calendar apps
+// will treat every booking as a new event.
+const feedUIDDomain = "venuesystem"
+
+// feedToken signs the feed of the given kind and ID. The token is the only
+// thing protecting the feed, so it is derived from the feed key rather than
+// stored, and every existing feed URL stops working if the key changes.
+func (app *application) feedToken(kind string, id int64) string {
+	mac := hmac.New(sha256.New, app.feedKey)
+	fmt.Fprintf(mac, "%s:%d", kind, id)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validFeedToken reports whether token was issued for the feed
+func (app *application) validFeedToken(kind string, id int64, token string) bool {
+	want := app.feedToken(kind, id)
+	return hmac.Equal([]byte(token), []byte(want))
+}
+
+// feedURL returns the full address of a feed, for pasting into a calendar app
+func (app *application) feedURL(r *http.Request, kind string, id int64) string {
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/feeds/%s/%d/%s.ics", scheme, r.Host, kind, id, app.feedToken(kind, id))
+}
+
+// readFeedRequest checks the ID and token in a feed URL, writing a 404 for
+// anything that doesn't match so feeds can't be probed for
+func (app *application) readFeedRequest(w http.ResponseWriter, r *http.Request, kind string) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return 0, false
+	}
+
+	token := strings.TrimSuffix(r.PathValue("token"), ".ics")
+	if !app.validFeedToken(kind, id, token) {
+		http.NotFound(w, r)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// venueFeed serves an owner's calendar of the venue's confirmed bookings
+func (app *application) venueFeed(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.readFeedRequest(w, r, feedVenue)
+	if !ok {
+		return
+	}
+
+	venue, err := app.venue.GetVenueByID(int(id))
+	if err != nil {
+		app.logger.Error("failed to fetch venue", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if venue == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	reservations, err := app.reservation.FetchVenueFeed(venue.ID)
+	if err != nil {
+		app.logger.Error("failed to fetch venue feed", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	cal := &ical.Calendar{Name: venue.VenueName + " Bookings"}
+	for _, reservation := range reservations {
+		event := reservationEvent(reservation)
+		event.Summary = fmt.Sprintf("%s (%d guests)", reservation.CustomerName, reservation.GuestCount)
+		cal.Events = append(cal.Events, event)
+	}
+
+	app.writeCalendar(w, cal, "")
+}
+
+// customerFeed serves a customer's calendar of their own reservations
+func (app *application) customerFeed(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.readFeedRequest(w, r, feedCustomer)
+	if !ok {
+		return
+	}
+
+	reservations, err := app.reservation.FetchCustomerFeed(id)
+	if err != nil {
+		app.logger.Error("failed to fetch customer feed", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	cal := &ical.Calendar{Name: "My Reservations"}
+	for _, reservation := range reservations {
+		cal.Events = append(cal.Events, reservationEvent(reservation))
+	}
+
+	app.writeCalendar(w, cal, "")
+}
+
+// downloadReservation serves one of the customer's reservations as an .ics
+// file to add to a calendar by hand
+func (app *application) downloadReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r.Context())
+
+	reservation, err := app.reservation.FetchByID(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to fetch reservation", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Customers may only download their own reservations
+	if reservation.CustomerID != user.ID {
+		http.NotFound(w, r)
+		return
+	}
+
+	cal := &ical.Calendar{Events: []ical.Event{reservationEvent(reservation)}}
+	app.writeCalendar(w, cal, fmt.Sprintf("reservation-%d.ics", reservation.ID))
+}
+
+// reservationEvent describes a reservation as a calendar event. The UID is
+// the same in every feed and download so calendar apps see one event.
+func reservationEvent(reservation *data.Reservation) ical.Event {
+	description := fmt.Sprintf("Guests: %d\nTotal: $%s\nStatus: %s",
+		reservation.GuestCount, reservation.Total, reservation.Status)
+
+	return ical.Event{
+		UID:         fmt.Sprintf("reservation-%d@%s", reservation.ID, feedUIDDomain),
+		Sequence:    reservation.Revision,
+		Start:       reservation.StartAt,
+		End:         reservation.EndAt,
+		Created:     reservation.CreatedAt,
+		Modified:    reservation.UpdatedAt,
+		Summary:     reservation.VenueName,
+		Location:    reservation.Location,
+		Description: description,
+		Status:      eventStatus(reservation.Status),
+	}
+}
+
+// eventStatus maps a reservation status onto an iCalendar event status
+func eventStatus(status data.ReservationStatus) string {
+	switch status {
+	case data.StatusPending, data.StatusHeld:
+		return ical.StatusTentative
+	case data.StatusCancelled, data.StatusRejected:
+		return ical.StatusCancelled
+	default:
+		return ical.StatusConfirmed
+	}
+}
+
+// writeCalendar sends the calendar as text/calendar. A filename makes it a
+// download rather than a feed.
+func (app *application) writeCalendar(w http.ResponseWriter, cal *ical.Calendar, filename string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+
+	err := cal.Write(w)
+	if err != nil {
+		app.logger.Error("failed to write calendar", "error", err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/ical"
+)
+
+func TestReservationEvent(t *testing.T) {
+	start := time.Date(2026, 2, 14, 18, 0, 0, 0, time.UTC)
+	reservation := &data.Reservation{
+		ID:         42,
+		StartAt:    start,
+		EndAt:      start.Add(4 * time.Hour),
+		Status:     data.StatusPending,
+		Revision:   1,
+		GuestCount: 80,
+		Total:      45000,
+		VenueName:  "Main Hall",
+	}
+
+	before := reservationEvent(reservation)
+	if before.UID != "reservation-42@venuesystem" || before.Sequence != 1 {
+		t.Fatalf("UID, SEQUENCE = %q, %d; want \"reservation-42@venuesystem\", 1", before.UID, before.Sequence)
+	}
+
+	// The owner confirms the booking and it is moved, bumping its revision
+	reservation.Status = data.StatusConfirmed
+	reservation.StartAt = start.Add(time.Hour)
+	reservation.EndAt = start.Add(5 * time.Hour)
+	reservation.Revision = 2
+
+	after := reservationEvent(reservation)
+	if after.UID != before.UID {
+		t.Errorf("UID changed from %q to %q", before.UID, after.UID)
+	}
+	if after.Sequence != 2 {
+		t.Errorf("SEQUENCE = %d; want 2", after.Sequence)
+	}
+}
+
+func TestEventStatus(t *testing.T) {
+	tests := []struct {
+		status data.ReservationStatus
+		want   string
+	}{
+		{data.StatusPending, ical.StatusTentative},
+		{data.StatusHeld, ical.StatusTentative},
+		{data.StatusConfirmed, ical.StatusConfirmed},
+		{data.StatusCompleted, ical.StatusConfirmed},
+		{data.StatusNoShow, ical.StatusConfirmed},
+		{data.StatusCancelled, ical.StatusCancelled},
+		{data.StatusRejected, ical.StatusCancelled},
+	}
+
+	for _, tt := range tests {
+		if got := eventStatus(tt.status); got != tt.want {
+			t.Errorf("eventStatus(%v) = %q; want %q", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// filename: gallery.go
+// Description: Managing the gallery of images on a venue's page
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// addVenueImage uploads an image to the end of the venue's gallery
+func (app *application) addVenueImage(w http.ResponseWriter, r *http.Request) {
+	venue, ok := app.loadScheduleVenue(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.NewValidator()
+	img := formImage(r, "gallery_image", v)
+	if img == nil && v.Errors["gallery_image"] == "" {
+		v.AddError("gallery_image", "must be provided")
+	}
+
+	image := &data.VenueImage{
+		VenueID: venue.ID,
+		Caption: strings.TrimSpace(r.PostFormValue("caption")),
+	}
+	data.ValidateVenueImage(v, image)
+	if !v.ValidData() {
+		app.renderEditVenue(w, r, http.StatusUnprocessableEntity, venue, v.Errors)
+		return
+	}
+
+	var err error
+	image.Key, err = app.saveImage(img)
+	if err != nil {
+		app.logger.Error("failed to store venue image", "venueID", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = app.images.Insert(image)
+	if err != nil {
+		app.deleteImage(image.Key)
+		if errors.Is(err, data.ErrGalleryFull) {
+			v.AddError("gallery_image", fmt.Sprintf("the gallery already holds %d images; remove one first", data.MaxVenueImages))
+			app.renderEditVenue(w, r, http.StatusUnprocessableEntity, venue, v.Errors)
+			return
+		}
+		app.logger.Error("failed to add venue image", "venueID", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Image added to the gallery.")
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venue.ID), http.StatusSeeOther)
+}
+
+// updateVenueImageCaption changes the caption of one of the venue's images
+func (app *application) updateVenueImageCaption(w http.ResponseWriter, r *http.Request) {
+	venue, ok := app.loadScheduleVenue(w, r)
+	if !ok {
+		return
+	}
+	imageID, err := strconv.ParseInt(r.PathValue("imageID"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	image := &data.VenueImage{
+		ID:      imageID,
+		VenueID: venue.ID,
+		Caption: strings.TrimSpace(r.PostFormValue("caption")),
+	}
+
+	v := validator.NewValidator()
+	data.ValidateVenueImage(v, image)
+	if !v.ValidData() {
+		app.renderEditVenue(w, r, http.StatusUnprocessableEntity, venue, v.Errors)
+		return
+	}
+
+	err = app.images.UpdateCaption(image)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to update image caption", "id", imageID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Caption saved.")
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venue.ID), http.StatusSeeOther)
+}
+
+// moveVenueImage moves one of the venue's images a place earlier or later in
+// the gallery
+func (app *application) moveVenueImage(w http.ResponseWriter, r *http.Request) {
+	venueID, imageID, ok := galleryImageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var earlier bool
+	switch r.PostFormValue("direction") {
+	case "up":
+		earlier = true
+	case "down":
+		earlier = false
+	default:
+		http.Error(w, "Invalid direction", http.StatusBadRequest)
+		return
+	}
+
+	err := app.images.Move(imageID, venueID, earlier)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to move venue image", "id", imageID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venueID), http.StatusSeeOther)
+}
+
+// setVenueCover makes one of the venue's images the one shown on the listing
+func (app *application) setVenueCover(w http.ResponseWriter, r *http.Request) {
+	venueID, imageID, ok := galleryImageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.images.SetCover(imageID, venueID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to set venue cover", "id", imageID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Cover image changed.")
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venueID), http.StatusSeeOther)
+}
+
+// deleteVenueImage removes one of the venue's images from the gallery and
+// from storage
+func (app *application) deleteVenueImage(w http.ResponseWriter, r *http.Request) {
+	venueID, imageID, ok := galleryImageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := app.images.Delete(imageID, venueID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to delete venue image", "id", imageID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	app.deleteImage(key)
+
+	app.session.Put(r, "flash", "Image removed from the gallery.")
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venueID), http.StatusSeeOther)
+}
+
+// galleryImageIDs reads the venue and image IDs from the path. It responds
+// with a 404 and reports false when either is invalid.
+func galleryImageIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	venueID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return 0, 0, false
+	}
+	imageID, err := strconv.ParseInt(r.PathValue("imageID"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return 0, 0, false
+	}
+	return venueID, imageID, true
+}
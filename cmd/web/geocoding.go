@@ -0,0 +1,141 @@
+// filename: geocoding.go
+// Description: Placing venues on the map and reading the place a search is near
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/geo"
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// geocodeTimeout is how long looking up one address may take
+const geocodeTimeout = 5 * time.Second
+
+// loadPlaces reads the list of places for the offline geocoder from a CSV
+// file
+func loadPlaces(path string) (geo.Static, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return geo.LoadStatic(f)
+}
+
+// parseCoordinates reads a latitude and longitude given as text. It returns
+// nil without an error when both are blank.
+func parseCoordinates(lat, lng string) (*geo.Point, error) {
+	lat, lng = strings.TrimSpace(lat), strings.TrimSpace(lng)
+	if lat == "" && lng == "" {
+		return nil, nil
+	}
+
+	p := &geo.Point{}
+	var err error
+	p.Lat, err = strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return nil, errors.New("must be a latitude and longitude in decimal degrees")
+	}
+	p.Lng, err = strconv.ParseFloat(lng, 64)
+	if err != nil {
+		return nil, errors.New("must be a latitude and longitude in decimal degrees")
+	}
+	return p, nil
+}
+
+// formCoordinates reads the latitude and longitude fields of the venue form
+// onto venue. Both may be left blank for the location to be looked up.
+func formCoordinates(r *http.Request, venue *data.Venue, v *validator.Validator) {
+	p, err := parseCoordinates(r.PostFormValue("latitude"), r.PostFormValue("longitude"))
+	if err != nil {
+		v.AddError("latitude", err.Error())
+		return
+	}
+	venue.Coordinates = p
+}
+
+// locateVenue fills in the coordinates of a venue that has none by
+// geocoding its location. A venue that can't be found is saved without
+// coordinates; it just won't turn up in searches by distance.
+func (app *application) locateVenue(venue *data.Venue) {
+	if venue.Coordinates != nil || venue.Location == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), geocodeTimeout)
+	defer cancel()
+
+	p, err := app.geocoder.Geocode(ctx, venue.Location)
+	if err != nil {
+		if !errors.Is(err, geo.ErrNotFound) {
+			app.logger.Warn("failed to geocode venue location", "location", venue.Location, "error", err)
+		}
+		return
+	}
+	venue.Coordinates = &p
+}
+
+// readNear returns the point a venue search is near: the lat and lng query
+// parameters when given, such as from the browser's location, or else the
+// place named by near looked up with the geocoder. It returns nil when
+// neither is given.
+func (app *application) readNear(qs url.Values, v *validator.Validator) *geo.Point {
+	p, err := parseCoordinates(qs.Get("lat"), qs.Get("lng"))
+	if err != nil {
+		v.AddError("near", err.Error())
+		return nil
+	}
+	if p != nil {
+		return p
+	}
+
+	near := strings.TrimSpace(qs.Get("near"))
+	if near == "" {
+		return nil
+	}
+	if !validator.MaxLength(near, 100) {
+		v.AddError("near", "must not be more than 100 bytes long")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), geocodeTimeout)
+	defer cancel()
+
+	found, err := app.geocoder.Geocode(ctx, near)
+	if err != nil {
+		if errors.Is(err, geo.ErrNotFound) {
+			v.AddError("near", "could not be found on the map")
+		} else {
+			app.logger.Warn("failed to geocode search location", "near", near, "error", err)
+			v.AddError("near", "could not be looked up right now, please try again")
+		}
+		return nil
+	}
+	return &found
+}
+
+// readBox returns the bounding box given in the bbox query parameter, or nil
+func (app *application) readBox(qs url.Values, v *validator.Validator) *geo.Box {
+	s := qs.Get("bbox")
+	if s == "" {
+		return nil
+	}
+
+	b, err := geo.ParseBox(s)
+	if err != nil {
+		v.AddError("bbox", "must be four coordinates: min longitude, min latitude, max longitude, max latitude")
+		return nil
+	}
+	return &b
+}
@@ -250,10 +250,10 @@ func (app *application) createVenue(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	priceStr := r.FormValue("price_per_hour")
 	capacityStr := r.FormValue("max_capacity")
-	imageLink := r.FormValue("image")
+	approval := r.FormValue("approval")
 
 	// Convert numeric inputs
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := data.ParseMoney(priceStr)
 	if err != nil {
 		app.logger.Error("invalid price input", "input", priceStr, "error", err)
 		price = 0
@@ -265,31 +265,57 @@ func (app *application) createVenue(w http.ResponseWriter, r *http.Request) {
 		capacity = 0
 	}
 
+	v := validator.NewValidator()
+
 	// Create the venue struct
 	venue := &data.Venue{
-		OwnerID:     int64(userId),
-		VenueName:   venue_name,
-		Description: description,
-		Location:    location,
-		Email:       email,
-		Price:       price,
-		MaxCapacity: capacity,
-		Image:       imageLink,
+		OwnerID:      int64(userId),
+		VenueName:    venue_name,
+		Description:  description,
+		Location:     location,
+		Email:        email,
+		Price:        price,
+		MaxCapacity:  capacity,
+		AutoAccept:   approval != "manual",
+		BufferBefore: formInt(r, "buffer_before", v),
+		BufferAfter:  formInt(r, "buffer_after", v),
+		MinDuration:  formInt(r, "min_duration", v),
+		MaxDuration:  formInt(r, "max_duration", v),
+		SlotMinutes:  formInt(r, "slot_minutes", v),
+		LeadHours:    formInt(r, "lead_hours", v),
+		AdvanceDays:  formInt(r, "advance_days", v),
+	}
+	formCancellationPolicy(r, venue, v)
+	formCoordinates(r, venue, v)
+
+	img := formImage(r, "image", v)
+	if img == nil && v.Errors["image"] == "" {
+		v.AddError("image", "must be provided")
 	}
 
 	// Validate
-	v := validator.NewValidator()
 	data.ValidateVenue(v, venue)
 
 	if !v.ValidData() {
 		formData := map[string]string{
-			"venue_name":     venue_name,
-			"description":    description,
-			"location":       location,
-			"email":          email,
-			"price_per_hour": priceStr,
-			"max_capacity":   capacityStr,
-			"image":          imageLink,
+			"venue_name":          venue_name,
+			"description":         description,
+			"location":            location,
+			"email":               email,
+			"price_per_hour":      priceStr,
+			"max_capacity":        capacityStr,
+			"approval":            approval,
+			"buffer_before":       r.FormValue("buffer_before"),
+			"buffer_after":        r.FormValue("buffer_after"),
+			"min_duration":        r.FormValue("min_duration"),
+			"max_duration":        r.FormValue("max_duration"),
+			"slot_minutes":        r.FormValue("slot_minutes"),
+			"lead_hours":          r.FormValue("lead_hours"),
+			"advance_days":        r.FormValue("advance_days"),
+			"cancellation_policy": r.FormValue("cancellation_policy"),
+			"cancellation_tiers":  r.FormValue("cancellation_tiers"),
+			"latitude":            r.FormValue("latitude"),
+			"longitude":           r.FormValue("longitude"),
 		}
 
 		td := NewTemplateData(r)
@@ -307,8 +333,18 @@ func (app *application) createVenue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.locateVenue(venue)
+
+	venue.ImageKey, err = app.saveImage(img)
+	if err != nil {
+		app.logger.Error("failed to store venue image", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	err = app.venue.Insert(venue)
 	if err != nil {
+		app.deleteImage(venue.ImageKey)
 		app.logger.Error("failed to insert venue", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -323,9 +359,6 @@ func (app *application) viewVenue(w http.ResponseWriter, r *http.Request) {
 	// Log the session value for debugging
 	app.logger.Info("Session userID", "value", app.session.Get(r, "authenticatedUserID"))
 
-	// Set the Content-Security-Policy header to allow external images
-	w.Header().Set("Content-Security-Policy", "img-src 'self' https: data:;")
-
 	path := r.URL.Path
 	parts := strings.Split(strings.Trim(path, "/"), "/")
 
@@ -354,49 +387,69 @@ func (app *application) viewVenue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch reviews for the venue, passing the venue ID as int64
-	reviews, err := app.review.GetReviewByVenueID(int64(id))
+	err = app.schedule.Load(venue)
 	if err != nil {
-		app.logger.Error("failed to fetch reviews", "error", err)
+		app.logger.Error("failed to load venue schedule", "id", id, "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Convert slice of pointers to slice of values
-	var reviewList []data.Review
-	for _, r := range reviews {
-		reviewList = append(reviewList, *r) // Dereference each review pointer
+	td, err := app.venuePage(r, venue)
+	if err != nil {
+		app.logger.Error("failed to load venue page", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
+	td.Flash = app.session.PopString(r, "flash")
 
-	// Initialize TemplateData
-	data := NewTemplateData(r)
+	// Render the viewvenue template
+	err = app.render(w, http.StatusOK, "viewvenue.tmpl", td)
+	if err != nil {
+		app.logger.Error("failed to render venue view page", "template", "viewvenue.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
 
-	// Set title and header text
-	data.Title = venue.VenueName
-	data.HeaderText = "Details for " + venue.VenueName
-	data.Flash = app.session.PopString(r, "flash")
-	data.IsAuthenticated = app.isAuthenticated(r)
+// venuePage gathers what the venue page shows about a venue whose schedule
+// is already loaded: its gallery, reviews and availability calendar, and
+// whether the signed-in user owns it
+func (app *application) venuePage(r *http.Request, venue *data.Venue) (*TemplateData, error) {
+	err := app.images.Load(venue)
+	if err != nil {
+		return nil, fmt.Errorf("load gallery: %w", err)
+	}
 
-	// Extract user role from context
-	roleVal := r.Context().Value(contextKeyUserRole)
-	if roleVal != nil {
-		if role, ok := roleVal.(int64); ok {
-			data.UserRole = role
-		}
+	reviews, err := app.review.GetReviewByVenueID(venue.ID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch reviews: %w", err)
 	}
 
-	// Add the single venue to the data
-	data.Venue = venue
+	calendar, err := app.venueCalendar(r, venue)
+	if err != nil {
+		return nil, fmt.Errorf("build availability calendar: %w", err)
+	}
 
-	// Add the reviews (now as a slice of values) to the data
-	data.Reviews = reviewList
+	td := NewTemplateData(r)
+	td.Title = venue.VenueName
+	td.HeaderText = "Details for " + venue.VenueName
+	td.IsAuthenticated = app.isAuthenticated(r)
+	td.Venue = venue
+	td.Calendar = calendar
 
-	// Render the viewvenue template
-	err = app.render(w, http.StatusOK, "viewvenue.tmpl", data)
-	if err != nil {
-		app.logger.Error("failed to render venue view page", "template", "viewvenue.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	// Extract user role from context
+	if role, ok := r.Context().Value(contextKeyUserRole).(int64); ok {
+		td.UserRole = role
+	}
+
+	// Only the owner of the venue gets the edit and delete settings
+	if user := app.contextGetUser(r.Context()); user != nil {
+		td.IsVenueOwner = user.ID == venue.OwnerID
+	}
+
+	for _, review := range reviews {
+		td.Reviews = append(td.Reviews, *review)
 	}
+	return td, nil
 }
 
 // Form page displayed to add venue
@@ -419,24 +472,77 @@ func (app *application) venueForm(w http.ResponseWriter, r *http.Request) {
 
 // Initial page displayed
 func (app *application) venueListing(w http.ResponseWriter, r *http.Request) {
-	// Set the Content-Security-Policy header to allow external images
-	w.Header().Set("Content-Security-Policy", "img-src 'self' https: data:;")
+	qs := r.URL.Query()
+	v := validator.NewValidator()
 
-	data := NewTemplateData(r)
-	data.Title = "Venue"
-	data.HeaderText = "Your latest Venue Posts!"
-	data.Flash = app.session.PopString(r, "flash")
-	data.IsAuthenticated = app.isAuthenticated(r)
+	filters := data.VenueFilters{
+		Keyword:     strings.TrimSpace(qs.Get("q")),
+		Location:    strings.TrimSpace(qs.Get("location")),
+		MinCapacity: int64(app.readInt(qs, "min_capacity", 0, v)),
+		MaxCapacity: int64(app.readInt(qs, "max_capacity", 0, v)),
+		MinPrice:    app.readMoney(qs, "min_price", v),
+		MaxPrice:    app.readMoney(qs, "max_price", v),
+		Sort:        qs.Get("sort"),
+		Near:        app.readNear(qs, v),
+		RadiusKm:    float64(app.readInt(qs, "radius", 0, v)),
+		Box:         app.readBox(qs, v),
+		Filters: data.Filters{
+			Page:     app.readInt(qs, "page", 1, v),
+			PageSize: app.readInt(qs, "page_size", 12, v),
+		},
+	}
+	if filters.Sort == "" {
+		switch {
+		case filters.Keyword != "":
+			filters.Sort = data.SortRelevance
+		case filters.Near != nil:
+			filters.Sort = data.SortDistance
+		default:
+			filters.Sort = data.SortNewest
+		}
+	}
+	data.ValidateVenueFilters(v, filters)
+
+	td := NewTemplateData(r)
+	td.Title = "Venue"
+	td.HeaderText = "Your latest Venue Posts!"
+	td.Flash = app.session.PopString(r, "flash")
+	td.IsAuthenticated = app.isAuthenticated(r)
+	td.FormData = map[string]string{
+		"q":            qs.Get("q"),
+		"location":     qs.Get("location"),
+		"min_capacity": qs.Get("min_capacity"),
+		"max_capacity": qs.Get("max_capacity"),
+		"min_price":    qs.Get("min_price"),
+		"max_price":    qs.Get("max_price"),
+		"near":         qs.Get("near"),
+		"lat":          qs.Get("lat"),
+		"lng":          qs.Get("lng"),
+		"radius":       qs.Get("radius"),
+		"bbox":         qs.Get("bbox"),
+		"sort":         filters.Sort,
+	}
+	td.PageQuery = pageQuery(qs)
 
 	// Extract user role from context
 	roleVal := r.Context().Value(contextKeyUserRole)
 	if roleVal != nil {
 		if role, ok := roleVal.(int64); ok {
-			data.UserRole = role
+			td.UserRole = role
 		}
 	}
 
-	venues, err := app.venue.FetchAllVenues()
+	if !v.ValidData() {
+		td.FormErrors = v.Errors
+		err := app.render(w, http.StatusUnprocessableEntity, "venue.tmpl", td)
+		if err != nil {
+			app.logger.Error("failed to render venue page", "template", "venue.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	venues, metadata, err := app.venue.Search(filters)
 	if err != nil {
 		app.logger.Error("failed to get venues", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -445,10 +551,11 @@ func (app *application) venueListing(w http.ResponseWriter, r *http.Request) {
 
 	for _, j := range venues {
 		// Dereference each pointer
-		data.Venues = append(data.Venues, *j)
+		td.Venues = append(td.Venues, *j)
 	}
+	td.Metadata = metadata
 
-	err = app.render(w, http.StatusOK, "venue.tmpl", data)
+	err = app.render(w, http.StatusOK, "venue.tmpl", td)
 	if err != nil {
 		app.logger.Error("failed to render venue page", "template", "venue.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -456,6 +563,48 @@ func (app *application) venueListing(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+const (
+	// minSuggestLength is how much has to be typed before suggestions are
+	// looked up
+	minSuggestLength = 2
+
+	// suggestLimit is the most venue names, and the most locations, offered
+	// at once
+	suggestLimit = 5
+)
+
+// venueSuggest returns venue names and locations starting with the text
+// typed so far, for autocomplete on the listing's search box
+func (app *application) venueSuggest(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	v := validator.NewValidator()
+	v.Check(validator.MaxLength(prefix, 100), "q", "must not be more than 100 bytes long")
+	if !v.ValidData() {
+		err := app.writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": v.Errors})
+		if err != nil {
+			app.logger.Error("failed to write suggestion errors", "error", err)
+		}
+		return
+	}
+
+	suggestions := []data.Suggestion{}
+	if len([]rune(prefix)) >= minSuggestLength {
+		var err error
+		suggestions, err = app.venue.Suggest(prefix, suggestLimit)
+		if err != nil {
+			app.logger.Error("failed to get venue suggestions", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, map[string]any{"suggestions": suggestions})
+	if err != nil {
+		app.logger.Error("failed to write suggestions", "error", err)
+	}
+}
+
 func (app *application) showUpdateVenueForm(w http.ResponseWriter, r *http.Request) {
 	// Get the path and remove "/venue/"
 	parts := strings.Split(r.URL.Path, "/")
@@ -476,18 +625,53 @@ func (app *application) showUpdateVenueForm(w http.ResponseWriter, r *http.Reque
 	venue, err := app.venue.GetVenueByID(int(id))
 	if err != nil {
 		app.logger.Error("failed to fetch venue", "id", id, "error", err)
-		http.Error(w, "Venue not found", http.StatusNotFound)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if venue == nil {
+		http.NotFound(w, r)
 		return
 	}
 
-	// Prepare the template data
+	// Opening hours and blackouts are managed on the same page
+	err = app.schedule.Load(venue)
+	if err != nil {
+		app.logger.Error("failed to load venue schedule", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.renderEditVenue(w, r, http.StatusOK, venue, nil)
+}
+
+// renderEditVenue displays the venue edit page along with any errors from one
+// of its forms
+func (app *application) renderEditVenue(w http.ResponseWriter, r *http.Request, status int, venue *data.Venue, formErrors map[string]string) {
 	tmplData := NewTemplateData(r)
 	tmplData.Title = "Edit Venue"
 	tmplData.Venue = venue // Pass the venue pointer
+	tmplData.FeedURL = app.feedURL(r, feedVenue, venue.ID)
 	tmplData.IsAuthenticated = app.isAuthenticated(r)
+	if formErrors != nil {
+		tmplData.FormErrors = formErrors
+	}
+
+	err := app.loadCalendarSources(tmplData, venue.ID)
+	if err != nil {
+		app.logger.Error("failed to load calendar sources", "venueID", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = app.images.Load(venue)
+	if err != nil {
+		app.logger.Error("failed to load venue gallery", "venueID", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
 	// Render the template
-	err = app.render(w, http.StatusOK, "editvenue.tmpl", tmplData)
+	err = app.render(w, status, "editvenue.tmpl", tmplData)
 	if err != nil {
 		app.logger.Error("failed to render update form", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -517,7 +701,11 @@ func (app *application) updateVenue(w http.ResponseWriter, r *http.Request) {
 	venue, err := app.venue.GetVenueByID(int(venueID))
 	if err != nil {
 		log.Println("failed to get venue:", err)
-		http.Error(w, "venue not found", http.StatusNotFound)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if venue == nil {
+		http.NotFound(w, r)
 		return
 	}
 
@@ -529,20 +717,22 @@ func (app *application) updateVenue(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update venue fields
+	previousLocation, previousCoordinates := venue.Location, venue.Coordinates
 	venue.VenueName = r.FormValue("venue_name")
 	venue.Email = r.FormValue("email")
 	venue.Description = r.FormValue("description")
 	venue.Location = r.FormValue("location")
-	venue.Image = r.FormValue("image")
+	venue.AutoAccept = r.FormValue("approval") != "manual"
 
 	priceStr := r.FormValue("price")
 	maxCapStr := r.FormValue("max_capacity")
 
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := data.ParseMoney(priceStr)
 	if err == nil {
 		venue.Price = price
 	}
 
+	previousCapacity := venue.MaxCapacity
 	maxCap, err := strconv.ParseInt(maxCapStr, 10, 64)
 	if err == nil {
 		venue.MaxCapacity = maxCap
@@ -550,42 +740,116 @@ func (app *application) updateVenue(w http.ResponseWriter, r *http.Request) {
 
 	// Validation
 	v := validator.NewValidator()
+	venue.BufferBefore = formInt(r, "buffer_before", v)
+	venue.BufferAfter = formInt(r, "buffer_after", v)
+	venue.MinDuration = formInt(r, "min_duration", v)
+	venue.MaxDuration = formInt(r, "max_duration", v)
+	venue.SlotMinutes = formInt(r, "slot_minutes", v)
+	venue.LeadHours = formInt(r, "lead_hours", v)
+	venue.AdvanceDays = formInt(r, "advance_days", v)
+	formCancellationPolicy(r, venue, v)
+	formCoordinates(r, venue, v)
 	data.ValidateVenue(v, venue)
 
-	if !v.ValidData() {
+	// renderForm shows the form again with the owner's input and the errors
+	renderForm := func(status int) {
 		formData := map[string]string{
-			"venue_name":   venue.VenueName,
-			"email":        venue.Email,
-			"description":  venue.Description,
-			"location":     venue.Location,
-			"price":        priceStr,
-			"max_capacity": maxCapStr,
-			"image":        venue.Image,
+			"venue_name":         venue.VenueName,
+			"email":              venue.Email,
+			"description":        venue.Description,
+			"location":           venue.Location,
+			"price":              priceStr,
+			"max_capacity":       maxCapStr,
+			"cancellation_tiers": r.FormValue("cancellation_tiers"),
+			"latitude":           r.FormValue("latitude"),
+			"longitude":          r.FormValue("longitude"),
+		}
+
+		err = app.schedule.Load(venue)
+		if err != nil {
+			app.logger.Error("failed to load venue schedule", "id", venueID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
 		td := NewTemplateData(r)
 		td.Title = "Update Venue"
 		td.HeaderText = "Update Venue Details"
+		td.Venue = venue
+		td.FeedURL = app.feedURL(r, feedVenue, venue.ID)
 		td.FormErrors = v.Errors
 		td.FormData = formData
 		td.IsAuthenticated = app.isAuthenticated(r)
 
-		err = app.render(w, http.StatusUnprocessableEntity, "editvenue.tmpl", td)
+		err = app.loadCalendarSources(td, venue.ID)
+		if err != nil {
+			app.logger.Error("failed to load calendar sources", "venueID", venue.ID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		err = app.images.Load(venue)
+		if err != nil {
+			app.logger.Error("failed to load venue gallery", "venueID", venue.ID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		err = app.render(w, status, "editvenue.tmpl", td)
 		if err != nil {
 			log.Println("failed to render venue form:", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
+	}
+
+	if !v.ValidData() {
+		renderForm(http.StatusUnprocessableEntity)
 		return
 	}
 
-	// Perform the update
-	err = app.venue.Update(venue)
+	// Look the location up again when it was moved but the coordinates
+	// weren't, so they don't point at the old place
+	if venue.Location != previousLocation && previousCoordinates != nil &&
+		venue.Coordinates != nil && *venue.Coordinates == *previousCoordinates {
+		venue.Coordinates = nil
+	}
+	app.locateVenue(venue)
+
+	// Perform the update as the signed-in owner
+	user := app.contextGetUser(r.Context())
+	err = app.venue.Update(venue, user.ID)
 	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		var conflict *data.BufferConflictError
+		if errors.As(err, &conflict) {
+			bookings := make([]string, len(conflict.Bookings))
+			for i, b := range conflict.Bookings {
+				bookings[i] = fmt.Sprintf("#%d on %s", b.ID, b.StartAt.Format("Jan 02, 2006 15:04"))
+			}
+			v.AddError("buffer_before", "these upcoming bookings would overlap: "+strings.Join(bookings, ", ")+"; shorten the setup or cleanup time, or move them first")
+			renderForm(http.StatusConflict)
+			return
+		}
 		log.Println("failed to update venue:", err)
 		http.Error(w, "unable to update venue", http.StatusInternalServerError)
 		return
 	}
 
+	// Warn the owner when the new capacity no longer fits upcoming bookings
+	if venue.MaxCapacity < previousCapacity {
+		overCapacity, err := app.reservation.CountOverCapacity(venue.ID, venue.MaxCapacity)
+		if err != nil {
+			app.logger.Error("failed to count bookings over capacity", "venueID", venue.ID, "error", err)
+		} else if overCapacity > 0 {
+			app.session.Put(r, "flash", fmt.Sprintf("Update Made successfully! Warning: %d upcoming booking(s) expect more than %d guests.", overCapacity, venue.MaxCapacity))
+			http.Redirect(w, r, fmt.Sprintf("/venue/%d", venueID), http.StatusSeeOther)
+			return
+		}
+	}
+
 	// After successful update, redirect to view venue page
 	app.session.Put(r, "flash", "Update Made successfully!")
 	app.logger.Info("")
@@ -608,13 +872,22 @@ func (app *application) deleteVenue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := app.contextGetUser(r.Context())
+
 	// Call the Delete method from the model to remove the venue
-	err = app.venue.Delete(int64(id))
+	imageKeys, err := app.venue.Delete(int64(id), user.ID)
 	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
 		app.logger.Error("failed to delete venue", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	for _, key := range imageKeys {
+		app.deleteImage(key)
+	}
 
 	// Redirect to the venues list page or show a success message
 	app.session.Put(r, "flash", "Venue Removed successfully!")
@@ -662,6 +935,22 @@ func (app *application) submitReview(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:  time.Now(),
 	}
 
+	// The star rating is optional
+	v := validator.NewValidator()
+	if s := r.FormValue("rating"); s != "" {
+		review.Rating, err = strconv.ParseInt(s, 10, 64)
+		v.Check(err == nil && review.Rating > 0, "rating", "must be between 1 and 5 stars")
+	}
+	data.ValidateReview(v, &review)
+	if !v.ValidData() {
+		for field, msg := range v.Errors {
+			app.session.Put(r, "flash", fmt.Sprintf("Review not added: %s %s.", field, msg))
+			break
+		}
+		http.Redirect(w, r, fmt.Sprintf("/venue/%d", venueID), http.StatusSeeOther)
+		return
+	}
+
 	// Insert the review into the database
 	err = app.review.Insert(&review)
 	if err != nil {
@@ -705,6 +994,25 @@ func (app *application) createReservation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Load the venue so the booking can be checked against it
+	venue, err := app.venue.GetVenueByID(id)
+	if err != nil {
+		app.logger.Error("failed to fetch venue", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if venue == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.schedule.Load(venue)
+	if err != nil {
+		app.logger.Error("failed to load venue schedule", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	// Parse form input
 	err = r.ParseForm()
 	if err != nil {
@@ -712,174 +1020,523 @@ func (app *application) createReservation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Log the form values to check if they're coming through
-	fmt.Printf("Form Data: %v\n", r.PostForm)
 	startDateStr := r.PostFormValue("start_date")
 	startTimeStr := r.PostFormValue("start_time")
+	endDateStr := r.PostFormValue("end_date")
 	endTimeStr := r.PostFormValue("end_time")
-	fmt.Printf("Start Date: %s, Start Time: %s, End Time: %s\n", startDateStr, startTimeStr, endTimeStr)
-
-	// Parse the start date
-	startDate, err := time.Parse("2006-01-02", startDateStr)
-	if err != nil {
-		startDate = time.Time{}
-	}
 
-	// Combine start date with start time
-	startDateTimeStr := fmt.Sprintf("%s %s", startDateStr, startTimeStr)
-	startDateTime, err := time.Parse("2006-01-02 15:04", startDateTimeStr)
+	guestCount, err := strconv.ParseInt(r.PostFormValue("guest_count"), 10, 64)
 	if err != nil {
-		startDateTime = time.Time{}
-	}
-
-	// Combine start date with end time
-	endDateTimeStr := fmt.Sprintf("%s %s", startDateStr, endTimeStr)
-	endDateTime, err := time.Parse("2006-01-02 15:04", endDateTimeStr)
-	if err != nil {
-		endDateTime = time.Time{}
+		guestCount = 0
 	}
 
 	// Create reservation
 	reservation := &data.Reservation{
 		VenueID:    int64(id),
 		CustomerID: int64(userId),
-		StartDate:  startDate,
-		StartTime:  startDateTime,
-		EndTime:    endDateTime,
-		Status:     "1",
+		StartAt:    app.parseDateTime(startDateStr, startTimeStr),
+		EndAt:      app.parseDateTime(endDateOrStart(endDateStr, startDateStr), endTimeStr),
+		GuestCount: guestCount,
 	}
 
-	// Log the reservation data to see if it's correctly populated
-	fmt.Printf("Reservation Data: %+v\n", reservation)
-
 	// Validate reservation
 	v := validator.NewValidator() // your validator setup
-	data.ValidateReservation(v, reservation)
-
-	if !v.ValidData() {
-		// Manually convert url.Values to map[string]string for FormData
-		formData := make(map[string]string)
-		for key := range r.PostForm {
-			formData[key] = r.PostFormValue(key)
+	data.ValidateReservation(v, reservation, venue)
+
+	// Lock in the price at booking time
+	app.priceReservation(v, reservation, venue)
+
+	// A hold pencils the slot in until the customer confirms it, and lapses
+	// at the latest when the booking would start
+	hold := r.PostFormValue("hold") != ""
+	if hold {
+		v.Check(r.PostFormValue("repeat") == "", "repeat", "a hold can only be placed on a single booking")
+		reservation.HoldExpires = time.Now().Add(app.holdTTL).Truncate(time.Second)
+		if reservation.HoldExpires.After(reservation.StartAt) {
+			reservation.HoldExpires = reservation.StartAt
 		}
+	}
 
-		tmplData := NewTemplateData(r)
-		tmplData.Venue = &data.Venue{ID: int64(id)} // minimal venue data
-		tmplData.FormData = formData
-		tmplData.FormErrors = v.Errors
-		tmplData.IsAuthenticated = app.isAuthenticated(r)
+	// Recurring bookings are expanded and booked as a whole
+	if r.PostFormValue("repeat") != "" && !hold {
+		app.createReservationSeries(w, r, venue, reservation, v)
+		return
+	}
 
-		err = app.render(w, http.StatusUnprocessableEntity, "viewvenue.tmpl", tmplData)
-		if err != nil {
-			app.logger.Error("failed to render view venue", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		}
+	if !v.ValidData() {
+		app.renderBookingForm(w, r, http.StatusUnprocessableEntity, venue, v)
+		return
+	}
+
+	// Time offered to the waitlist is held for that customer
+	err = app.checkWaitlistOffers(reservation, v)
+	if err != nil {
+		app.logger.Error("failed to check waitlist offers", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !v.ValidData() {
+		app.renderBookingForm(w, r, http.StatusConflict, venue, v)
 		return
 	}
 
 	// Insert into database
 	err = app.reservation.Insert(reservation)
 	if err != nil {
+		if errors.Is(err, data.ErrReservationConflict) {
+			v.AddError("start_time", app.conflictMessage(reservation))
+			app.renderBookingForm(w, r, http.StatusConflict, venue, v)
+			return
+		}
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		app.logger.Error("failed to insert reservation", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	if reservation.IsHeld() {
+		app.session.Put(r, "flash", "Slot held until "+reservation.HoldExpires.Format("Jan 02, 2006 15:04")+". Confirm it before then to keep it.")
+		http.Redirect(w, r, fmt.Sprintf("/reservations?status=%d", data.StatusHeld), http.StatusSeeOther)
+		return
+	}
+
+	// Venues that review bookings leave the reservation pending
+	if reservation.IsPending() {
+		app.session.Put(r, "flash", "Reservation requested! The venue owner will review it shortly.")
+		http.Redirect(w, r, "/reservations?status=3", http.StatusSeeOther)
+		return
+	}
+
 	// Redirect back to venue view
 	app.session.Put(r, "flash", "Reservation Made!")
 	app.logger.Info("")
 	http.Redirect(w, r, "/reservations", http.StatusSeeOther)
 }
 
-func (app *application) showAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := app.reservation.FetchAllConfirmedReservations()
-	if err != nil {
-		app.logger.Error("failed to get reservations", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+// createReservationSeries books every occurrence of a recurring reservation.
+// The first booking has already been validated into v.
+func (app *application) createReservationSeries(w http.ResponseWriter, r *http.Request, venue *data.Venue, first *data.Reservation, v *validator.Validator) {
+	rec := data.Recurrence{
+		Frequency: r.PostFormValue("repeat"),
+		Interval:  1,
+	}
+	if interval, err := strconv.Atoi(r.PostFormValue("interval")); err == nil {
+		rec.Interval = interval
 	}
 
-	data := NewTemplateData(r)
-	data.Title = "Confirmed Reservations"
-	data.IsAuthenticated = app.isAuthenticated(r)
+	switch r.PostFormValue("repeat_end") {
+	case "until":
+		rec.Until = app.parseDateTime(r.PostFormValue("until"), "00:00")
+		if rec.Until.IsZero() {
+			v.AddError("repeat_end", "end date must be provided")
+		}
+	default:
+		count, err := strconv.Atoi(r.PostFormValue("count"))
+		if err != nil {
+			v.AddError("repeat_end", "number of occurrences must be provided")
+		}
+		rec.Count = count
+	}
 
-	for _, r := range reservations {
-		// Dereference each pointer
-		data.Reservation = append(data.Reservation, *r)
+	for _, field := range strings.FieldsFunc(r.PostFormValue("exceptions"), func(c rune) bool {
+		return c == ',' || c == '\n' || c == '\r' || c == ' '
+	}) {
+		exception := app.parseDateTime(field, "00:00")
+		if exception.IsZero() {
+			v.AddError("exceptions", "must be dates in YYYY-MM-DD format")
+			break
+		}
+		rec.Exceptions = append(rec.Exceptions, exception)
 	}
 
-	err = app.render(w, http.StatusOK, "reservationlist.tmpl", data)
-	if err != nil {
-		app.logger.Error("failed to render venue page", "template", "reservationlist.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	data.ValidateRecurrence(v, &rec, first.StartAt)
+	if !v.ValidData() {
+		app.renderBookingForm(w, r, http.StatusUnprocessableEntity, venue, v)
 		return
 	}
-}
 
-func (app *application) showCancelledReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := app.reservation.FetchAllCancelledReservations()
-	if err != nil {
-		app.logger.Error("failed to get cancelled reservations", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	occurrences := rec.Expand(first)
+	data.ValidateOccurrences(v, occurrences, venue)
+	if !v.ValidData() {
+		app.renderBookingForm(w, r, http.StatusUnprocessableEntity, venue, v)
 		return
 	}
 
-	data := NewTemplateData(r)
-	data.Title = "Cancelled Reservations"
-	data.Flash = app.session.PopString(r, "flash")
-	data.IsAuthenticated = app.isAuthenticated(r)
-
-	for _, r := range reservations {
-		data.Reservation = append(data.Reservation, *r)
+	for _, o := range occurrences {
+		app.priceReservation(v, o, venue)
+	}
+	if !v.ValidData() {
+		app.renderBookingForm(w, r, http.StatusUnprocessableEntity, venue, v)
+		return
 	}
 
-	err = app.render(w, http.StatusOK, "reservationlist.tmpl", data)
+	// Time offered to the waitlist is held for that customer
+	err := app.checkSeriesWaitlistOffers(occurrences, v)
 	if err != nil {
-		app.logger.Error("failed to render reservation page", "template", "reservationlist.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		app.logger.Error("failed to check waitlist offers", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-}
-
-func (app *application) cancelReservation(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	if !v.ValidData() {
+		app.renderBookingForm(w, r, http.StatusConflict, venue, v)
 		return
 	}
 
-	// Extract the ID from the URL manually
-	path := r.URL.Path
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) < 3 {
-		http.NotFound(w, r)
-		return
+	series := &data.ReservationSeries{
+		VenueID:    venue.ID,
+		CustomerID: first.CustomerID,
+		Recurrence: rec,
 	}
 
-	idStr := parts[2]
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	err = app.reservation.InsertSeries(series, occurrences)
 	if err != nil {
-		app.logger.Error("invalid reservation ID", "input", idStr, "error", err)
-		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		var conflict *data.SeriesConflictError
+		if errors.As(err, &conflict) {
+			dates := make([]string, len(conflict.Dates))
+			for i, d := range conflict.Dates {
+				dates[i] = d.Format("Jan 02, 2006")
+			}
+			v.AddError("repeat", "these dates are already booked: "+strings.Join(dates, ", ")+"; add them as exceptions")
+			app.renderBookingForm(w, r, http.StatusConflict, venue, v)
+			return
+		}
+		app.logger.Error("failed to insert reservation series", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	err = app.reservation.Cancel(id)
-	if err != nil {
-		app.logger.Error("failed to cancel reservation", "error", err)
-		http.Error(w, "Failed to cancel reservation", http.StatusInternalServerError)
+	if occurrences[0].IsPending() {
+		app.session.Put(r, "flash", fmt.Sprintf("%d bookings requested! The venue owner will review them shortly.", len(occurrences)))
+		http.Redirect(w, r, "/reservations?status=3", http.StatusSeeOther)
 		return
 	}
 
-	app.session.Put(r, "flash", "Cancelled Reservation!")
-	app.logger.Info("")
-	http.Redirect(w, r, "/reservations/cancelled", http.StatusSeeOther)
+	app.session.Put(r, "flash", fmt.Sprintf("%d bookings made!", len(occurrences)))
+	http.Redirect(w, r, "/reservations", http.StatusSeeOther)
 }
 
-func (app *application) showUpdateReservationForm(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	parts := strings.Split(strings.Trim(path, "/"), "/")
+// renderBookingForm re-displays the venue page with the submitted booking
+// form and the errors that stopped it
+func (app *application) renderBookingForm(w http.ResponseWriter, r *http.Request, status int, venue *data.Venue, v *validator.Validator) {
+	// Manually convert url.Values to map[string]string for FormData
+	formData := make(map[string]string)
+	for key := range r.PostForm {
+		formData[key] = r.PostFormValue(key)
+	}
 
-	if len(parts) < 3 {
-		http.NotFound(w, r)
+	tmplData, err := app.venuePage(r, venue)
+	if err != nil {
+		app.logger.Error("failed to load venue page", "id", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	tmplData.FormData = formData
+	tmplData.FormErrors = v.Errors
+
+	err = app.render(w, status, "viewvenue.tmpl", tmplData)
+	if err != nil {
+		app.logger.Error("failed to render view venue", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (app *application) showAllReservations(w http.ResponseWriter, r *http.Request) {
+	app.renderReservationList(w, r, "Confirmed Reservations", data.StatusConfirmed)
+}
+
+func (app *application) showCancelledReservations(w http.ResponseWriter, r *http.Request) {
+	app.renderReservationList(w, r, "Cancelled Reservations", data.StatusCancelled)
+}
+
+// renderReservationList shows one page of the signed-in customer's own
+// reservations, filtered by the query string
+func (app *application) renderReservationList(w http.ResponseWriter, r *http.Request, title string, defaultStatus data.ReservationStatus) {
+	userId, ok := app.session.Get(r, "authenticatedUserID").(int)
+	if !ok {
+		app.session.Put(r, "flash", "Please log in to view your reservations.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.NewValidator()
+
+	filters := data.ReservationFilters{
+		Status:  data.ReservationStatus(app.readInt(qs, "status", int(defaultStatus), v)),
+		VenueID: int64(app.readInt(qs, "venue", 0, v)),
+		From:    app.readDate(qs, "from", v),
+		To:      app.readDate(qs, "to", v),
+		Filters: data.Filters{
+			Page:     app.readInt(qs, "page", 1, v),
+			PageSize: app.readInt(qs, "page_size", 10, v),
+		},
+	}
+	data.ValidateReservationFilters(v, filters)
+
+	tmplData := NewTemplateData(r)
+	tmplData.Title = title
+	tmplData.Flash = app.session.PopString(r, "flash")
+	tmplData.IsAuthenticated = app.isAuthenticated(r)
+	tmplData.FormData = map[string]string{
+		"status": strconv.FormatInt(int64(filters.Status), 10),
+		"venue":  qs.Get("venue"),
+		"from":   qs.Get("from"),
+		"to":     qs.Get("to"),
+	}
+	tmplData.PageQuery = pageQuery(qs)
+	tmplData.FeedURL = app.feedURL(r, feedCustomer, int64(userId))
+	tmplData.User = app.contextGetUser(r.Context())
+
+	venues, err := app.venue.FetchAllVenues()
+	if err != nil {
+		app.logger.Error("failed to get venues", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	for _, venue := range venues {
+		tmplData.Venues = append(tmplData.Venues, *venue)
+	}
+
+	if !v.ValidData() {
+		tmplData.FormErrors = v.Errors
+		err = app.render(w, http.StatusUnprocessableEntity, "reservationlist.tmpl", tmplData)
+		if err != nil {
+			app.logger.Error("failed to render reservation page", "template", "reservationlist.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	reservations, metadata, err := app.reservation.FetchForCustomer(int64(userId), filters)
+	if err != nil {
+		app.logger.Error("failed to get reservations", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, res := range reservations {
+		// Dereference each pointer
+		tmplData.Reservation = append(tmplData.Reservation, *res)
+	}
+	tmplData.Metadata = metadata
+
+	err = app.render(w, http.StatusOK, "reservationlist.tmpl", tmplData)
+	if err != nil {
+		app.logger.Error("failed to render reservation page", "template", "reservationlist.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// CancellationSummary is what the cancellation confirmation page shows: the
+// refund and fee for cancelling one booking and, for a recurring booking, for
+// cancelling it and every later occurrence
+type CancellationSummary struct {
+	Policy          data.CancellationPolicy
+	Quote           data.CancellationQuote
+	Following       int
+	FollowingRefund data.Money
+	FollowingFee    data.Money
+}
+
+// showCancelReservation asks the customer to confirm a cancellation, showing
+// what the booking's policy refunds and charges if they go ahead now
+func (app *application) showCancelReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, venue, ok := app.loadCancellation(w, r)
+	if !ok {
+		return
+	}
+
+	if !reservation.IsActive() {
+		app.session.Put(r, "flash", "This reservation can no longer be cancelled.")
+		http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+		return
+	}
+
+	// The refund follows the policy the booking was made under, not the
+	// venue's current one
+	policy := reservation.CancellationPolicy()
+	now := time.Now()
+	summary := &CancellationSummary{
+		Policy: policy,
+		Quote:  policy.Quote(reservation, now),
+	}
+
+	if reservation.InSeries() {
+		occurrences, err := app.reservation.FetchSeriesFrom(reservation)
+		if err != nil {
+			app.logger.Error("failed to fetch reservation series", "seriesID", reservation.SeriesID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, o := range occurrences {
+			quote := o.CancellationPolicy().Quote(o, now)
+			summary.Following++
+			summary.FollowingRefund += quote.Refund
+			summary.FollowingFee += quote.Fee
+		}
+	}
+
+	tmplData := NewTemplateData(r)
+	tmplData.Title = "Cancel Reservation"
+	tmplData.Venue = venue
+	tmplData.Reservation = []data.Reservation{*reservation}
+	tmplData.Cancellation = summary
+	tmplData.FormData = map[string]string{"scope": r.URL.Query().Get("scope")}
+	tmplData.IsAuthenticated = app.isAuthenticated(r)
+
+	err := app.render(w, http.StatusOK, "cancelreservation.tmpl", tmplData)
+	if err != nil {
+		app.logger.Error("failed to render cancellation page", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// cancelReservation cancels the customer's booking, or with scope=following
+// that booking and every later one in its series, charging any fee the
+// cancellation policy it was booked under sets
+func (app *application) cancelReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, _, ok := app.loadCancellation(w, r)
+	if !ok {
+		return
+	}
+
+	// Cancel this and every later occurrence of a recurring booking
+	if r.PostFormValue("scope") == "following" {
+		cancelled, err := app.reservation.CancelSeriesFrom(reservation.ID, reservation.CustomerID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			app.logger.Error("failed to cancel reservation series", "error", err)
+			http.Error(w, "Failed to cancel reservation", http.StatusInternalServerError)
+			return
+		}
+
+		var refund, fee data.Money
+		for _, o := range cancelled {
+			refund += o.Refund
+			fee += o.Fee
+			app.offerFreedSlot(o.VenueID, o.StartAt, o.EndAt)
+		}
+
+		app.session.Put(r, "flash", fmt.Sprintf("Cancelled %d Reservations! Refund: $%s, cancellation fee: $%s.", len(cancelled), refund, fee))
+		http.Redirect(w, r, "/reservations/cancelled", http.StatusSeeOther)
+		return
+	}
+
+	quote, err := app.reservation.Cancel(reservation.ID, reservation.CustomerID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, data.ErrInvalidTransition) {
+			app.session.Put(r, "flash", "This reservation can no longer be cancelled.")
+			http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+			return
+		}
+		app.logger.Error("failed to cancel reservation", "error", err)
+		http.Error(w, "Failed to cancel reservation", http.StatusInternalServerError)
+		return
+	}
+
+	app.offerFreedSlot(reservation.VenueID, reservation.StartAt, reservation.EndAt)
+
+	app.session.Put(r, "flash", fmt.Sprintf("Cancelled Reservation! Refund: $%s, cancellation fee: $%s.", quote.Refund, quote.Fee))
+	http.Redirect(w, r, "/reservations/cancelled", http.StatusSeeOther)
+}
+
+// loadCancellation fetches the signed-in customer's reservation named in the
+// path along with its venue, writing the error response itself when either
+// can't be loaded
+func (app *application) loadCancellation(w http.ResponseWriter, r *http.Request) (*data.Reservation, *data.Venue, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	user := app.contextGetUser(r.Context())
+
+	reservation, err := app.reservation.FetchByID(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return nil, nil, false
+		}
+		app.logger.Error("failed to fetch reservation", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	// Customers may only cancel their own reservations
+	if reservation.CustomerID != user.ID {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+
+	venue, err := app.venue.GetVenueByID(int(reservation.VenueID))
+	if err != nil || venue == nil {
+		app.logger.Error("failed to fetch venue", "id", reservation.VenueID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	return reservation, venue, true
+}
+
+// confirmHold turns one of the customer's holds into a booking
+func (app *application) confirmHold(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r.Context())
+	reservation := &data.Reservation{ID: id, CustomerID: user.ID}
+
+	err = app.reservation.ConfirmHold(reservation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			http.NotFound(w, r)
+		case errors.Is(err, data.ErrHoldExpired):
+			app.session.Put(r, "flash", "Sorry, this hold has lapsed and the slot has been released.")
+			http.Redirect(w, r, "/reservations/cancelled", http.StatusSeeOther)
+		case errors.Is(err, data.ErrInvalidTransition):
+			app.session.Put(r, "flash", "This reservation is not on hold.")
+			http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+		default:
+			app.logger.Error("failed to confirm hold", "id", id, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if reservation.IsPending() {
+		app.session.Put(r, "flash", "Reservation requested! The venue owner will review it shortly.")
+		http.Redirect(w, r, "/reservations?status=3", http.StatusSeeOther)
+		return
+	}
+
+	app.session.Put(r, "flash", "Reservation confirmed!")
+	http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+}
+
+func (app *application) showUpdateReservationForm(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(parts) < 3 {
+		http.NotFound(w, r)
 		return
 	}
 
@@ -891,15 +1548,44 @@ func (app *application) showUpdateReservationForm(w http.ResponseWriter, r *http
 		return
 	}
 
+	userId, ok := app.session.Get(r, "authenticatedUserID").(int)
+	if !ok {
+		app.session.Put(r, "flash", "Please log in to update a reservation.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
 	reservation, err := app.reservation.FetchByID(id)
 	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
 		app.logger.Error("failed to fetch reservation", "id", id, "error", err)
-		http.Error(w, "Reservation not found", http.StatusNotFound)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Customers may only see their own reservations
+	if reservation.CustomerID != int64(userId) {
+		http.NotFound(w, r)
+		return
+	}
+
+	venue, err := app.venue.GetVenueByID(int(reservation.VenueID))
+	if err != nil {
+		app.logger.Error("failed to fetch venue", "id", reservation.VenueID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if venue == nil {
+		http.NotFound(w, r)
 		return
 	}
 
 	tmplData := NewTemplateData(r)
 	tmplData.Title = "Edit Reservation"
+	tmplData.Venue = venue
 	tmplData.Reservation = []data.Reservation{*reservation}
 	tmplData.IsAuthenticated = app.isAuthenticated(r)
 
@@ -945,75 +1631,109 @@ func (app *application) updateReservation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Parse venue ID from form
-	venueIDStr := r.PostFormValue("venue_id")
-	venueID, err := strconv.ParseInt(venueIDStr, 10, 64)
+	// Load the stored reservation so the venue can't be swapped through the form
+	existing, err := app.reservation.FetchByID(id)
 	if err != nil {
-		app.logger.Error("invalid venue ID", "input", venueIDStr, "error", err)
-		http.Error(w, "Invalid venue ID", http.StatusBadRequest)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to fetch reservation", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Parse date/time fields
-	startDateStr := r.PostFormValue("start_date")
-	startTimeStr := r.PostFormValue("start_time")
-	endTimeStr := r.PostFormValue("end_time")
+	// Customers may only change their own reservations
+	if existing.CustomerID != int64(userId) {
+		http.NotFound(w, r)
+		return
+	}
 
-	startDate, err := time.Parse("2006-01-02", startDateStr)
-	if err != nil {
-		startDate = time.Time{}
+	// Cancelled, rejected and finished bookings can't be rescheduled
+	if !existing.IsActive() {
+		app.session.Put(r, "flash", "This reservation can no longer be changed.")
+		http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+		return
+	}
+
+	// Load the venue so the booking can be checked against it
+	venue, err := app.venue.GetVenueByID(int(existing.VenueID))
+	if err != nil || venue == nil {
+		app.logger.Error("failed to fetch venue", "id", existing.VenueID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
-	startDateTimeStr := fmt.Sprintf("%s %s", startDateStr, startTimeStr)
-	startDateTime, err := time.Parse("2006-01-02 15:04", startDateTimeStr)
+	err = app.schedule.Load(venue)
 	if err != nil {
-		startDateTime = time.Time{}
+		app.logger.Error("failed to load venue schedule", "id", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
-	endDateTimeStr := fmt.Sprintf("%s %s", startDateStr, endTimeStr)
-	endDateTime, err := time.Parse("2006-01-02 15:04", endDateTimeStr)
+	// Parse date/time fields
+	startDateStr := r.PostFormValue("start_date")
+	endDateStr := r.PostFormValue("end_date")
+
+	guestCount, err := strconv.ParseInt(r.PostFormValue("guest_count"), 10, 64)
 	if err != nil {
-		endDateTime = time.Time{}
+		guestCount = 0
 	}
 
 	// Build updated reservation
 	reservation := &data.Reservation{
 		ID:         int64(id),
-		VenueID:    venueID,
+		VenueID:    venue.ID,
 		CustomerID: int64(userId),
-		StartDate:  startDate,
-		StartTime:  startDateTime,
-		EndTime:    endDateTime,
-		Status:     r.PostFormValue("status"),
+		SeriesID:   existing.SeriesID,
+		StartAt:    app.parseDateTime(startDateStr, r.PostFormValue("start_time")),
+		EndAt:      app.parseDateTime(endDateOrStart(endDateStr, startDateStr), r.PostFormValue("end_time")),
+		GuestCount: guestCount,
 	}
 
 	// Validate
 	v := validator.NewValidator()
-	data.ValidateReservation(v, reservation)
+	data.ValidateReservation(v, reservation, venue)
+
+	// Re-quote the new times at the venue's current rate
+	app.priceReservation(v, reservation, venue)
 
 	if !v.ValidData() {
-		formData := make(map[string]string)
-		for key := range r.PostForm {
-			formData[key] = r.PostFormValue(key)
-		}
+		app.renderUpdateReservationForm(w, r, http.StatusUnprocessableEntity, reservation, venue, v)
+		return
+	}
 
-		tmplData := NewTemplateData(r)
-		tmplData.Venue = &data.Venue{ID: venueID}
-		tmplData.FormData = formData
-		tmplData.FormErrors = v.Errors
-		tmplData.IsAuthenticated = app.isAuthenticated(r)
+	// Move this and every later occurrence of a series by the same amount
+	if existing.InSeries() && r.PostFormValue("scope") == "following" {
+		app.updateReservationSeries(w, r, existing, reservation, venue, v)
+		return
+	}
 
-		err = app.render(w, http.StatusUnprocessableEntity, "updatereservation.tmpl", tmplData)
-		if err != nil {
-			app.logger.Error("failed to render update form", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		}
+	// Time offered to the waitlist is held for that customer
+	err = app.checkWaitlistOffers(reservation, v)
+	if err != nil {
+		app.logger.Error("failed to check waitlist offers", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !v.ValidData() {
+		app.renderUpdateReservationForm(w, r, http.StatusConflict, reservation, venue, v)
 		return
 	}
 
 	// Perform update
 	err = app.reservation.Update(reservation)
 	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, data.ErrReservationConflict) {
+			v.AddError("start_time", app.conflictMessage(reservation))
+			app.renderUpdateReservationForm(w, r, http.StatusConflict, reservation, venue, v)
+			return
+		}
+
 		app.logger.Error("failed to update reservation", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -1023,3 +1743,467 @@ func (app *application) updateReservation(w http.ResponseWriter, r *http.Request
 	app.session.Put(r, "flash", "Reservation Updated!")
 	http.Redirect(w, r, "/reservations", http.StatusSeeOther)
 }
+
+// updateReservationSeries applies the change made to one occurrence to it and
+// every later occurrence in its series: each moves by the same amount and
+// takes the new length and guest count
+func (app *application) updateReservationSeries(w http.ResponseWriter, r *http.Request, existing, changed *data.Reservation, venue *data.Venue, v *validator.Validator) {
+	occurrences, err := app.reservation.FetchSeriesFrom(existing)
+	if err != nil {
+		app.logger.Error("failed to fetch reservation series", "seriesID", existing.SeriesID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	shift := changed.StartAt.Sub(existing.StartAt)
+	duration := changed.EndAt.Sub(changed.StartAt)
+	for _, o := range occurrences {
+		o.StartAt = o.StartAt.Add(shift)
+		o.EndAt = o.StartAt.Add(duration)
+		o.GuestCount = changed.GuestCount
+		app.priceReservation(v, o, venue)
+	}
+
+	data.ValidateOccurrences(v, occurrences, venue)
+	if !v.ValidData() {
+		app.renderUpdateReservationForm(w, r, http.StatusUnprocessableEntity, changed, venue, v)
+		return
+	}
+
+	// Time offered to the waitlist is held for that customer
+	err = app.checkSeriesWaitlistOffers(occurrences, v)
+	if err != nil {
+		app.logger.Error("failed to check waitlist offers", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !v.ValidData() {
+		app.renderUpdateReservationForm(w, r, http.StatusConflict, changed, venue, v)
+		return
+	}
+
+	err = app.reservation.UpdateSeries(occurrences, shift)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		var conflict *data.SeriesConflictError
+		if errors.As(err, &conflict) {
+			v.AddError("start_time", "the new time clashes with another booking on "+conflict.Dates[0].Format("Jan 02, 2006"))
+			app.renderUpdateReservationForm(w, r, http.StatusConflict, changed, venue, v)
+			return
+		}
+		app.logger.Error("failed to update reservation series", "seriesID", existing.SeriesID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", fmt.Sprintf("%d Reservations Updated!", len(occurrences)))
+	http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+}
+
+// priceReservation locks in the reservation's price at the venue's current
+// rate, recording on v when the total is too large to book
+func (app *application) priceReservation(v *validator.Validator, reservation *data.Reservation, venue *data.Venue) {
+	_, err := app.pricing.PriceReservation(reservation, venue)
+	v.Check(err == nil, "end_time", "makes the price of this booking too large to accept")
+}
+
+// previewQuote returns the price breakdown for a prospective booking as JSON
+// so the booking form can show it before the customer submits
+func (app *application) previewQuote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	venue, err := app.venue.GetVenueByID(id)
+	if err != nil {
+		app.logger.Error("failed to fetch venue", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if venue == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	startDateStr := qs.Get("start_date")
+	startAt := app.parseDateTime(startDateStr, qs.Get("start_time"))
+	endAt := app.parseDateTime(endDateOrStart(qs.Get("end_date"), startDateStr), qs.Get("end_time"))
+
+	v := validator.NewValidator()
+	v.Check(validator.IsDateSelected(startAt), "start_time", "must be provided")
+	v.Check(validator.IsDateSelected(endAt), "end_time", "must be provided")
+	v.Check(endAt.After(startAt), "end_time", "must be after the start")
+	v.Check(endAt.Sub(startAt) <= data.MaxBookingDuration, "end_time", "booking must not be longer than 366 days")
+
+	var quote data.Quote
+	if v.ValidData() {
+		quote, err = app.pricing.Quote(venue.Price, startAt, endAt)
+		v.Check(err == nil, "end_time", "makes the price of this booking too large to accept")
+	}
+
+	if !v.ValidData() {
+		err = app.writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": v.Errors})
+		if err != nil {
+			app.logger.Error("failed to write quote errors", "error", err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{
+		"quote":    quote,
+		"hours":    quote.Hours(),
+		"tax_rate": app.pricing.TaxPercent(),
+	})
+	if err != nil {
+		app.logger.Error("failed to write quote", "error", err)
+	}
+}
+
+// renderUpdateReservationForm re-displays the reservation update form with the
+// submitted values and the errors that stopped the update
+func (app *application) renderUpdateReservationForm(w http.ResponseWriter, r *http.Request, status int, reservation *data.Reservation, venue *data.Venue, v *validator.Validator) {
+	formData := make(map[string]string)
+	for key := range r.PostForm {
+		formData[key] = r.PostFormValue(key)
+	}
+
+	tmplData := NewTemplateData(r)
+	tmplData.Title = "Edit Reservation"
+	tmplData.Venue = venue
+	tmplData.Reservation = []data.Reservation{*reservation}
+	tmplData.FormData = formData
+	tmplData.FormErrors = v.Errors
+	tmplData.IsAuthenticated = app.isAuthenticated(r)
+
+	err := app.render(w, status, "updatereservation.tmpl", tmplData)
+	if err != nil {
+		app.logger.Error("failed to render update form", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// ------------------------------------------- Venue Schedule
+
+// updateVenueHours replaces the venue's weekly opening hours. Days left
+// unticked are closed; unticking every day opens the venue at all times.
+func (app *application) updateVenueHours(w http.ResponseWriter, r *http.Request) {
+	venue, ok := app.loadScheduleVenue(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	v := validator.NewValidator()
+	var hours []data.OpeningHours
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if r.PostFormValue(fmt.Sprintf("open_%d", day)) == "" {
+			continue
+		}
+
+		opens, errOpens := data.ParseClock(r.PostFormValue(fmt.Sprintf("opens_%d", day)))
+		closes, errCloses := data.ParseClock(r.PostFormValue(fmt.Sprintf("closes_%d", day)))
+		if errOpens != nil || errCloses != nil {
+			v.AddError("hours", fmt.Sprintf("%s needs an opening and a closing time", day))
+			continue
+		}
+
+		// A closing time of 00:00 means the venue stays open until midnight
+		if closes == 0 {
+			closes = 24 * 60
+		}
+
+		hours = append(hours, data.OpeningHours{Weekday: day, Opens: opens, Closes: closes})
+	}
+
+	data.ValidateOpeningHours(v, hours)
+	if !v.ValidData() {
+		venue.Hours = hours
+		app.renderEditVenue(w, r, http.StatusUnprocessableEntity, venue, v.Errors)
+		return
+	}
+
+	err = app.schedule.SetHours(venue.ID, hours)
+	if err != nil {
+		app.logger.Error("failed to save opening hours", "venueID", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Opening hours saved.")
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venue.ID), http.StatusSeeOther)
+}
+
+// createBlackout blocks off a period in which the venue takes no bookings.
+// Leaving out the times blocks the whole of the first and last day.
+func (app *application) createBlackout(w http.ResponseWriter, r *http.Request) {
+	venue, ok := app.loadScheduleVenue(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	startDateStr := r.PostFormValue("start_date")
+	startTimeStr := r.PostFormValue("start_time")
+	if startTimeStr == "" {
+		startTimeStr = "00:00"
+	}
+
+	endDateStr := endDateOrStart(r.PostFormValue("end_date"), startDateStr)
+	endAt := app.parseDateTime(endDateStr, r.PostFormValue("end_time"))
+	if r.PostFormValue("end_time") == "" {
+		endAt = app.parseDateTime(endDateStr, "00:00")
+		if !endAt.IsZero() {
+			endAt = endAt.AddDate(0, 0, 1)
+		}
+	}
+
+	blackout := &data.Blackout{
+		VenueID: venue.ID,
+		StartAt: app.parseDateTime(startDateStr, startTimeStr),
+		EndAt:   endAt,
+		Reason:  strings.TrimSpace(r.PostFormValue("reason")),
+	}
+
+	v := validator.NewValidator()
+	data.ValidateBlackout(v, blackout)
+	if !v.ValidData() {
+		app.renderEditVenue(w, r, http.StatusUnprocessableEntity, venue, v.Errors)
+		return
+	}
+
+	err = app.schedule.InsertBlackout(blackout)
+	if err != nil {
+		app.logger.Error("failed to add blackout", "venueID", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Blackout added.")
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venue.ID), http.StatusSeeOther)
+}
+
+// deleteBlackout removes one of the venue's blackout periods
+func (app *application) deleteBlackout(w http.ResponseWriter, r *http.Request) {
+	venueID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	blackoutID, err := strconv.ParseInt(r.PathValue("blackoutID"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.schedule.DeleteBlackout(blackoutID, venueID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to delete blackout", "id", blackoutID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Blackout removed.")
+	http.Redirect(w, r, fmt.Sprintf("/venue/%d/edit", venueID), http.StatusSeeOther)
+}
+
+// loadScheduleVenue fetches the venue in the path along with its opening
+// hours and blackouts. It writes the error response itself and reports false
+// when the handler should stop.
+func (app *application) loadScheduleVenue(w http.ResponseWriter, r *http.Request) (*data.Venue, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	venue, err := app.venue.GetVenueByID(id)
+	if err != nil {
+		app.logger.Error("failed to fetch venue", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if venue == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	err = app.schedule.Load(venue)
+	if err != nil {
+		app.logger.Error("failed to load venue schedule", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return venue, true
+}
+
+// ------------------------------------------- Owner Inbox -------------------------------------------
+// ownerReservations lists the bookings across all of the owner's venues
+func (app *application) ownerReservations(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r.Context())
+
+	tmplData := NewTemplateData(r)
+	tmplData.Title = "Reservation Inbox"
+	tmplData.HeaderText = "Bookings across your venues"
+	tmplData.Flash = app.session.PopString(r, "flash")
+	tmplData.IsAuthenticated = app.isAuthenticated(r)
+
+	for _, view := range []string{data.InboxPending, data.InboxUpcoming, data.InboxPast} {
+		reservations, err := app.reservation.FetchForOwner(user.ID, view)
+		if err != nil {
+			app.logger.Error("failed to get owner reservations", "view", view, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		for _, res := range reservations {
+			tmplData.Inbox[view] = append(tmplData.Inbox[view], *res)
+		}
+	}
+
+	err := app.render(w, http.StatusOK, "ownerreservations.tmpl", tmplData)
+	if err != nil {
+		app.logger.Error("failed to render owner inbox", "template", "ownerreservations.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// approveReservation confirms a pending booking at one of the owner's venues
+func (app *application) approveReservation(w http.ResponseWriter, r *http.Request) {
+	app.decideReservation(w, r, true)
+}
+
+// rejectReservation turns down a pending booking at one of the owner's venues
+func (app *application) rejectReservation(w http.ResponseWriter, r *http.Request) {
+	app.decideReservation(w, r, false)
+}
+
+// decideReservation records the owner's decision on a pending booking
+func (app *application) decideReservation(w http.ResponseWriter, r *http.Request, approve bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(r.PostFormValue("reason"))
+
+	v := validator.NewValidator()
+	data.ValidateStatusReason(v, reason, !approve)
+	if !v.ValidData() {
+		app.session.Put(r, "flash", "Reason "+v.Errors["reason"]+".")
+		http.Redirect(w, r, "/owner/reservations", http.StatusSeeOther)
+		return
+	}
+
+	user := app.contextGetUser(r.Context())
+
+	if approve {
+		err = app.reservation.Approve(id, user.ID, reason)
+	} else {
+		err = app.reservation.Reject(id, user.ID, reason)
+	}
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, data.ErrInvalidTransition) {
+			app.session.Put(r, "flash", "That reservation is no longer waiting for approval.")
+			http.Redirect(w, r, "/owner/reservations", http.StatusSeeOther)
+			return
+		}
+		app.logger.Error("failed to record reservation decision", "id", id, "approve", approve, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if approve {
+		app.session.Put(r, "flash", "Reservation approved!")
+	} else {
+		app.offerFreedReservation(id)
+		app.session.Put(r, "flash", "Reservation rejected.")
+	}
+	http.Redirect(w, r, "/owner/reservations", http.StatusSeeOther)
+}
+
+// markNoShow records that the customer never arrived for a past booking
+func (app *application) markNoShow(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r.Context())
+
+	err = app.reservation.MarkNoShow(id, user.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, data.ErrInvalidTransition) {
+			app.session.Put(r, "flash", "Only confirmed or completed bookings that have ended can be marked as a no-show.")
+			http.Redirect(w, r, "/owner/reservations", http.StatusSeeOther)
+			return
+		}
+		app.logger.Error("failed to mark reservation as no-show", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Reservation marked as a no-show.")
+	http.Redirect(w, r, "/owner/reservations", http.StatusSeeOther)
+}
+
+// conflictMessage describes the booking that clashes with the given reservation
+// so the customer knows which slot is already taken
+func (app *application) conflictMessage(reservation *data.Reservation) string {
+	clash, err := app.reservation.FetchConflicting(reservation)
+	if err != nil {
+		app.logger.Error("failed to fetch conflicting reservation", "error", err)
+	}
+	if clash == nil {
+		return "this time slot overlaps an existing booking"
+	}
+
+	if clash.SameDay() {
+		return fmt.Sprintf("overlaps an existing booking on %s from %s to %s",
+			clash.StartAt.Format("Jan 02, 2006"),
+			clash.StartAt.Format("15:04"),
+			clash.EndAt.Format("15:04"),
+		)
+	}
+
+	return fmt.Sprintf("overlaps an existing booking from %s to %s",
+		clash.StartAt.Format("Jan 02, 2006 15:04"),
+		clash.EndAt.Format("Jan 02, 2006 15:04"),
+	)
+}
@@ -0,0 +1,162 @@
+// filename: helpers.go
+// Description: Small helpers for reading request input and writing responses
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// readInt returns the integer value of a query string key, or the default
+// value if the key is missing. Invalid values are recorded on the validator.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readDate returns midnight, in the app's time zone, on the date stored under
+// a query string key in YYYY-MM-DD form, or the zero time if the key is
+// missing or invalid
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", s, app.location)
+	if err != nil {
+		v.AddError(key, "must be a date in YYYY-MM-DD format")
+		return time.Time{}
+	}
+
+	return t
+}
+
+// readMoney returns the amount stored under a query string key, or zero if
+// the key is missing or invalid
+func (app *application) readMoney(qs url.Values, key string, v *validator.Validator) data.Money {
+	s := qs.Get(key)
+	if s == "" {
+		return 0
+	}
+
+	m, err := data.ParseMoney(s)
+	if err != nil {
+		v.AddError(key, "must be an amount such as 75 or 75.50")
+		return 0
+	}
+
+	return m
+}
+
+// pageQuery returns the query string without its page parameter so pager
+// links can keep the rest of the filters intact
+func pageQuery(qs url.Values) string {
+	q := url.Values{}
+	for key, values := range qs {
+		if key == "page" {
+			continue
+		}
+		for _, value := range values {
+			if value != "" {
+				q.Add(key, value)
+			}
+		}
+	}
+
+	encoded := q.Encode()
+	if encoded != "" {
+		encoded += "&"
+	}
+	return encoded
+}
+
+// parseDateTime combines a YYYY-MM-DD date and an HH:MM time from a form into
+// a single timestamp in the app's time zone, returning the zero time if either
+// part is invalid
+func (app *application) parseDateTime(date, clock string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", date+" "+clock, app.location)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// endDateOrStart returns the end date from a form, falling back to the start
+// date when the customer left it blank for a same-day booking
+func endDateOrStart(endDate, startDate string) string {
+	if endDate == "" {
+		return startDate
+	}
+	return endDate
+}
+
+// writeJSON sends data as a JSON response with the given status code
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(js)
+	return err
+}
+
+// formInt reads an optional whole number from a form field, treating a blank
+// field as zero. Anything else that is not a number is recorded on v.
+func formInt(r *http.Request, key string, v *validator.Validator) int64 {
+	s := strings.TrimSpace(r.PostFormValue(key))
+	if s == "" {
+		return 0
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		v.AddError(key, "must be a whole number")
+		return 0
+	}
+
+	return i
+}
+
+// formCancellationPolicy reads the cancellation policy fields of the venue
+// form onto venue. Tiers only matter for a custom policy; ones that can't be
+// read are recorded on v.
+func formCancellationPolicy(r *http.Request, venue *data.Venue, v *validator.Validator) {
+	venue.Cancellation = r.PostFormValue("cancellation_policy")
+	if venue.Cancellation == "" {
+		venue.Cancellation = data.PolicyFlexible
+	}
+
+	venue.RefundTiers = nil
+	if venue.Cancellation != data.PolicyCustom {
+		return
+	}
+
+	tiers, err := data.ParseRefundTiers(r.PostFormValue("cancellation_tiers"))
+	if err != nil {
+		v.AddError("cancellation_tiers", "must be notice and refund pairs such as 7d:100, 48h:50")
+		return
+	}
+	venue.RefundTiers = tiers
+}
@@ -0,0 +1,340 @@
+// filename: images.go
+// Description: Uploading venue images, storing them in several sizes and serving them
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/imaging"
+	"github.com/aiycoleman/VenueSystemTest2/internal/storage"
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+const (
+	// maxImageSize is the largest image file that may be uploaded
+	maxImageSize = 8 << 20
+
+	// maxUploadSize caps the whole body of a form with an image on it
+	maxUploadSize = maxImageSize + 1<<20
+
+	// imageTimeout is how long storing or removing one image may take
+	imageTimeout = 30 * time.Second
+
+	// maxImageJobs is how many images may be decoded and scaled at once
+	maxImageJobs = 2
+
+	// uploadReadTimeout is how long a form with an image on it may take to
+	// arrive
+	uploadReadTimeout = 2 * time.Minute
+
+	// imageJobWait is how long an upload waits for an imageJobs slot
+	imageJobWait = 20 * time.Second
+
+	// uploadWriteTimeout is how long an upload may take to be scaled, stored
+	// and answered once it has a slot
+	uploadWriteTimeout = imageTimeout + 30*time.Second
+)
+
+// imageJobs holds a slot for each image being processed, so a burst of
+// uploads can't decode more large images at once than memory allows
+var imageJobs = make(chan struct{}, maxImageJobs)
+
+// imageSizes are the sizes each uploaded image is stored in, by the length
+// of their longest side in pixels
+var imageSizes = []struct {
+	name string
+	max  int
+}{
+	{data.ImageLarge, 1600},
+	{data.ImageMedium, 800},
+	{data.ImageThumb, 320},
+}
+
+// limitUpload refuses request bodies larger than maxUploadSize. It wraps the
+// whole chain, since the CSRF check reads the form before the owner is known,
+// and the session buffers the response so deadlines can't be moved from
+// inside it. The upload gets uploadReadTimeout to arrive, and long enough to
+// wait for a slot and be processed after that, rather than the server's own
+// timeouts, which would cut the connection on a slow link.
+func (app *application) limitUpload(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxUploadSize {
+			http.Error(w, fmt.Sprintf("The upload is too large. Images can be up to %d MB.", maxImageSize>>20),
+				http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+		rc := http.NewResponseController(w)
+		now := time.Now()
+		err := rc.SetReadDeadline(now.Add(uploadReadTimeout))
+		if err == nil {
+			err = rc.SetWriteDeadline(now.Add(uploadReadTimeout + imageJobWait + uploadWriteTimeout))
+		}
+		if err != nil {
+			app.logger.Warn("could not extend the deadlines for an upload", "error", err)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// waitForImageJob holds the request until one of the imageJobs slots is
+// free. It belongs inside the owner checks, so only signed-in owners can
+// take a slot, and runs once the whole form has arrived, so a slow upload
+// doesn't hold one. An upload that waits longer than imageJobWait is turned
+// away with 503.
+func (app *application) waitForImageJob(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A form that can't be read is left for the handler to report
+		if r.ParseMultipartForm(maxImageSize) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timer := time.NewTimer(imageJobWait)
+		defer timer.Stop()
+		select {
+		case imageJobs <- struct{}{}:
+			defer func() { <-imageJobs }()
+		case <-timer.C:
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Too many images are being uploaded right now. Please try again in a minute.",
+				http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// formImage reads and checks the image uploaded in the form field. It
+// returns nil when no file was chosen, or when the file was rejected, in
+// which case the reason is recorded on v.
+func formImage(r *http.Request, field string, v *validator.Validator) image.Image {
+	file, header, err := r.FormFile(field)
+	switch {
+	case errors.Is(err, http.ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+		return nil
+	case err != nil:
+		v.AddError(field, "could not be read, please try again")
+		return nil
+	}
+	defer file.Close()
+
+	if header.Size > maxImageSize {
+		v.AddError(field, fmt.Sprintf("must not be larger than %d MB", maxImageSize>>20))
+		return nil
+	}
+
+	b, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		v.AddError(field, "could not be read, please try again")
+		return nil
+	}
+	if len(b) > maxImageSize {
+		v.AddError(field, fmt.Sprintf("must not be larger than %d MB", maxImageSize>>20))
+		return nil
+	}
+
+	img, err := imaging.Decode(b)
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		v.AddError(field, "has too many pixels; please use a smaller image")
+		return nil
+	case err != nil:
+		v.AddError(field, "must be a JPEG, PNG or GIF image")
+		return nil
+	}
+	return img
+}
+
+// saveImage stores img in every size under a new random key, each size
+// scaled from the one before, and returns the key
+func (app *application) saveImage(img image.Image) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	key := "venues/" + hex.EncodeToString(b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageTimeout)
+	defer cancel()
+
+	for _, size := range imageSizes {
+		img = imaging.Fit(img, size.max)
+
+		var buf bytes.Buffer
+		err := imaging.EncodeJPEG(&buf, img)
+		if err == nil {
+			err = app.blobs.Put(ctx, data.ImageKey(key, size.name), &buf)
+		}
+		if err != nil {
+			app.deleteImage(key)
+			return "", err
+		}
+	}
+
+	return key, nil
+}
+
+// deleteImage removes every size of a stored image. Failures are only
+// logged: a leftover file does no harm.
+func (app *application) deleteImage(key string) {
+	if key == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageTimeout)
+	defer cancel()
+
+	for _, size := range imageSizes {
+		err := app.blobs.Delete(ctx, data.ImageKey(key, size.name))
+		if err != nil {
+			app.logger.Warn("failed to delete image", "key", key, "size", size.name, "error", err)
+		}
+	}
+}
+
+// serveImage serves a stored image. Keys are random and never reused, so
+// browsers may cache images for good.
+func (app *application) serveImage(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !strings.HasPrefix(key, "venues/") || !strings.HasSuffix(key, ".jpg") || !storage.ValidKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	blob, err := app.blobs.Open(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to open image", "key", key, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	if rs, ok := blob.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, time.Time{}, rs)
+		return
+	}
+	_, err = io.Copy(w, blob)
+	if err != nil {
+		app.logger.Warn("failed to send image", "key", key, "error", err)
+	}
+}
+
+// importImageLinks stores the images behind the links owners pasted before
+// images were uploaded, making each the cover of its venue's empty gallery,
+// and then forgets the link. The pages only show stored images, so until
+// then those venues have no picture. A link that can't be imported is kept
+// and tried again on the next start; the owner can upload an image instead.
+func (app *application) importImageLinks(ctx context.Context) {
+	links, err := app.images.GetLinkedImages()
+	if err != nil {
+		app.logger.Error("failed to list linked venue images", "error", err)
+		return
+	}
+
+	imported := 0
+	for _, l := range links {
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := app.importImageLink(l)
+		if err != nil {
+			app.logger.Warn("failed to import linked venue image", "venueID", l.VenueID, "link", l.Link, "error", err)
+			continue
+		}
+		imported++
+	}
+
+	if imported > 0 {
+		app.logger.Info("imported linked venue images", "count", imported)
+	}
+}
+
+// importImageLink fetches and stores one linked image
+func (app *application) importImageLink(l data.LinkedImage) error {
+	b, err := app.fetchImage(l.Link)
+	if err != nil {
+		return err
+	}
+
+	imageJobs <- struct{}{}
+	defer func() { <-imageJobs }()
+
+	img, err := imaging.Decode(b)
+	if err != nil {
+		return err
+	}
+
+	key, err := app.saveImage(img)
+	if err != nil {
+		return err
+	}
+
+	err = app.images.Insert(&data.VenueImage{VenueID: l.VenueID, Key: key})
+	if err != nil {
+		app.deleteImage(key)
+		return err
+	}
+
+	return app.images.ClearLink(l.VenueID)
+}
+
+// fetchImage downloads an image from a link, with the same limits as an
+// upload
+func (app *application) fetchImage(link string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), imageTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported %q link", req.URL.Scheme)
+	}
+
+	resp, err := app.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the image server returned %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxImageSize {
+		return nil, fmt.Errorf("the image is larger than %d MB", maxImageSize>>20)
+	}
+
+	return b, nil
+}
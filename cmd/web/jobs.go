@@ -0,0 +1,122 @@
+// filename: jobs.go
+// Description: Background jobs that run alongside the HTTP server
+
+package main
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// completionInterval is how often finished reservations are marked completed
+	completionInterval = 5 * time.Minute
+
+	// waitlistInterval is how often expired waitlist offers are passed on
+	waitlistInterval = time.Minute
+
+	// holdInterval is how often lapsed holds are released
+	holdInterval = time.Minute
+
+	// calendarCheckInterval is how often imported calendars are checked for
+	// ones due a sync; each is synced every app.calendarSyncInterval
+	calendarCheckInterval = time.Minute
+
+	// reminderInterval is how often due reminders are looked for
+	reminderInterval = time.Minute
+
+	// emailInterval is how often the outbox is checked for emails to send
+	emailInterval = 15 * time.Second
+)
+
+// startBackgroundJobs launches the periodic jobs and the one-off import of
+// linked venue images. They stop when ctx is cancelled; app.background.Wait
+// returns once they all have.
+func (app *application) startBackgroundJobs(ctx context.Context) {
+	app.background.Add(1)
+	go func() {
+		defer app.background.Done()
+		app.importImageLinks(ctx)
+	}()
+
+	app.goPeriodically(ctx, "complete past reservations", completionInterval, app.completePastReservations)
+	app.goPeriodically(ctx, "expire waitlist offers", waitlistInterval, app.expireWaitlistOffers)
+	app.goPeriodically(ctx, "release expired holds", holdInterval, app.releaseExpiredHolds)
+	app.goPeriodically(ctx, "sync imported calendars", calendarCheckInterval, app.syncCalendars)
+	app.goPeriodically(ctx, "send reminders", reminderInterval, app.sendReminders)
+	app.goPeriodically(ctx, "deliver emails", emailInterval, app.deliverEmails)
+}
+
+// goPeriodically starts runPeriodically in its own goroutine and tracks it in
+// app.background
+func (app *application) goPeriodically(ctx context.Context, name string, interval time.Duration, job func() error) {
+	app.background.Add(1)
+	go func() {
+		defer app.background.Done()
+		app.runPeriodically(ctx, name, interval, job)
+	}()
+}
+
+// runPeriodically calls job once straight away and then on every tick of the
+// interval until ctx is cancelled. Errors and panics are logged and the job
+// keeps running.
+func (app *application) runPeriodically(ctx context.Context, name string, interval time.Duration, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.runJob(name, job)
+
+		select {
+		case <-ctx.Done():
+			app.logger.Info("background job stopped", "job", name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob calls job once, logging its error or a panic so one bad run doesn't
+// stop the job for good
+func (app *application) runJob(name string, job func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.Error("background job panicked", "job", name, "error", err)
+		}
+	}()
+
+	if err := job(); err != nil {
+		app.logger.Error("background job failed", "job", name, "error", err)
+	}
+}
+
+// completePastReservations moves confirmed bookings that have ended to completed
+func (app *application) completePastReservations() error {
+	count, err := app.reservation.CompletePast()
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		app.logger.Info("marked past reservations completed", "count", count)
+	}
+	return nil
+}
+
+// releaseExpiredHolds frees the slots of holds that were never confirmed and
+// offers each one to the venue's waitlist
+func (app *application) releaseExpiredHolds() error {
+	released, err := app.reservation.ReleaseExpiredHolds()
+	if err != nil {
+		return err
+	}
+
+	for _, reservation := range released {
+		app.offerFreedSlot(reservation.VenueID, reservation.StartAt, reservation.EndAt)
+	}
+
+	if len(released) > 0 {
+		app.logger.Info("released expired holds", "count", len(released))
+	}
+	return nil
+}
@@ -9,12 +9,19 @@ import (
 	"flag"
 	"html/template"
 	"log/slog"
+	"math"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/geo"
+	"github.com/aiycoleman/VenueSystemTest2/internal/mailer"
+	"github.com/aiycoleman/VenueSystemTest2/internal/storage"
 	"github.com/golangcollege/sessions"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // application struct holds the application's dependencies.
@@ -22,12 +29,45 @@ type application struct {
 	addr          *string
 	venue         *data.VenueModel
 	reservation   *data.ReservationModel
+	schedule      *data.VenueScheduleModel
+	images        *data.VenueImageModel
+	waitlist      *data.WaitlistModel
+	calendars     *data.CalendarSourceModel
+	outbox        *data.OutboxModel
+	reminders     *data.ReminderModel
 	review        *data.ReviewModel
+	pricing       data.Pricing
 	users         *data.UsersModel
 	logger        *slog.Logger
 	templateCache map[string]*template.Template
 	session       *sessions.Session
 	tlsConfig     *tls.Config
+	feedKey       []byte
+	httpClient    *http.Client
+	mailer        mailer.Mailer
+	notifier      reminderNotifier
+	geocoder      geo.Geocoder
+	blobs         storage.BlobStore
+
+	// emailTemplates holds the parsed templates in ui/email
+	emailTemplates map[string]emailTemplate
+
+	// How long waitlist offers and holds last before they lapse
+	waitlistOfferTTL time.Duration
+	holdTTL          time.Duration
+
+	// How often each imported calendar is synced
+	calendarSyncInterval time.Duration
+
+	// How long before a booking starts each reminder is sent, longest first
+	reminderOffsets []time.Duration
+
+	// location is the time zone dates and times on forms are read in
+	location *time.Location
+
+	// background tracks the jobs started by startBackgroundJobs so shutdown
+	// can wait for them
+	background sync.WaitGroup
 }
 
 // Define command-line flags for server address and database connection
@@ -35,6 +75,22 @@ func main() {
 	addr := flag.String("addr", "", "HTTP network address")
 	dsn := flag.String("dsn", "", "PostgreSQL DSN")
 	secret := flag.String("secret", "e3f87@a6a4*3f2d18+a5@6c76a09d1f2", "Secret key")
+	feedSecret := flag.String("feed-secret", "", "Key for signing calendar feed URLs (defaults to -secret)")
+	taxRate := flag.Float64("tax-rate", 0, "Tax added to reservation quotes, in percent")
+	offerTTL := flag.Duration("waitlist-offer-ttl", 2*time.Hour, "How long a waitlisted customer has to claim a freed slot")
+	holdTTL := flag.Duration("hold-ttl", 24*time.Hour, "How long a tentative hold blocks a slot before it is released")
+	calendarSync := flag.Duration("calendar-sync-interval", 15*time.Minute, "How often imported venue calendars are synced")
+	allowPrivateFetch := flag.Bool("allow-private-fetch", false, "Let owner-supplied URLs such as calendars reach loopback and private addresses (for local testing only)")
+	smtpHost := flag.String("smtp-host", "", "SMTP server host (emails are logged instead of sent when empty)")
+	smtpPort := flag.Int("smtp-port", 25, "SMTP server port")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	remindBefore := flag.String("reminder-offsets", "48h,2h", "Comma-separated times before a booking to remind the customer (empty turns reminders off)")
+	smtpSender := flag.String("smtp-sender", "Venue System <no-reply@venuesystem.local>", "From address of outgoing email")
+	geocoderURL := flag.String("geocoder-url", "", "Nominatim search URL for looking up venue locations (the -geocoder-places list is used when empty)")
+	uploadDir := flag.String("upload-dir", "./uploads", "Directory uploaded venue images are stored in")
+	geocoderPlaces := flag.String("geocoder-places", "", "CSV file of place name, latitude and longitude for offline geocoding")
+	timezone := flag.String("timezone", "UTC", "IANA time zone the venues are in; dates and times on forms and pages are in this zone")
 
 	// Parse the command-line flags
 	flag.Parse()
@@ -42,8 +98,20 @@ func main() {
 	// Initialize a logger for structured logging
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	reminderOffsets, err := parseReminderOffsets(*remindBefore)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		logger.Error("invalid -timezone", "error", err)
+		os.Exit(1)
+	}
+
 	// Open a connection to the PostgreSQL database
-	db, err := openDB(*dsn)
+	db, err := openDB(*dsn, location)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
@@ -59,6 +127,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	emailTemplates, err := newEmailTemplateCache()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// Ensure the database connection is closed when the application exits
 	defer db.Close()
 
@@ -67,6 +141,43 @@ func main() {
 	session.Lifetime = 12 * time.Hour
 	session.Secure = true
 
+	// Calendar feed URLs are signed with their own key when one is given, so
+	// they can be revoked without signing everyone out
+	feedKey := []byte(*feedSecret)
+	if len(feedKey) == 0 {
+		feedKey = []byte(*secret)
+	}
+
+	// Without an SMTP server, emails are written to the log so the outbox
+	// still drains during development
+	var mail mailer.Mailer = &mailer.Log{Logger: logger}
+	if *smtpHost != "" {
+		mail = &mailer.SMTP{
+			Host:     *smtpHost,
+			Port:     *smtpPort,
+			Username: *smtpUsername,
+			Password: *smtpPassword,
+			Sender:   *smtpSender,
+		}
+	}
+
+	// Without a geocoding service, locations are looked up in a fixed list of
+	// places, which may be empty
+	var geocoder geo.Geocoder = geo.Static{}
+	if *geocoderURL != "" {
+		geocoder = &geo.Nominatim{
+			URL:       *geocoderURL,
+			UserAgent: "VenueSystem/1.0",
+			Client:    &http.Client{Timeout: geocodeTimeout},
+		}
+	} else if *geocoderPlaces != "" {
+		geocoder, err = loadPlaces(*geocoderPlaces)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	// Configuring TLS
 	tlsConfig := &tls.Config{
 		PreferServerCipherSuites: true,
@@ -75,15 +186,35 @@ func main() {
 
 	// Initialize the application struct with dependencies
 	app := &application{
-		addr:          addr,
-		venue:         &data.VenueModel{DB: db},
-		review:        &data.ReviewModel{DB: db},
-		reservation:   &data.ReservationModel{DB: db},
-		users:         &data.UsersModel{DB: db},
-		session:       session,
-		logger:        logger,
-		templateCache: templateCache,
-		tlsConfig:     tlsConfig,
+		addr:             addr,
+		venue:            &data.VenueModel{DB: db},
+		review:           &data.ReviewModel{DB: db},
+		reservation:      &data.ReservationModel{DB: db},
+		schedule:         &data.VenueScheduleModel{DB: db},
+		images:           &data.VenueImageModel{DB: db},
+		waitlist:         &data.WaitlistModel{DB: db},
+		calendars:        &data.CalendarSourceModel{DB: db},
+		outbox:           &data.OutboxModel{DB: db},
+		reminders:        &data.ReminderModel{DB: db},
+		users:            &data.UsersModel{DB: db},
+		pricing:          data.Pricing{TaxRate: int64(math.Round(*taxRate * 100))},
+		session:          session,
+		logger:           logger,
+		templateCache:    templateCache,
+		tlsConfig:        tlsConfig,
+		feedKey:          feedKey,
+		httpClient:       newFetchClient(calendarFetchTimeout, *allowPrivateFetch),
+		mailer:           mail,
+		notifier:         &emailReminders{mailer: mail, templates: emailTemplates},
+		geocoder:         geocoder,
+		blobs:            &storage.Local{Root: *uploadDir},
+		emailTemplates:   emailTemplates,
+		waitlistOfferTTL: *offerTTL,
+		holdTTL:          *holdTTL,
+
+		calendarSyncInterval: *calendarSync,
+		reminderOffsets:      reminderOffsets,
+		location:             location,
 	}
 
 	// Start the HTTP server
@@ -94,8 +225,20 @@ func main() {
 	}
 }
 
-// openDB establishes a connection to the PostgreSQL database.
-func openDB(dsn string) (*sql.DB, error) {
+// openDB establishes a connection to the PostgreSQL database. Sessions use
+// loc as their time zone, so times read back and dates worked out in SQL are
+// in the same zone as the forms.
+func openDB(dsn string, loc *time.Location) (*sql.DB, error) {
+	// Settings are added to the key=value form of the DSN
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		dsn, err = pq.ParseURL(dsn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dsn += " timezone=" + loc.String()
+
 	// Open the database connection
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
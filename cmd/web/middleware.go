@@ -6,6 +6,7 @@ package main
 import (
 	"context"
 	"net/http"
+	"strconv"
 
 	"github.com/aiycoleman/VenueSystemTest2/internal/data"
 	"github.com/justinas/nosurf"
@@ -120,6 +121,43 @@ func (app *application) requireRole(role int) func(next http.Handler) http.Handl
 	}
 }
 
+// requireVenueOwner only lets the request through when the signed-in user owns
+// the venue named by the {id} path value
+func (app *application) requireVenueOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r.Context())
+		if user == nil {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			http.Error(w, "Invalid venue ID", http.StatusBadRequest)
+			return
+		}
+
+		venue, err := app.venue.GetVenueByID(id)
+		if err != nil {
+			app.logger.Error("failed to fetch venue", "id", id, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if venue == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if venue.OwnerID != user.ID {
+			app.logger.Info("venue ownership check failed", "userID", user.ID, "venueID", venue.ID, "ownerID", venue.OwnerID)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Helper function to get user from request context
 // This is your context function for retrieving the user from context
 func (app *application) contextGetUser(ctx context.Context) *data.Users {
@@ -0,0 +1,85 @@
+// filename: outbound.go
+// Description: HTTP client for fetching URLs given to us by venue owners
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// maxFetchRedirects is how many redirects an owner-supplied URL may follow
+const maxFetchRedirects = 5
+
+// errBlockedAddress is returned when an owner-supplied URL points at an
+// address on our own network
+var errBlockedAddress = errors.New("the address is not on the public internet")
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip doesn't
+// count as private
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddress reports whether ip may be fetched from on an owner's behalf.
+// Loopback, private, link-local (which includes cloud metadata services),
+// multicast and unspecified addresses are refused.
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// refusePrivateAddresses is a net.Dialer Control hook. It runs after the
+// host name is resolved, on every connection including those for redirects,
+// so a public name can't be pointed at an internal address.
+func refusePrivateAddresses(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !publicAddress(addrPort.Addr()) {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// newFetchClient builds the client used to fetch owner-supplied URLs. Unless
+// allowPrivate is set, for example to import from a test server on this
+// machine, it refuses to connect to anything but public addresses. Proxies
+// from the environment are ignored, since the check only sees the address
+// actually dialled.
+func newFetchClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddresses
+	}
+
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirected to an unsupported %q URL", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,202 @@
+// filename: reminders.go
+// Description: Reminding customers of their bookings ahead of time
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/mailer"
+)
+
+// reminderTemplate is the email template used for reminders
+const reminderTemplate = "reservation_reminder"
+
+// reminderNotifier delivers reminders to customers. The scheduler only
+// decides which reminders are due, so a different channel can be plugged in
+// without touching it.
+type reminderNotifier interface {
+	Remind(ctx context.Context, reminder *data.Reminder) error
+}
+
+// emailReminders sends reminders by email
+type emailReminders struct {
+	mailer    mailer.Mailer
+	templates map[string]emailTemplate
+}
+
+// Remind emails the reminder to the customer
+func (n *emailReminders) Remind(ctx context.Context, reminder *data.Reminder) error {
+	msg, err := executeEmail(n.templates, reminderTemplate, reminder.Recipient, reminder)
+	if err != nil {
+		return err
+	}
+	return n.mailer.Send(ctx, msg)
+}
+
+// parseReminderOffsets reads a comma-separated list of durations such as
+// "48h,2h", longest first. An empty list turns reminders off.
+func parseReminderOffsets(s string) ([]time.Duration, error) {
+	var offsets []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reminder offset %q: %w", field, err)
+		}
+		if d < time.Minute || d%time.Minute != 0 {
+			return nil, fmt.Errorf("invalid reminder offset %q: must be a whole number of minutes", field)
+		}
+		if !slices.Contains(offsets, d) {
+			offsets = append(offsets, d)
+		}
+	}
+
+	slices.Sort(offsets)
+	slices.Reverse(offsets)
+	return offsets, nil
+}
+
+// describeOffsets lists the reminder offsets for display, e.g.
+// "48 hours and 2 hours"
+func describeOffsets(offsets []time.Duration) string {
+	parts := make([]string, len(offsets))
+	for i, d := range offsets {
+		switch {
+		case d == time.Hour:
+			parts[i] = "1 hour"
+		case d%time.Hour == 0:
+			parts[i] = fmt.Sprintf("%d hours", d/time.Hour)
+		default:
+			parts[i] = fmt.Sprintf("%d minutes", d/time.Minute)
+		}
+	}
+
+	if len(parts) < 2 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+// sendReminders sends every reminder that is due. Each one is claimed before
+// it is sent so it goes out once, and released again if sending fails so the
+// next run retries it.
+func (app *application) sendReminders() error {
+	if len(app.reminderOffsets) == 0 {
+		return nil
+	}
+
+	reminders, err := app.reminders.FetchDue(app.reminderOffsets)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, reminder := range reminders {
+		claimed, err := app.reminders.Claim(reminder, app.reminderOffsets)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+		err = app.notifier.Remind(ctx, reminder)
+		cancel()
+		if err != nil {
+			app.logger.Warn("reminder failed", "reservationID", reminder.ReservationID, "offset", reminder.Offset, "error", err)
+
+			err = app.reminders.Release(reminder)
+			if err != nil {
+				app.logger.Error("failed to release reminder", "reservationID", reminder.ReservationID, "error", err)
+			}
+			continue
+		}
+		sent++
+	}
+
+	if sent > 0 {
+		app.logger.Info("sent reminders", "count", sent)
+	}
+	return nil
+}
+
+// setReservationReminders turns reminders on or off for one of the
+// customer's reservations
+func (app *application) setReservationReminders(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r.Context())
+	enabled := r.PostFormValue("reminders") == "on"
+
+	err = app.reminders.SetForReservation(id, user.ID, enabled)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to update reservation reminders", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if enabled {
+		app.session.Put(r, "flash", "Reminders turned on for this booking.")
+	} else {
+		app.session.Put(r, "flash", "Reminders turned off for this booking.")
+	}
+	http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+}
+
+// showAccount shows the customer's account settings
+func (app *application) showAccount(w http.ResponseWriter, r *http.Request) {
+	td := NewTemplateData(r)
+	td.Title = "My Account"
+	td.Flash = app.session.PopString(r, "flash")
+	td.IsAuthenticated = app.isAuthenticated(r)
+	td.User = app.contextGetUser(r.Context())
+	td.ReminderSchedule = describeOffsets(app.reminderOffsets)
+
+	err := app.render(w, http.StatusOK, "account.tmpl", td)
+	if err != nil {
+		app.logger.Error("failed to render account page", "template", "account.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// updateAccountReminders turns reminders on or off for all of the
+// customer's reservations
+func (app *application) updateAccountReminders(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r.Context())
+	enabled := r.PostFormValue("reminders") == "on"
+
+	err := app.reminders.SetForCustomer(user.ID, enabled)
+	if err != nil {
+		app.logger.Error("failed to update account reminders", "userID", user.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if enabled {
+		app.session.Put(r, "flash", "Booking reminders turned on.")
+	} else {
+		app.session.Put(r, "flash", "Booking reminders turned off.")
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
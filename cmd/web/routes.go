@@ -36,26 +36,64 @@ func (app *application) routes() http.Handler {
 	mux.Handle("POST /user/login", dynamicMiddleware.ThenFunc(app.loginUser))
 	mux.Handle("POST /user/logout", dynamicMiddleware.ThenFunc(app.logoutUser))
 
+	// Calendar feeds are fetched by calendar apps, so they are protected by the
+	// signed token in the URL rather than a session
+	mux.HandleFunc("GET /feeds/venue/{id}/{token}", app.venueFeed)
+	mux.HandleFunc("GET /feeds/customer/{id}/{token}", app.customerFeed)
+
+	// Uploaded images are served from our own origin, without a session
+	mux.HandleFunc("GET /images/{key...}", app.serveImage)
+
 	// Protected routes - require authentication
 	protected := dynamicMiddleware.Append(app.requireAuthentication)
 
 	// Role-based access: owner role
 	ownerProtected := protected.Append(app.requireRole(1))
 
+	// Ownership-based access: owner of the venue in the path
+	venueOwnerProtected := ownerProtected.Append(app.requireVenueOwner)
+
+	// Image uploads: only an owner who passed the checks above may wait for
+	// one of the image processing slots
+	ownerUploading := ownerProtected.Append(app.waitForImageJob)
+	venueOwnerUploading := venueOwnerProtected.Append(app.waitForImageJob)
+
 	// Role-based access: User role
 	userProtected := protected.Append(app.requireRole(2))
 
 	// Public routes accessible by anyone
-	mux.Handle("GET /venue/listing", protected.ThenFunc(app.venueListing))  // Access to book, add, edit, delete
-	mux.Handle("GET /venue/form", ownerProtected.ThenFunc(app.venueForm))   // Only accessible by owner
-	mux.Handle("POST /venue/add", ownerProtected.ThenFunc(app.createVenue)) // Only accessible by owner
+	mux.Handle("GET /venue/listing", protected.ThenFunc(app.venueListing))                   // Access to book, add, edit, delete
+	mux.Handle("GET /venue/suggest", protected.ThenFunc(app.venueSuggest))                   // Autocomplete for the listing search
+	mux.Handle("GET /venue/form", ownerProtected.ThenFunc(app.venueForm))                    // Only accessible by owner
+	mux.Handle("POST /venue/add", app.limitUpload(ownerUploading.ThenFunc(app.createVenue))) // Only accessible by owner
 	mux.Handle("GET /venue/{id}", protected.ThenFunc(app.viewVenue))
+	mux.Handle("GET /venue/{id}/availability", protected.ThenFunc(app.venueAvailability))
+
+	mux.Handle("GET /venue/{id}/edit", venueOwnerProtected.ThenFunc(app.showUpdateVenueForm)) // venue owner only
+	mux.Handle("POST /venue/{id}/edit", venueOwnerProtected.ThenFunc(app.updateVenue))        // venue owner only
+	mux.Handle("POST /venue/{id}/delete", venueOwnerProtected.ThenFunc(app.deleteVenue))      // venue owner only
 
-	mux.Handle("GET /venue/{id}/edit", ownerProtected.ThenFunc(app.showUpdateVenueForm)) // owner only
-	mux.Handle("POST /venue/{id}/edit", ownerProtected.ThenFunc(app.updateVenue))        // owner only
-	mux.Handle("POST /venue/{id}/delete", ownerProtected.ThenFunc(app.deleteVenue))      // owner only
+	mux.Handle("POST /venue/{id}/images", app.limitUpload(venueOwnerUploading.ThenFunc(app.addVenueImage)))            // venue owner only
+	mux.Handle("POST /venue/{id}/images/{imageID}/caption", venueOwnerProtected.ThenFunc(app.updateVenueImageCaption)) // venue owner only
+	mux.Handle("POST /venue/{id}/images/{imageID}/move", venueOwnerProtected.ThenFunc(app.moveVenueImage))             // venue owner only
+	mux.Handle("POST /venue/{id}/images/{imageID}/cover", venueOwnerProtected.ThenFunc(app.setVenueCover))             // venue owner only
+	mux.Handle("POST /venue/{id}/images/{imageID}/delete", venueOwnerProtected.ThenFunc(app.deleteVenueImage))         // venue owner only
+
+	mux.Handle("POST /venue/{id}/hours", venueOwnerProtected.ThenFunc(app.updateVenueHours))                       // venue owner only
+	mux.Handle("POST /venue/{id}/blackouts", venueOwnerProtected.ThenFunc(app.createBlackout))                     // venue owner only
+	mux.Handle("POST /venue/{id}/blackouts/{blackoutID}/delete", venueOwnerProtected.ThenFunc(app.deleteBlackout)) // venue owner only
+
+	mux.Handle("POST /venue/{id}/calendars", venueOwnerProtected.ThenFunc(app.addCalendarSource))                      // venue owner only
+	mux.Handle("POST /venue/{id}/calendars/{sourceID}/sync", venueOwnerProtected.ThenFunc(app.syncCalendarSourceNow))  // venue owner only
+	mux.Handle("POST /venue/{id}/calendars/{sourceID}/delete", venueOwnerProtected.ThenFunc(app.deleteCalendarSource)) // venue owner only
+
+	mux.Handle("GET /owner/reservations", ownerProtected.ThenFunc(app.ownerReservations))                // owner only
+	mux.Handle("POST /owner/reservations/{id}/approve", ownerProtected.ThenFunc(app.approveReservation)) // owner only
+	mux.Handle("POST /owner/reservations/{id}/reject", ownerProtected.ThenFunc(app.rejectReservation))   // owner only
+	mux.Handle("POST /owner/reservations/{id}/no-show", ownerProtected.ThenFunc(app.markNoShow))         // owner only
 
 	mux.Handle("POST /reservation/{id}/create", userProtected.ThenFunc(app.createReservation)) // User only
+	mux.Handle("GET /reservation/{id}/quote", userProtected.ThenFunc(app.previewQuote))        // User only
 
 	mux.Handle("GET /reservations", userProtected.ThenFunc(app.showAllReservations))                 // User only
 	mux.Handle("GET /reservations/cancelled", userProtected.ThenFunc(app.showCancelledReservations)) // User only
@@ -63,7 +101,19 @@ func (app *application) routes() http.Handler {
 	mux.Handle("GET /reservations/update/{id}", userProtected.ThenFunc(app.showUpdateReservationForm)) // User only
 	mux.Handle("POST /reservations/update/{id}", userProtected.ThenFunc(app.updateReservation))        // User only
 
-	mux.Handle("POST /reservations/cancel/{id}", userProtected.ThenFunc(app.cancelReservation)) // User only
+	mux.Handle("GET /reservations/cancel/{id}", userProtected.ThenFunc(app.showCancelReservation))       // User only
+	mux.Handle("POST /reservations/cancel/{id}", userProtected.ThenFunc(app.cancelReservation))          // User only
+	mux.Handle("POST /reservations/confirm/{id}", userProtected.ThenFunc(app.confirmHold))               // User only
+	mux.Handle("GET /reservations/ics/{id}", userProtected.ThenFunc(app.downloadReservation))            // User only
+	mux.Handle("POST /reservations/reminders/{id}", userProtected.ThenFunc(app.setReservationReminders)) // User only
+
+	mux.Handle("GET /account", userProtected.ThenFunc(app.showAccount))                       // User only
+	mux.Handle("POST /account/reminders", userProtected.ThenFunc(app.updateAccountReminders)) // User only
+
+	mux.Handle("POST /venue/{id}/waitlist", userProtected.ThenFunc(app.joinWaitlist))       // User only
+	mux.Handle("GET /waitlist", userProtected.ThenFunc(app.showWaitlist))                   // User only
+	mux.Handle("POST /waitlist/{id}/claim", userProtected.ThenFunc(app.claimWaitlistOffer)) // User only
+	mux.Handle("POST /waitlist/{id}/leave", userProtected.ThenFunc(app.leaveWaitlist))      // User only
 
 	mux.Handle("POST /venue/{id}/review", userProtected.ThenFunc(app.submitReview)) // Accessible by both user and owner
 
@@ -4,11 +4,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
+// shutdownTimeout is how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 20 * time.Second
+
 func (app *application) serve() error {
 	// srv configures and starts the HTTP server with defined settings,
 	// including request handling, timeouts, and error logging.
@@ -20,6 +28,37 @@ func (app *application) serve() error {
 		WriteTimeout: 10 * time.Second,
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError), // Logs server errors
 	}
+
+	// Background jobs run until the process is asked to stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	app.startBackgroundJobs(ctx)
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		app.logger.Info("shutting down server")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(shutdownCtx)
+	}()
+
 	app.logger.Info("starting server", "addr", srv.Addr)
-	return srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem") // begins handling http requests
+	err := srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem") // begins handling http requests
+	if !errors.Is(err, http.ErrServerClosed) {
+		stop()
+		app.background.Wait()
+		return err
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		return err
+	}
+
+	// Let any job that is part way through a run finish it
+	app.background.Wait()
+	app.logger.Info("stopped server", "addr", srv.Addr)
+	return nil
 }
@@ -12,18 +12,29 @@ import (
 
 // Holds dynamic data that can be passed to HTML templates.
 type TemplateData struct {
-	Title           string
-	HeaderText      string
-	Flash           string
-	CSRFToken       string
-	Venue           *data.Venue
-	Venues          []data.Venue
-	Reservation     []data.Reservation
-	Reviews         []data.Review
-	FormErrors      map[string]string
-	FormData        map[string]string
-	IsAuthenticated bool
-	UserRole        int64
+	Title            string
+	HeaderText       string
+	Flash            string
+	CSRFToken        string
+	Venue            *data.Venue
+	Venues           []data.Venue
+	Reservation      []data.Reservation
+	Inbox            map[string][]data.Reservation
+	Reviews          []data.Review
+	Waitlist         []data.WaitlistEntry
+	CalendarSources  []data.CalendarSource
+	Calendar         *Calendar
+	Cancellation     *CancellationSummary
+	FormErrors       map[string]string
+	FormData         map[string]string
+	Metadata         data.Metadata
+	PageQuery        string
+	FeedURL          string
+	User             *data.Users
+	ReminderSchedule string
+	IsAuthenticated  bool
+	UserRole         int64
+	IsVenueOwner     bool
 }
 
 // Initializes a new TemplateData struct with default values.
@@ -35,9 +46,21 @@ func NewTemplateData(r *http.Request) *TemplateData {
 		// Flash: string,
 		Venues:          []data.Venue{},
 		Reservation:     []data.Reservation{},
+		Inbox:           map[string][]data.Reservation{},
 		Reviews:         []data.Review{},
 		FormErrors:      map[string]string{},
 		FormData:        map[string]string{},
 		IsAuthenticated: false,
+		UserRole:        userRole(r),
 	}
 }
+
+// userRole returns the role of the signed-in user, or 0 for visitors, so the
+// navigation can offer the right links
+func userRole(r *http.Request) int64 {
+	user, ok := r.Context().Value(contextKeyUser).(*data.Users)
+	if !ok {
+		return 0
+	}
+	return user.Role
+}
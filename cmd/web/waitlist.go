@@ -0,0 +1,327 @@
+// filename: waitlist.go
+// Description: Joining, leaving and claiming offers from a venue's waitlist
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/data"
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// joinWaitlist queues the customer for a slot that is already taken. The
+// booking form posts here with the same fields as a normal booking.
+func (app *application) joinWaitlist(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid venue ID", http.StatusBadRequest)
+		return
+	}
+
+	venue, err := app.venue.GetVenueByID(id)
+	if err != nil {
+		app.logger.Error("failed to fetch venue", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if venue == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.schedule.Load(venue)
+	if err != nil {
+		app.logger.Error("failed to load venue schedule", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	guestCount, err := strconv.ParseInt(r.PostFormValue("guest_count"), 10, 64)
+	if err != nil {
+		guestCount = 0
+	}
+
+	user := app.contextGetUser(r.Context())
+	startDate := r.PostFormValue("start_date")
+	reservation := &data.Reservation{
+		VenueID:    venue.ID,
+		CustomerID: user.ID,
+		StartAt:    app.parseDateTime(startDate, r.PostFormValue("start_time")),
+		EndAt:      app.parseDateTime(endDateOrStart(r.PostFormValue("end_date"), startDate), r.PostFormValue("end_time")),
+		GuestCount: guestCount,
+	}
+
+	// The slot must be one the customer could book if it were free
+	v := validator.NewValidator()
+	data.ValidateReservation(v, reservation, venue)
+	if !v.ValidData() {
+		app.renderBookingForm(w, r, http.StatusUnprocessableEntity, venue, v)
+		return
+	}
+
+	clash, err := app.reservation.FetchConflicting(reservation)
+	if err != nil {
+		app.logger.Error("failed to fetch conflicting reservation", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	offer, err := app.waitlist.OfferDuring(venue.ID, reservation.StartAt, reservation.EndAt, user.ID)
+	if err != nil {
+		app.logger.Error("failed to check waitlist offers", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if clash == nil && offer == nil {
+		app.session.Put(r, "flash", "That time is free, so there is no need to wait. Book it below.")
+		http.Redirect(w, r, fmt.Sprintf("/venue/%d", venue.ID), http.StatusSeeOther)
+		return
+	}
+
+	entry := &data.WaitlistEntry{
+		VenueID:    venue.ID,
+		CustomerID: user.ID,
+		StartAt:    reservation.StartAt,
+		EndAt:      reservation.EndAt,
+		GuestCount: reservation.GuestCount,
+	}
+
+	err = app.waitlist.Insert(entry)
+	if err != nil {
+		if errors.Is(err, data.ErrAlreadyWaitlisted) {
+			app.session.Put(r, "flash", "You are already on the waitlist for that time.")
+			http.Redirect(w, r, "/waitlist", http.StatusSeeOther)
+			return
+		}
+		app.logger.Error("failed to join waitlist", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "You're on the waitlist! If the time frees up, you'll get an offer here to claim it.")
+	http.Redirect(w, r, "/waitlist", http.StatusSeeOther)
+}
+
+// showWaitlist lists the customer's places in waitlist queues and any slots
+// they are being offered
+func (app *application) showWaitlist(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r.Context())
+
+	entries, err := app.waitlist.FetchForCustomer(user.ID)
+	if err != nil {
+		app.logger.Error("failed to get waitlist", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	tmplData := NewTemplateData(r)
+	tmplData.Title = "My Waitlist"
+	tmplData.Flash = app.session.PopString(r, "flash")
+	tmplData.IsAuthenticated = app.isAuthenticated(r)
+	for _, entry := range entries {
+		tmplData.Waitlist = append(tmplData.Waitlist, *entry)
+	}
+
+	err = app.render(w, http.StatusOK, "waitlist.tmpl", tmplData)
+	if err != nil {
+		app.logger.Error("failed to render waitlist page", "template", "waitlist.tmpl", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// claimWaitlistOffer books the slot the customer has been offered
+func (app *application) claimWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid waitlist entry ID", http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r.Context())
+
+	entry, err := app.waitlist.Get(id, user.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to fetch waitlist entry", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	venue, err := app.venue.GetVenueByID(int(entry.VenueID))
+	if err != nil || venue == nil {
+		app.logger.Error("failed to fetch venue", "id", entry.VenueID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = app.schedule.Load(venue)
+	if err != nil {
+		app.logger.Error("failed to load venue schedule", "id", venue.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The venue's rules may have changed since the customer joined the queue
+	reservation := entry.Reservation()
+	v := validator.NewValidator()
+	data.ValidateReservation(v, reservation, venue)
+	if !v.ValidData() {
+		reason := v.Errors["start_time"]
+		if reason == "" {
+			reason = "it no longer meets the venue's booking rules"
+		}
+		app.session.Put(r, "flash", "This slot can no longer be booked: "+reason+".")
+		http.Redirect(w, r, "/waitlist", http.StatusSeeOther)
+		return
+	}
+
+	_, err = app.pricing.PriceReservation(reservation, venue)
+	if err != nil {
+		app.session.Put(r, "flash", "This slot can no longer be booked: its price is too large to accept.")
+		http.Redirect(w, r, "/waitlist", http.StatusSeeOther)
+		return
+	}
+
+	err = app.waitlist.Claim(entry.ID, reservation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.session.Put(r, "flash", "There is no offer to claim for that slot.")
+		case errors.Is(err, data.ErrOfferExpired):
+			app.session.Put(r, "flash", "Sorry, that offer has expired and has been passed on.")
+		case errors.Is(err, data.ErrReservationConflict):
+			app.session.Put(r, "flash", "Sorry, that slot has been taken after all.")
+		default:
+			app.logger.Error("failed to claim waitlist offer", "id", entry.ID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/waitlist", http.StatusSeeOther)
+		return
+	}
+
+	if reservation.IsPending() {
+		app.session.Put(r, "flash", "Slot claimed! The venue owner will review the booking shortly.")
+		http.Redirect(w, r, "/reservations?status=3", http.StatusSeeOther)
+		return
+	}
+
+	app.session.Put(r, "flash", "Slot claimed! Your reservation is confirmed.")
+	http.Redirect(w, r, "/reservations", http.StatusSeeOther)
+}
+
+// leaveWaitlist takes the customer out of a queue. A slot they were being
+// offered goes to the next customer in line.
+func (app *application) leaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid waitlist entry ID", http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r.Context())
+
+	entry, err := app.waitlist.Leave(id, user.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to leave waitlist", "id", id, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if entry.IsOffered() {
+		app.offerFreedSlot(entry.VenueID, entry.StartAt, entry.EndAt)
+	}
+
+	app.session.Put(r, "flash", "You have left the waitlist.")
+	http.Redirect(w, r, "/waitlist", http.StatusSeeOther)
+}
+
+// offerFreedSlot offers time that has just come free to the next customer on
+// the venue's waitlist. Failures are logged rather than returned because the
+// change that freed the time has already gone through.
+func (app *application) offerFreedSlot(venueID int64, start, end time.Time) {
+	entry, err := app.waitlist.OfferNext(venueID, start, end, app.waitlistOfferTTL)
+	if err != nil {
+		app.logger.Error("failed to offer freed slot", "venueID", venueID, "error", err)
+		return
+	}
+	if entry != nil {
+		app.logger.Info("offered freed slot to waitlist", "venueID", venueID, "entryID", entry.ID, "expires", entry.OfferExpiresAt)
+	}
+}
+
+// offerFreedReservation passes the slot of a reservation that has just been
+// cancelled or rejected on to the waitlist
+func (app *application) offerFreedReservation(reservationID int64) {
+	reservation, err := app.reservation.FetchByID(int(reservationID))
+	if err != nil {
+		app.logger.Error("failed to fetch freed reservation", "id", reservationID, "error", err)
+		return
+	}
+	app.offerFreedSlot(reservation.VenueID, reservation.StartAt, reservation.EndAt)
+}
+
+// checkWaitlistOffers records an error on v when the reservation's time is
+// being held for a customer on the waitlist
+func (app *application) checkWaitlistOffers(reservation *data.Reservation, v *validator.Validator) error {
+	offer, err := app.waitlist.OfferDuring(reservation.VenueID, reservation.StartAt, reservation.EndAt, reservation.CustomerID)
+	if err != nil {
+		return err
+	}
+	if offer != nil {
+		v.AddError("start_time", "this time is being offered to a customer on the waitlist until "+offer.OfferExpiresAt.Format("Jan 02, 2006 15:04"))
+	}
+	return nil
+}
+
+// checkSeriesWaitlistOffers does what checkWaitlistOffers does for every
+// occurrence of a series, naming the first one whose time is being offered
+func (app *application) checkSeriesWaitlistOffers(occurrences []*data.Reservation, v *validator.Validator) error {
+	for _, o := range occurrences {
+		offer, err := app.waitlist.OfferDuring(o.VenueID, o.StartAt, o.EndAt, o.CustomerID)
+		if err != nil {
+			return err
+		}
+		if offer != nil {
+			v.AddError("start_time", "the booking on "+o.StartAt.Format("Jan 02, 2006")+
+				" clashes with time offered to a customer on the waitlist until "+offer.OfferExpiresAt.Format("Jan 02, 2006 15:04"))
+			return nil
+		}
+	}
+	return nil
+}
+
+// expireWaitlistOffers closes offers that have run out and passes each slot
+// on to the next customer in line
+func (app *application) expireWaitlistOffers() error {
+	expired, err := app.waitlist.ExpireOffers()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range expired {
+		app.offerFreedSlot(entry.VenueID, entry.StartAt, entry.EndAt)
+	}
+
+	if len(expired) > 0 {
+		app.logger.Info("expired waitlist offers", "count", len(expired))
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Filename: internal/data/availability.go
+// Description: Free and busy time for a venue over a date range
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Kinds of busy interval. Bookings are reported without any detail about
+// who made them.
+const (
+	BusyBooked   = "booked"
+	BusyBuffer   = "buffer"
+	BusyBlackout = "blackout"
+	BusyClosed   = "closed"
+)
+
+// MaxAvailabilityRange is the longest range an availability request may cover
+const MaxAvailabilityRange = 92 * 24 * time.Hour
+
+// Interval is a span of time, half-open: it includes Start but not End
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Kind  string    `json:"kind,omitempty"`
+}
+
+// Label describes a busy interval for display
+func (i Interval) Label() string {
+	switch i.Kind {
+	case BusyBooked:
+		return "Booked"
+	case BusyBuffer:
+		return "Turnover"
+	case BusyBlackout:
+		return "Unavailable"
+	case BusyClosed:
+		return "Closed"
+	default:
+		return "Free"
+	}
+}
+
+// Clock formats the interval as times of day, e.g. "10:00-12:00". It is
+// meant for intervals within one day, so an end at midnight shows as 24:00.
+func (i Interval) Clock() string {
+	end := i.End.Format("15:04")
+	if end == "00:00" && i.End.After(i.Start) {
+		end = "24:00"
+	}
+	return i.Start.Format("15:04") + "-" + end
+}
+
+// Availability is a venue's free and busy time between From and To
+type Availability struct {
+	VenueID int64      `json:"venue_id"`
+	From    time.Time  `json:"from"`
+	To      time.Time  `json:"to"`
+	Busy    []Interval `json:"busy"`
+	Free    []Interval `json:"free"`
+}
+
+// BusyBetween returns the busy intervals that overlap start to end, clipped
+// to it
+func (a *Availability) BusyBetween(start, end time.Time) []Interval {
+	var busy []Interval
+	for _, b := range a.Busy {
+		if b.Start.Before(end) && start.Before(b.End) {
+			busy = append(busy, Interval{Start: maxTime(b.Start, start), End: minTime(b.End, end), Kind: b.Kind})
+		}
+	}
+	return busy
+}
+
+// IsFreeBetween reports whether any free time falls between start and end
+func (a *Availability) IsFreeBetween(start, end time.Time) bool {
+	for _, f := range a.Free {
+		if f.Start.Before(end) && start.Before(f.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Availability works out when the venue is free between from and to. Active
+// bookings and holds with their setup and cleanup buffers, blackouts and hours outside
+// the venue's opening times are busy;
+// everything else is free. The venue's schedule must already be loaded.
+func (m *ReservationModel) Availability(venue *Venue, from, to time.Time) (*Availability, error) {
+	booked, err := m.bookedIntervals(venue.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	busy := append(booked, closedIntervals(venue, from, to)...)
+	for _, b := range venue.Blackouts {
+		if b.Overlaps(from, to) {
+			busy = append(busy, Interval{Start: maxTime(b.StartAt.UTC(), from), End: minTime(b.EndAt.UTC(), to), Kind: BusyBlackout})
+		}
+	}
+
+	sort.Slice(busy, func(i, j int) bool {
+		return busy[i].Start.Before(busy[j].Start)
+	})
+
+	return &Availability{
+		VenueID: venue.ID,
+		From:    from,
+		To:      to,
+		Busy:    busy,
+		Free:    freeIntervals(busy, from, to),
+	}, nil
+}
+
+// bookedIntervals retrieves the time taken by the venue's pending, confirmed
+// and held reservations between from and to. Setup and cleanup time either
+// side of a booking comes back as separate buffer intervals.
+func (m *ReservationModel) bookedIntervals(venueID int64, from, to time.Time) ([]Interval, error) {
+	query := `
+		SELECT start_at, end_at, blocked_from, blocked_until
+		FROM reservation
+		WHERE venue = $1
+		AND status IN (1, 3, 7)
+		AND blocked_from < $3 AND blocked_until > $2
+		ORDER BY blocked_from`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var intervals []Interval
+	add := func(start, end time.Time, kind string) {
+		start, end = maxTime(start.UTC(), from), minTime(end.UTC(), to)
+		if start.Before(end) {
+			intervals = append(intervals, Interval{Start: start, End: end, Kind: kind})
+		}
+	}
+
+	for rows.Next() {
+		var start, end, blockedFrom, blockedUntil time.Time
+		err := rows.Scan(&start, &end, &blockedFrom, &blockedUntil)
+		if err != nil {
+			return nil, err
+		}
+		add(blockedFrom, start, BusyBuffer)
+		add(start, end, BusyBooked)
+		add(end, blockedUntil, BusyBuffer)
+	}
+
+	return intervals, rows.Err()
+}
+
+// closedIntervals returns the time between from and to that falls outside
+// the venue's opening hours
+func closedIntervals(venue *Venue, from, to time.Time) []Interval {
+	if len(venue.Hours) == 0 {
+		return nil
+	}
+
+	var closed []Interval
+	add := func(start, end time.Time) {
+		start, end = maxTime(start, from), minTime(end, to)
+		if start.Before(end) {
+			closed = append(closed, Interval{Start: start, End: end, Kind: BusyClosed})
+		}
+	}
+
+	for day := dayStart(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		h, open := venue.HoursFor(day.Weekday())
+		if !open {
+			add(day, next)
+			continue
+		}
+		add(day, day.Add(time.Duration(h.Opens)*time.Minute))
+		add(day.Add(time.Duration(h.Closes)*time.Minute), next)
+	}
+
+	return closed
+}
+
+// freeIntervals returns the gaps between from and to that none of the busy
+// intervals cover. busy must be sorted by start.
+func freeIntervals(busy []Interval, from, to time.Time) []Interval {
+	var free []Interval
+	cursor := from
+	for _, b := range busy {
+		if b.Start.After(cursor) {
+			free = append(free, Interval{Start: cursor, End: b.Start})
+		}
+		if b.End.After(cursor) {
+			cursor = b.End
+		}
+	}
+	if cursor.Before(to) {
+		free = append(free, Interval{Start: cursor, End: to})
+	}
+	return free
+}
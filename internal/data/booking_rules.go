@@ -0,0 +1,101 @@
+// Filename: internal/data/booking_rules.go
+// Description: Per-venue limits on how long and how far ahead bookings may be
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// Upper bounds for the booking rules an owner can set
+const (
+	maxLeadHours   = 365 * 24
+	maxAdvanceDays = 2 * 365
+)
+
+// HasBookingRules reports whether the venue limits bookings in any way beyond
+// its opening hours
+func (venue *Venue) HasBookingRules() bool {
+	return venue.MinDuration > 0 || venue.MaxDuration > 0 || venue.SlotMinutes > 0 ||
+		venue.LeadHours > 0 || venue.AdvanceDays > 0
+}
+
+// BookingWindowEnd returns the latest time a booking made at now may start,
+// and false when the venue takes bookings any distance ahead
+func (venue *Venue) BookingWindowEnd(now time.Time) (time.Time, bool) {
+	if venue.AdvanceDays == 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, int(venue.AdvanceDays)), true
+}
+
+// checkBookingRules records a field error for each of the venue's booking
+// rules that start to end breaks when booked at now
+func (venue *Venue) checkBookingRules(v *validator.Validator, start, end, now time.Time) {
+	minutes := int64(end.Sub(start) / time.Minute)
+
+	if venue.MinDuration > 0 {
+		v.Check(minutes >= venue.MinDuration, "end_time", "booking must be at least "+formatDuration(venue.MinDuration))
+	}
+	if venue.MaxDuration > 0 {
+		v.Check(minutes <= venue.MaxDuration, "end_time", "booking must not be longer than "+formatDuration(venue.MaxDuration))
+	}
+
+	if slot := venue.SlotMinutes; slot > 0 {
+		sinceMidnight := int64(start.Sub(dayStart(start)) / time.Minute)
+		v.Check(sinceMidnight%slot == 0 && start.Second() == 0, "start_time", fmt.Sprintf("must be on a %d-minute boundary", slot))
+		v.Check(minutes%slot == 0, "end_time", fmt.Sprintf("booking length must be a multiple of %d minutes", slot))
+	}
+
+	if venue.LeadHours > 0 {
+		earliest := now.Add(time.Duration(venue.LeadHours) * time.Hour)
+		v.Check(!start.Before(earliest), "start_time", "must be booked at least "+formatDuration(venue.LeadHours*60)+" in advance")
+	}
+
+	if latest, limited := venue.BookingWindowEnd(now); limited {
+		v.Check(!start.After(latest), "start_time", fmt.Sprintf("must not be more than %d days ahead", venue.AdvanceDays))
+	}
+}
+
+// formatDuration writes a number of minutes the way a person would, e.g.
+// "90 minutes" becomes "1 hour 30 minutes"
+func formatDuration(minutes int64) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	var parts []string
+	if days := minutes / minutesPerDay; days > 0 && minutes%minutesPerDay == 0 {
+		return plural(days, "day")
+	}
+	if hours := minutes / 60; hours > 0 {
+		parts = append(parts, plural(hours, "hour"))
+	}
+	if rest := minutes % 60; rest > 0 || len(parts) == 0 {
+		parts = append(parts, plural(rest, "minute"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ValidateBookingRules validates the booking rules on the venue form
+func ValidateBookingRules(v *validator.Validator, venue *Venue) {
+	v.Check(venue.MinDuration >= 0 && venue.MinDuration <= 7*minutesPerDay, "min_duration", "must be between 0 and 10080 minutes")
+	v.Check(venue.MaxDuration >= 0 && venue.MaxDuration <= 7*minutesPerDay, "max_duration", "must be between 0 and 10080 minutes")
+	if venue.MaxDuration > 0 {
+		v.Check(venue.MaxDuration >= venue.MinDuration, "max_duration", "must not be less than the minimum duration")
+	}
+
+	v.Check(venue.SlotMinutes >= 0 && venue.SlotMinutes <= minutesPerDay, "slot_minutes", "must be between 0 and 1440 minutes")
+	if venue.SlotMinutes > 0 {
+		v.Check(minutesPerDay%venue.SlotMinutes == 0, "slot_minutes", "must divide evenly into a day, e.g. 15, 30 or 60")
+	}
+
+	v.Check(venue.LeadHours >= 0 && venue.LeadHours <= maxLeadHours, "lead_hours", fmt.Sprintf("must be between 0 and %d hours", maxLeadHours))
+	v.Check(venue.AdvanceDays >= 0 && venue.AdvanceDays <= maxAdvanceDays, "advance_days", fmt.Sprintf("must be between 0 and %d days", maxAdvanceDays))
+}
@@ -0,0 +1,257 @@
+// Filename: internal/data/calendar_recurrence.go
+// Description: Expanding repeating events from imported calendars
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/ical"
+)
+
+// MaxImportedBlackouts is the most blackouts one calendar may produce once
+// its repeating events are expanded
+const MaxImportedBlackouts = 10000
+
+// maxExpandedOccurrences caps how many occurrences are worked out for one
+// calendar, past ones included, so a daily event starting centuries ago
+// can't keep a sync busy
+const maxExpandedOccurrences = 100000
+
+// icalWeekdays maps the two-letter days used by BYDAY and WKST
+var icalWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// importRule is an RRULE from an imported calendar, in the terms of a
+// Recurrence. Count and Until are kept apart from it because they apply to
+// the occurrences on all of days together, and Until is an exact time.
+type importRule struct {
+	Recurrence
+	count     int
+	until     time.Time
+	days      []time.Weekday // weekly: the days it repeats on, daily: the days it is kept to
+	weekStart time.Weekday
+}
+
+// parseImportRule reads an RRULE value for an event starting at start. Only
+// rules a Recurrence can follow are accepted: daily, weekly, monthly or
+// yearly, optionally on a list of weekdays for daily and weekly rules. Other
+// rules return an error naming the part that can't be followed, since
+// blocking only some of the occurrences would silently leave the rest
+// bookable.
+func parseImportRule(rule string, start time.Time) (importRule, error) {
+	r := importRule{Recurrence: Recurrence{Interval: 1}, weekStart: time.Monday}
+	freq := ""
+	for _, part := range strings.Split(rule, ";") {
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "FREQ":
+			freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("INTERVAL=%s is not a valid interval", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("COUNT=%s is not a valid count", value)
+			}
+			r.count = n
+		case "UNTIL":
+			until := parseUntil(value, start.Location())
+			if until.IsZero() {
+				return r, fmt.Errorf("UNTIL=%s is not a valid date", value)
+			}
+			r.until = until
+		case "WKST":
+			day, ok := icalWeekdays[value]
+			if !ok {
+				return r, fmt.Errorf("WKST=%s is not a day", value)
+			}
+			r.weekStart = day
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				day, ok := icalWeekdays[d]
+				if !ok {
+					return r, fmt.Errorf("BYDAY=%s is not supported", value)
+				}
+				r.days = append(r.days, day)
+			}
+		case "BYMONTHDAY":
+			// Only the day the event already falls on, which changes nothing
+			if value != strconv.Itoa(start.Day()) {
+				return r, fmt.Errorf("BYMONTHDAY=%s is not supported", value)
+			}
+		case "BYMONTH":
+			if value != strconv.Itoa(int(start.Month())) {
+				return r, fmt.Errorf("BYMONTH=%s is not supported", value)
+			}
+		default:
+			return r, fmt.Errorf("%s is not supported", part)
+		}
+	}
+
+	switch freq {
+	case "DAILY":
+		r.Frequency = FrequencyDaily
+	case "WEEKLY":
+		r.Frequency = FrequencyWeekly
+	case "MONTHLY":
+		r.Frequency = FrequencyMonthly
+	case "YEARLY":
+		// A year is twelve months, which also skips 29 February in other
+		// years as RFC 5545 asks
+		r.Frequency = FrequencyMonthly
+		r.Interval *= 12
+	default:
+		return r, fmt.Errorf("FREQ=%s is not supported", freq)
+	}
+	if len(r.days) > 0 && r.Frequency == FrequencyMonthly {
+		return r, fmt.Errorf("BYDAY is not supported on FREQ=%s", freq)
+	}
+
+	return r, nil
+}
+
+// parseUntil reads an UNTIL value. A date means the end of that day, and a
+// date-time without a Z is in the event's own zone, loc.
+func parseUntil(value string, loc *time.Location) time.Time {
+	layout := "20060102T150405"
+	switch {
+	case len(value) == 8:
+		t, err := time.ParseInLocation("20060102", value, loc)
+		if err != nil {
+			return time.Time{}
+		}
+		return t.AddDate(0, 0, 1).Add(-time.Second)
+	case strings.HasSuffix(value, "Z"):
+		layout = "20060102T150405Z"
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// occurrences lists when each occurrence of the event starts, up to
+// horizon: the first start and those its rule produces. It reports false
+// when working them out would take more than limit steps.
+func (rule importRule) occurrences(e ical.Event, horizon time.Time, limit int) ([]time.Time, bool) {
+	if !rule.until.IsZero() && rule.until.Before(horizon) {
+		horizon = rule.until
+	}
+
+	var starts []time.Time
+	steps := 0
+	switch {
+	case rule.Frequency == FrequencyWeekly && len(rule.days) > 0:
+		// One weekly series for each day, starting in the week of the first
+		// occurrence
+		weekStart := e.Start.AddDate(0, 0, -int((e.Start.Weekday()-rule.weekStart+7)%7))
+		for _, day := range rule.days {
+			first := weekStart.AddDate(0, 0, int((day-rule.weekStart+7)%7))
+			series := rule.starts(first, horizon, limit+1)
+			steps += len(series)
+			for _, start := range series {
+				if !start.Before(e.Start) {
+					starts = append(starts, start)
+				}
+			}
+		}
+	case len(rule.days) > 0:
+		series := rule.starts(e.Start, horizon, limit+1)
+		steps = len(series)
+		for _, start := range series {
+			for _, day := range rule.days {
+				if start.Weekday() == day {
+					starts = append(starts, start)
+					break
+				}
+			}
+		}
+	default:
+		starts = rule.starts(e.Start, horizon, limit+1)
+		steps = len(starts)
+	}
+	if steps > limit {
+		return nil, false
+	}
+
+	// The first start always counts, even when the rule wouldn't produce it
+	if len(starts) == 0 || !starts[0].Equal(e.Start) {
+		starts = append([]time.Time{e.Start}, starts...)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	if rule.count != 0 && len(starts) > rule.count {
+		starts = starts[:rule.count]
+	}
+	return starts, true
+}
+
+// expandEvent lists when each occurrence of e starts, up to horizon, and
+// how many steps that took out of the budget. Starts in skip are left out,
+// as are those on EXDATEs. It fails for rules it can't follow, or that would
+// take more steps than budget.
+func expandEvent(e ical.Event, horizon time.Time, skip map[int64]bool, budget int) ([]time.Time, int, error) {
+	name := e.Summary
+	if name == "" {
+		name = e.UID
+	}
+
+	starts := []time.Time{e.Start}
+	if e.RRule != "" {
+		rule, err := parseImportRule(e.RRule, e.Start)
+		if err != nil {
+			return nil, 0, fmt.Errorf("the repeating event %q can't be imported: %w", name, err)
+		}
+		var ok bool
+		starts, ok = rule.occurrences(e, horizon, budget)
+		if !ok {
+			return nil, 0, fmt.Errorf("the repeating event %q has too many occurrences to import", name)
+		}
+	}
+	for _, d := range e.RDates {
+		if !d.After(horizon) {
+			starts = append(starts, d)
+		}
+	}
+	used := len(starts)
+
+	var kept []time.Time
+	for _, start := range starts {
+		if skip[start.Unix()] || excluded(start, e.ExDates) {
+			continue
+		}
+		kept = append(kept, start)
+	}
+	return kept, used, nil
+}
+
+// excluded reports whether start is one of the EXDATEs. An EXDATE given as a
+// date, which parses to midnight UTC, leaves out any occurrence on that day.
+func excluded(start time.Time, exDates []time.Time) bool {
+	for _, ex := range exDates {
+		if ex.Equal(start) {
+			return true
+		}
+		if ex.Location() == time.UTC && ex.Equal(ex.Truncate(24*time.Hour)) &&
+			start.Format("20060102") == ex.Format("20060102") {
+			return true
+		}
+	}
+	return false
+}
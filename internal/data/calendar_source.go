@@ -0,0 +1,335 @@
+// Filename: internal/data/calendar_source.go
+// Description: External calendars imported as venue blackouts
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/ical"
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// Sync statuses of a calendar source
+const (
+	SyncPending = "pending"
+	SyncOK      = "ok"
+	SyncError   = "error"
+)
+
+// MaxCalendarSize is the largest calendar file that is imported, whether
+// uploaded or fetched
+const MaxCalendarSize = 5 << 20
+
+// ImportHorizon is how far ahead imported events are kept. Bookings can't be
+// made that far out, so later events would only take up space.
+const ImportHorizon = 2 * 365 * 24 * time.Hour
+
+// CalendarSource is an external iCalendar whose events block time at a
+// venue. It is fetched from URL on every sync, or read from Content when the
+// owner uploaded a file.
+type CalendarSource struct {
+	ID           int64     `json:"id"`
+	VenueID      int64     `json:"venue_id"`
+	Name         string    `json:"name"`
+	URL          string    `json:"url,omitempty"`
+	Content      string    `json:"-"`
+	Status       string    `json:"sync_status"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastSyncedAt time.Time `json:"last_synced_at"`
+	EventCount   int64     `json:"event_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// IsUpload reports whether the source is an uploaded file rather than a URL
+func (s CalendarSource) IsUpload() bool {
+	return s.URL == ""
+}
+
+// StatusLabel describes the last sync for display
+func (s CalendarSource) StatusLabel() string {
+	switch s.Status {
+	case SyncOK:
+		return "Synced"
+	case SyncError:
+		return "Sync failed"
+	default:
+		return "Waiting for first sync"
+	}
+}
+
+// ValidateCalendarSource validates a calendar added on the venue edit page
+func ValidateCalendarSource(v *validator.Validator, source *CalendarSource) {
+	v.Check(validator.NotBlank(source.Name), "calendar_name", "must be provided")
+	v.Check(validator.MaxLength(source.Name, 100), "calendar_name", "must not be more than 100 characters long")
+
+	switch {
+	case source.URL == "" && source.Content == "":
+		v.AddError("calendar_url", "enter a calendar URL or upload an .ics file")
+	case source.URL != "" && source.Content != "":
+		v.AddError("calendar_url", "enter a URL or upload a file, not both")
+	case source.URL != "":
+		u, err := url.Parse(source.URL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"calendar_url", "must be an http or https URL")
+	}
+	v.Check(len(source.Content) <= MaxCalendarSize, "calendar_file", "must not be larger than 5 MB")
+}
+
+// ImportedBlackouts turns a calendar's events into blackouts for the source's
+// venue. Repeating events become one blackout per occurrence. An event that
+// changes or cancels one occurrence of a repeating event replaces it.
+// Cancelled events, events marked free, and occurrences that have ended or
+// start beyond ImportHorizon are left out. It fails when a repeating event
+// uses a rule that can't be followed, or the calendar produces more than
+// MaxImportedBlackouts, rather than import only part of it.
+func ImportedBlackouts(source *CalendarSource, events []ical.Event, now time.Time) ([]Blackout, error) {
+	horizon := now.Add(ImportHorizon)
+
+	// Occurrences replaced by other events, by UID and start time
+	replaced := map[string]map[int64]bool{}
+	for _, e := range events {
+		if e.RecurrenceID.IsZero() {
+			continue
+		}
+		if replaced[e.UID] == nil {
+			replaced[e.UID] = map[int64]bool{}
+		}
+		replaced[e.UID][e.RecurrenceID.Unix()] = true
+	}
+
+	var blackouts []Blackout
+	budget := maxExpandedOccurrences
+	for _, e := range events {
+		switch {
+		case e.Status == ical.StatusCancelled, e.Transparent:
+			continue
+		case !e.End.After(e.Start), e.Start.After(horizon):
+			continue
+		}
+
+		starts := []time.Time{e.Start}
+		if e.Repeats() && e.RecurrenceID.IsZero() {
+			var used int
+			var err error
+			starts, used, err = expandEvent(e, horizon, replaced[e.UID], budget)
+			if err != nil {
+				return nil, err
+			}
+			budget -= used
+		}
+
+		duration := e.End.Sub(e.Start)
+		for _, start := range starts {
+			end := start.Add(duration)
+			if !end.After(now) || start.After(horizon) {
+				continue
+			}
+			if len(blackouts) == MaxImportedBlackouts {
+				return nil, fmt.Errorf("the calendar has more than %d upcoming events", MaxImportedBlackouts)
+			}
+			blackouts = append(blackouts, Blackout{
+				VenueID:  source.VenueID,
+				StartAt:  start,
+				EndAt:    end,
+				Reason:   source.Name,
+				SourceID: source.ID,
+			})
+		}
+	}
+	return blackouts, nil
+}
+
+// CalendarSourceModel holds the database connection for calendar sources
+type CalendarSourceModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a calendar source to a venue
+func (m *CalendarSourceModel) Insert(source *CalendarSource) error {
+	query := `
+		INSERT INTO venue_calendar_source (venue, name, url, content)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, sync_status, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, source.VenueID, source.Name, source.URL, source.Content).
+		Scan(&source.ID, &source.Status, &source.CreatedAt)
+}
+
+// GetForVenue retrieves the venue's calendar sources, without the contents
+// of uploaded files
+func (m *CalendarSourceModel) GetForVenue(venueID int64) ([]*CalendarSource, error) {
+	query := `
+		SELECT id, venue, name, url, sync_status, last_error, last_synced_at, event_count, created_at
+		FROM venue_calendar_source
+		WHERE venue = $1
+		ORDER BY created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []*CalendarSource
+	for rows.Next() {
+		s := &CalendarSource{}
+		var synced sql.NullTime
+		err := rows.Scan(&s.ID, &s.VenueID, &s.Name, &s.URL, &s.Status, &s.LastError, &synced, &s.EventCount, &s.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		s.LastSyncedAt = synced.Time
+		sources = append(sources, s)
+	}
+
+	return sources, rows.Err()
+}
+
+// Get retrieves one of the venue's calendar sources, ready to sync
+func (m *CalendarSourceModel) Get(sourceID, venueID int64) (*CalendarSource, error) {
+	query := `
+		SELECT id, venue, name, url, content, sync_status, last_error, last_synced_at, event_count, created_at
+		FROM venue_calendar_source
+		WHERE id = $1 AND venue = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	s := &CalendarSource{}
+	var synced sql.NullTime
+	err := m.DB.QueryRowContext(ctx, query, sourceID, venueID).Scan(
+		&s.ID, &s.VenueID, &s.Name, &s.URL, &s.Content, &s.Status, &s.LastError, &synced, &s.EventCount, &s.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	s.LastSyncedAt = synced.Time
+
+	return s, nil
+}
+
+// FetchDue retrieves the sources that have not been synced since before,
+// oldest first, for the sync job
+func (m *CalendarSourceModel) FetchDue(before time.Time) ([]*CalendarSource, error) {
+	query := `
+		SELECT id, venue, name, url, content
+		FROM venue_calendar_source
+		WHERE last_synced_at IS NULL OR last_synced_at < $1
+		ORDER BY last_synced_at NULLS FIRST`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []*CalendarSource
+	for rows.Next() {
+		s := &CalendarSource{}
+		err := rows.Scan(&s.ID, &s.VenueID, &s.Name, &s.URL, &s.Content)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+
+	return sources, rows.Err()
+}
+
+// SaveSync replaces the source's blackouts with the ones from its latest sync
+// and marks the sync successful
+func (m *CalendarSourceModel) SaveSync(source *CalendarSource, blackouts []Blackout) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM venue_blackout WHERE source = $1`, source.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range blackouts {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO venue_blackout (venue, start_at, end_at, reason, source) VALUES ($1, $2, $3, $4, $5)`,
+			b.VenueID, b.StartAt, b.EndAt, b.Reason, source.ID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE venue_calendar_source
+		SET sync_status = $1, last_error = '', last_synced_at = NOW(), event_count = $2
+		WHERE id = $3`
+
+	_, err = tx.ExecContext(ctx, query, SyncOK, len(blackouts), source.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveSyncError records why the source's latest sync failed. The blackouts
+// from its last successful sync stay in place.
+func (m *CalendarSourceModel) SaveSyncError(source *CalendarSource, syncErr error) error {
+	query := `
+		UPDATE venue_calendar_source
+		SET sync_status = $1, last_error = $2, last_synced_at = NOW()
+		WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, SyncError, syncErr.Error(), source.ID)
+	return err
+}
+
+// Delete removes one of the venue's calendar sources along with the
+// blackouts it created
+func (m *CalendarSourceModel) Delete(sourceID, venueID int64) error {
+	query := `
+		DELETE FROM venue_calendar_source
+		WHERE id = $1 AND venue = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, sourceID, venueID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/ical"
+)
+
+func TestImportedBlackouts(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// at is the given hour on the day d days from now
+	at := func(d, hour int) time.Time {
+		return now.AddDate(0, 0, d).Truncate(24 * time.Hour).Add(time.Duration(hour) * time.Hour)
+	}
+	event := func(uid string, d, from, to int) ical.Event {
+		return ical.Event{UID: uid, Summary: uid, Start: at(d, from), End: at(d, to)}
+	}
+	with := func(e ical.Event, change func(*ical.Event)) ical.Event {
+		change(&e)
+		return e
+	}
+
+	var many []ical.Event
+	for i := 0; i <= MaxImportedBlackouts; i++ {
+		many = append(many, event(fmt.Sprintf("event-%d", i), 1+i%700, 9, 10))
+	}
+
+	tests := []struct {
+		name   string
+		events []ical.Event
+		want   []string // "day from-to" of each blackout, days counted from now
+		err    string
+	}{
+		{
+			name:   "single event",
+			events: []ical.Event{event("party", 3, 18, 23)},
+			want:   []string{"3 18-23"},
+		},
+		{
+			name: "cancelled and free events",
+			events: []ical.Event{
+				with(event("cancelled", 3, 9, 10), func(e *ical.Event) { e.Status = ical.StatusCancelled }),
+				with(event("free", 4, 9, 10), func(e *ical.Event) { e.Transparent = true }),
+				with(event("tentative", 5, 9, 10), func(e *ical.Event) { e.Status = ical.StatusTentative }),
+			},
+			want: []string{"5 9-10"},
+		},
+		{
+			name: "ended, empty and beyond the horizon",
+			events: []ical.Event{
+				event("yesterday", -1, 9, 10),
+				event("earlier today", 0, 9, 11),
+				event("empty", 3, 9, 9),
+				event("backwards", 3, 10, 9),
+				event("too far", 2*365+1, 9, 10),
+			},
+		},
+		{
+			name:   "still running",
+			events: []ical.Event{event("running", 0, 11, 14)},
+			want:   []string{"0 11-14"},
+		},
+		{
+			name: "weekly on two days with an exception",
+			events: []ical.Event{with(event("class", 1, 18, 20), func(e *ical.Event) { // a Monday
+				e.RRule = "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=5"
+				e.ExDates = []time.Time{at(3, 18)}
+			})},
+			want: []string{"1 18-20", "8 18-20", "10 18-20", "15 18-20"},
+		},
+		{
+			name: "repeating event that started in the past",
+			events: []ical.Event{with(event("standup", -3, 9, 10), func(e *ical.Event) {
+				e.RRule = "FREQ=DAILY;COUNT=5"
+			})},
+			want: []string{"1 9-10"},
+		},
+		{
+			name: "moved and cancelled occurrences",
+			events: []ical.Event{
+				with(event("class", 1, 18, 20), func(e *ical.Event) { e.RRule = "FREQ=WEEKLY;COUNT=3" }),
+				with(event("class", 9, 19, 21), func(e *ical.Event) { e.RecurrenceID = at(8, 18) }),
+				with(event("class", 15, 18, 20), func(e *ical.Event) {
+					e.RecurrenceID = at(15, 18)
+					e.Status = ical.StatusCancelled
+				}),
+			},
+			want: []string{"1 18-20", "9 19-21"},
+		},
+		{
+			name: "extra dates",
+			events: []ical.Event{with(event("fair", 2, 8, 17), func(e *ical.Event) {
+				e.RDates = []time.Time{at(20, 8), at(2*365+5, 8)}
+			})},
+			want: []string{"2 8-17", "20 8-17"},
+		},
+		{
+			name: "rule that can't be followed",
+			events: []ical.Event{with(event("market", 1, 8, 12), func(e *ical.Event) {
+				e.RRule = "FREQ=MONTHLY;BYDAY=1SA"
+			})},
+			err: `the repeating event "market" can't be imported: BYDAY=1SA is not supported`,
+		},
+		{
+			name: "too many occurrences",
+			events: []ical.Event{with(event("ancient", 0, 9, 10), func(e *ical.Event) {
+				e.Start = e.Start.AddDate(-300, 0, 0)
+				e.End = e.End.AddDate(-300, 0, 0)
+				e.RRule = "FREQ=DAILY"
+			})},
+			err: `the repeating event "ancient" has too many occurrences to import`,
+		},
+		{
+			name:   "too many upcoming events",
+			events: many,
+			err:    "the calendar has more than 10000 upcoming events",
+		},
+	}
+
+	source := &CalendarSource{ID: 4, VenueID: 7, Name: "Owner's calendar"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blackouts, err := ImportedBlackouts(source, tt.events, now)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("ImportedBlackouts = %d blackouts, %v; want error %q", len(blackouts), err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, b := range blackouts {
+				d := int(b.StartAt.Sub(at(0, 0)) / (24 * time.Hour))
+				got = append(got, fmt.Sprintf("%d %d-%d", d, b.StartAt.Hour(), b.EndAt.Hour()))
+				if b.VenueID != 7 || b.SourceID != 4 || b.Reason != "Owner's calendar" {
+					t.Errorf("blackout = %+v; want the source's venue, ID and name", b)
+				}
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Fatalf("blackouts = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Filename: internal/data/cancellation.go
+// Description: Venue cancellation policies and the refunds they give
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+var ErrInvalidRefundTiers = errors.New("models: invalid refund tiers")
+
+// Cancellation policies a venue can choose from
+const (
+	PolicyFlexible = "flexible"
+	PolicyModerate = "moderate"
+	PolicyStrict   = "strict"
+	PolicyCustom   = "custom"
+)
+
+// RefundTier refunds Percent of the total when a booking is cancelled at
+// least Hours before it starts
+type RefundTier struct {
+	Hours   int64 `json:"hours"`
+	Percent int64 `json:"percent"`
+}
+
+// String formats the tier the way the venue form takes it, e.g. "7d:100"
+func (t RefundTier) String() string {
+	if t.Hours%24 == 0 {
+		return fmt.Sprintf("%dd:%d", t.Hours/24, t.Percent)
+	}
+	return fmt.Sprintf("%dh:%d", t.Hours, t.Percent)
+}
+
+// CancellationPolicy is a set of refund tiers, most notice first. Cancelling
+// with less notice than the last tier refunds nothing.
+type CancellationPolicy struct {
+	Name  string       `json:"name"`
+	Tiers []RefundTier `json:"tiers"`
+}
+
+// presetPolicies are the ready-made policies owners can pick
+var presetPolicies = map[string][]RefundTier{
+	PolicyFlexible: {{Hours: 24, Percent: 100}},
+	PolicyModerate: {{Hours: 5 * 24, Percent: 100}, {Hours: 24, Percent: 50}},
+	PolicyStrict:   {{Hours: 14 * 24, Percent: 100}, {Hours: 7 * 24, Percent: 50}},
+}
+
+// policyFor returns the named policy, with the tiers filled in for the
+// ready-made ones. Custom policies use tiers; unknown names are flexible.
+func policyFor(name string, tiers []RefundTier) CancellationPolicy {
+	if name == PolicyCustom {
+		return CancellationPolicy{Name: PolicyCustom, Tiers: tiers}
+	}
+	if tiers, ok := presetPolicies[name]; ok {
+		return CancellationPolicy{Name: name, Tiers: tiers}
+	}
+	return CancellationPolicy{Name: PolicyFlexible, Tiers: presetPolicies[PolicyFlexible]}
+}
+
+// CancellationPolicy returns the venue's policy, which new bookings are made
+// under
+func (venue *Venue) CancellationPolicy() CancellationPolicy {
+	return policyFor(venue.Cancellation, venue.RefundTiers)
+}
+
+// CancellationPolicy returns the policy the reservation was booked under. It
+// is copied from the venue when the booking is made, so the venue changing
+// its policy later leaves the refund alone.
+func (r Reservation) CancellationPolicy() CancellationPolicy {
+	return policyFor(r.Cancellation, r.RefundTiers)
+}
+
+// RefundTiersText returns the venue's custom tiers as the venue form takes them
+func (venue *Venue) RefundTiersText() string {
+	return FormatRefundTiers(venue.RefundTiers)
+}
+
+// Title returns the policy's name for display, e.g. "Moderate"
+func (p CancellationPolicy) Title() string {
+	if p.Name == "" {
+		return ""
+	}
+	return strings.ToUpper(p.Name[:1]) + p.Name[1:]
+}
+
+// Describe lists the policy's tiers as sentences for customers to read
+func (p CancellationPolicy) Describe() []string {
+	var lines []string
+	for _, t := range p.Tiers {
+		refund := fmt.Sprintf("%d%% refund", t.Percent)
+		if t.Percent == 100 {
+			refund = "Full refund"
+		}
+		lines = append(lines, fmt.Sprintf("%s if cancelled at least %s before the start", refund, formatDuration(t.Hours*60)))
+	}
+	return append(lines, "No refund after that")
+}
+
+// refundPercent returns the share of the total refunded when the booking is
+// cancelled with the given notice
+func (p CancellationPolicy) refundPercent(notice time.Duration) int64 {
+	for _, t := range p.Tiers {
+		if notice >= time.Duration(t.Hours)*time.Hour {
+			return t.Percent
+		}
+	}
+	return 0
+}
+
+// CancellationQuote is what a customer gets back, and what they pay, for
+// cancelling a booking at a given time
+type CancellationQuote struct {
+	Policy  CancellationPolicy `json:"policy"`
+	Notice  time.Duration      `json:"notice"`
+	Percent int64              `json:"refund_percent"`
+	Refund  Money              `json:"refund"`
+	Fee     Money              `json:"fee"`
+}
+
+// Quote works out the refund and fee for cancelling the reservation at now.
+// Only confirmed bookings are charged; a booking that is still pending or on
+// hold is cancelled for free.
+func (p CancellationPolicy) Quote(reservation *Reservation, now time.Time) CancellationQuote {
+	q := CancellationQuote{Policy: p, Notice: reservation.StartAt.Sub(now), Percent: 100}
+	if reservation.Status == StatusConfirmed {
+		q.Percent = p.refundPercent(q.Notice)
+	}
+
+	q.Refund = reservation.Total.MulDiv(q.Percent, 100)
+	q.Fee = reservation.Total - q.Refund
+	return q
+}
+
+// ParseRefundTiers reads tiers from the venue form, written as notice and
+// percentage pairs such as "7d:100, 48h:50". The tiers come back sorted with
+// the most notice first.
+func ParseRefundTiers(s string) ([]RefundTier, error) {
+	var tiers []RefundTier
+	for _, field := range strings.FieldsFunc(s, func(c rune) bool {
+		return c == ',' || c == '\n' || c == '\r'
+	}) {
+		notice, percent, found := strings.Cut(strings.TrimSpace(field), ":")
+		if !found {
+			return nil, ErrInvalidRefundTiers
+		}
+		notice = strings.ToLower(strings.TrimSpace(notice))
+		percent = strings.TrimSuffix(strings.TrimSpace(percent), "%")
+
+		unit := int64(1)
+		switch {
+		case strings.HasSuffix(notice, "d"):
+			unit = 24
+			notice = strings.TrimSuffix(notice, "d")
+		case strings.HasSuffix(notice, "h"):
+			notice = strings.TrimSuffix(notice, "h")
+		}
+
+		hours, err := strconv.ParseInt(notice, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidRefundTiers
+		}
+		pct, err := strconv.ParseInt(percent, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidRefundTiers
+		}
+		tiers = append(tiers, RefundTier{Hours: hours * unit, Percent: pct})
+	}
+
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].Hours > tiers[j].Hours
+	})
+	return tiers, nil
+}
+
+// FormatRefundTiers writes tiers back out in the form ParseRefundTiers reads
+func FormatRefundTiers(tiers []RefundTier) string {
+	parts := make([]string, len(tiers))
+	for i, t := range tiers {
+		parts[i] = t.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ValidateCancellationPolicy validates the policy chosen on the venue form
+func ValidateCancellationPolicy(v *validator.Validator, venue *Venue) {
+	v.Check(validator.PermittedValue(venue.Cancellation, PolicyFlexible, PolicyModerate, PolicyStrict, PolicyCustom),
+		"cancellation_policy", "must be flexible, moderate, strict or custom")
+
+	if venue.Cancellation != PolicyCustom {
+		return
+	}
+
+	v.Check(len(venue.RefundTiers) > 0, "cancellation_tiers", "must list at least one tier for a custom policy")
+	v.Check(len(venue.RefundTiers) <= 5, "cancellation_tiers", "must not list more than 5 tiers")
+	for i, t := range venue.RefundTiers {
+		v.Check(t.Hours > 0 && t.Hours <= 365*24, "cancellation_tiers", "notice must be between 1 hour and 365 days")
+		v.Check(t.Percent >= 0 && t.Percent <= 100, "cancellation_tiers", "refunds must be between 0 and 100 percent")
+		if i > 0 {
+			prev := venue.RefundTiers[i-1]
+			v.Check(t.Hours != prev.Hours, "cancellation_tiers", "each tier needs a different notice period")
+			v.Check(t.Percent <= prev.Percent, "cancellation_tiers", "refunds must not grow as the notice gets shorter")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRefundTiers(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []RefundTier
+		err  bool
+	}{
+		{in: "", want: nil},
+		{in: "7d:100", want: []RefundTier{{Hours: 168, Percent: 100}}},
+		{in: "48h:50", want: []RefundTier{{Hours: 48, Percent: 50}}},
+		{in: "12:25", want: []RefundTier{{Hours: 12, Percent: 25}}},
+		{in: " 7D : 100% ", want: []RefundTier{{Hours: 168, Percent: 100}}},
+		{
+			in:   "48h:50, 7d:100",
+			want: []RefundTier{{Hours: 168, Percent: 100}, {Hours: 48, Percent: 50}},
+		},
+		{
+			in:   "1d:25\r\n14d:100\n3d:50",
+			want: []RefundTier{{Hours: 336, Percent: 100}, {Hours: 72, Percent: 50}, {Hours: 24, Percent: 25}},
+		},
+		{in: "7d:100,", want: []RefundTier{{Hours: 168, Percent: 100}}},
+		{in: "7d", err: true},
+		{in: "7w:100", err: true},
+		{in: "d:100", err: true},
+		{in: "7d:", err: true},
+		{in: "7d:half", err: true},
+		{in: "7d:100, 48h", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRefundTiers(tt.in)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidRefundTiers) {
+				t.Errorf("ParseRefundTiers(%q) = %v, %v; want ErrInvalidRefundTiers", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRefundTiers(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatRefundTiers(t *testing.T) {
+	tiers := []RefundTier{{Hours: 168, Percent: 100}, {Hours: 36, Percent: 50}, {Hours: 24, Percent: 10}}
+
+	text := FormatRefundTiers(tiers)
+	if text != "7d:100, 36h:50, 1d:10" {
+		t.Fatalf("FormatRefundTiers = %q; want \"7d:100, 36h:50, 1d:10\"", text)
+	}
+
+	parsed, err := ParseRefundTiers(text)
+	if err != nil || !reflect.DeepEqual(parsed, tiers) {
+		t.Fatalf("ParseRefundTiers(FormatRefundTiers(tiers)) = %v, %v; want %v", parsed, err, tiers)
+	}
+}
+
+func TestCancellationPolicyQuote(t *testing.T) {
+	start := time.Date(2026, 6, 20, 18, 0, 0, 0, time.UTC)
+	before := func(d time.Duration) time.Time { return start.Add(-d) }
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+
+	moderate := (&Venue{Cancellation: PolicyModerate}).CancellationPolicy()
+	custom := (&Venue{Cancellation: PolicyCustom, RefundTiers: []RefundTier{
+		{Hours: 72, Percent: 100}, {Hours: 12, Percent: 30},
+	}}).CancellationPolicy()
+
+	tests := []struct {
+		name    string
+		policy  CancellationPolicy
+		status  ReservationStatus
+		total   Money
+		now     time.Time
+		percent int64
+		refund  Money
+	}{
+		{name: "flexible, well ahead", policy: (&Venue{Cancellation: PolicyFlexible}).CancellationPolicy(),
+			status: StatusConfirmed, total: 10000, now: before(days(3)), percent: 100, refund: 10000},
+		{name: "flexible, exactly at the tier", policy: (&Venue{Cancellation: PolicyFlexible}).CancellationPolicy(),
+			status: StatusConfirmed, total: 10000, now: before(days(1)), percent: 100, refund: 10000},
+		{name: "flexible, a second too late", policy: (&Venue{Cancellation: PolicyFlexible}).CancellationPolicy(),
+			status: StatusConfirmed, total: 10000, now: before(days(1) - time.Second), percent: 0, refund: 0},
+		{name: "moderate, first tier boundary", policy: moderate,
+			status: StatusConfirmed, total: 10000, now: before(days(5)), percent: 100, refund: 10000},
+		{name: "moderate, just inside the second tier", policy: moderate,
+			status: StatusConfirmed, total: 10000, now: before(days(5) - time.Second), percent: 50, refund: 5000},
+		{name: "moderate, second tier boundary", policy: moderate,
+			status: StatusConfirmed, total: 10000, now: before(days(1)), percent: 50, refund: 5000},
+		{name: "moderate, past the last tier", policy: moderate,
+			status: StatusConfirmed, total: 10000, now: before(time.Hour), percent: 0, refund: 0},
+		{name: "strict, between tiers", policy: (&Venue{Cancellation: PolicyStrict}).CancellationPolicy(),
+			status: StatusConfirmed, total: 10000, now: before(days(10)), percent: 50, refund: 5000},
+		{name: "custom, middle tier", policy: custom,
+			status: StatusConfirmed, total: 10000, now: before(days(2)), percent: 30, refund: 3000},
+		{name: "after the start", policy: moderate,
+			status: StatusConfirmed, total: 10000, now: start.Add(time.Hour), percent: 0, refund: 0},
+		{name: "refund rounds to the cent", policy: moderate,
+			status: StatusConfirmed, total: 3333, now: before(days(2)), percent: 50, refund: 1667},
+		{name: "pending is free", policy: moderate,
+			status: StatusPending, total: 10000, now: before(time.Hour), percent: 100, refund: 10000},
+		{name: "held is free", policy: moderate,
+			status: StatusHeld, total: 10000, now: before(time.Hour), percent: 100, refund: 10000},
+		{name: "unknown policy falls back to flexible", policy: (&Venue{Cancellation: "lenient"}).CancellationPolicy(),
+			status: StatusConfirmed, total: 10000, now: before(days(2)), percent: 100, refund: 10000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reservation := &Reservation{StartAt: start, EndAt: start.Add(2 * time.Hour), Status: tt.status, Total: tt.total}
+
+			q := tt.policy.Quote(reservation, tt.now)
+
+			if q.Percent != tt.percent || q.Refund != tt.refund {
+				t.Fatalf("Quote = %d%%, refund %v; want %d%%, refund %v", q.Percent, q.Refund, tt.percent, tt.refund)
+			}
+			if q.Refund+q.Fee != tt.total {
+				t.Errorf("refund %v + fee %v = %v; want the total %v", q.Refund, q.Fee, q.Refund+q.Fee, tt.total)
+			}
+			if q.Notice != start.Sub(tt.now) {
+				t.Errorf("Notice = %v; want %v", q.Notice, start.Sub(tt.now))
+			}
+		})
+	}
+}
+
+func TestReservationCancellationPolicy(t *testing.T) {
+	start := time.Date(2026, 6, 20, 18, 0, 0, 0, time.UTC)
+	now := start.Add(-3 * 24 * time.Hour)
+
+	tests := []struct {
+		name        string
+		reservation Reservation
+		policy      string
+		percent     int64
+	}{
+		{name: "booked under flexible", reservation: Reservation{Cancellation: PolicyFlexible}, policy: PolicyFlexible, percent: 100},
+		{name: "booked under strict", reservation: Reservation{Cancellation: PolicyStrict}, policy: PolicyStrict, percent: 0},
+		{
+			name: "booked under custom tiers",
+			reservation: Reservation{Cancellation: PolicyCustom,
+				RefundTiers: []RefundTier{{Hours: 7 * 24, Percent: 100}, {Hours: 48, Percent: 40}}},
+			policy: PolicyCustom, percent: 40,
+		},
+		{name: "no policy recorded", reservation: Reservation{}, policy: PolicyFlexible, percent: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reservation := tt.reservation
+			reservation.StartAt = start
+			reservation.EndAt = start.Add(2 * time.Hour)
+			reservation.Status = StatusConfirmed
+			reservation.Total = 10000
+
+			policy := reservation.CancellationPolicy()
+			if policy.Name != tt.policy {
+				t.Fatalf("policy = %q; want %q", policy.Name, tt.policy)
+			}
+			if q := policy.Quote(&reservation, now); q.Percent != tt.percent {
+				t.Fatalf("Quote = %d%%; want %d%%", q.Percent, tt.percent)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Filename: internal/data/feed.go
+// Description: Reservations published in calendar feeds
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// FeedHistory is how far back calendar feeds reach. Older bookings drop out
+// of the feed; calendar apps keep the copies they already have.
+const FeedHistory = 90 * 24 * time.Hour
+
+// FetchVenueFeed retrieves the venue's confirmed bookings for its calendar
+// feed, including ones that have since finished. Cancelled bookings that were
+// confirmed stay in the feed so calendar apps learn to remove them; pending
+// requests and holds that were never confirmed were never in it.
+func (m *ReservationModel) FetchVenueFeed(venueID int64) ([]*Reservation, error) {
+	query := `
+		SELECT r.id, r.venue, r.customer, c.name, r.start_at, r.end_at, r.guest_count, r.total,
+			r.status, r.revision, r.created_at, r.updated_at, v.name, v.location
+		FROM reservation r
+		JOIN venue v ON r.venue = v.id
+		JOIN users c ON r.customer = c.id
+		WHERE r.venue = $1
+		AND r.was_confirmed
+		AND r.end_at >= $2
+		ORDER BY r.start_at`
+
+	return m.fetchFeed(query, venueID)
+}
+
+// FetchCustomerFeed retrieves the customer's own reservations, whatever
+// their status, for their calendar feed
+func (m *ReservationModel) FetchCustomerFeed(customerID int64) ([]*Reservation, error) {
+	query := `
+		SELECT r.id, r.venue, r.customer, c.name, r.start_at, r.end_at, r.guest_count, r.total,
+			r.status, r.revision, r.created_at, r.updated_at, v.name, v.location
+		FROM reservation r
+		JOIN venue v ON r.venue = v.id
+		JOIN users c ON r.customer = c.id
+		WHERE r.customer = $1
+		AND r.end_at >= $2
+		ORDER BY r.start_at`
+
+	return m.fetchFeed(query, customerID)
+}
+
+// fetchFeed runs one of the feed queries, which take the owner of the feed
+// and the start of its history as arguments
+func (m *ReservationModel) fetchFeed(query string, id int64) ([]*Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id, time.Now().Add(-FeedHistory))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []*Reservation
+	for rows.Next() {
+		r := &Reservation{}
+		err := rows.Scan(&r.ID, &r.VenueID, &r.CustomerID, &r.CustomerName, &r.StartAt, &r.EndAt, &r.GuestCount, &r.Total,
+			&r.Status, &r.Revision, &r.CreatedAt, &r.UpdatedAt, &r.VenueName, &r.Location)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+
+	return reservations, rows.Err()
+}
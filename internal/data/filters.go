@@ -0,0 +1,75 @@
+// Filename: internal/data/filters.go
+// Description: Pagination helpers shared by the listing queries
+package data
+
+import (
+	"math"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// Filters holds the page requested by the client
+type Filters struct {
+	Page     int
+	PageSize int
+}
+
+// ValidateFilters checks that the requested page is within sensible bounds
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000, "page", "must be a maximum of 10 000")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata describes where a page of results sits in the full result set
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// calculateMetadata builds the pagination metadata for a query
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+// HasPrevious reports whether there is a page before the current one
+func (m Metadata) HasPrevious() bool {
+	return m.CurrentPage > m.FirstPage
+}
+
+// HasNext reports whether there is a page after the current one
+func (m Metadata) HasNext() bool {
+	return m.CurrentPage < m.LastPage
+}
+
+// PreviousPage returns the number of the page before the current one
+func (m Metadata) PreviousPage() int {
+	return m.CurrentPage - 1
+}
+
+// NextPage returns the number of the page after the current one
+func (m Metadata) NextPage() int {
+	return m.CurrentPage + 1
+}
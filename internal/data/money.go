@@ -0,0 +1,158 @@
+// Filename: internal/data/money.go
+// Description: Exact decimal money amounts stored as whole cents
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidMoney = errors.New("models: invalid money amount")
+
+// Money is an amount in cents. Keeping whole cents in an int64 means prices
+// add and multiply exactly, unlike float64.
+type Money int64
+
+// ParseMoney reads an amount such as "75", "75.5" or "75.50". More than two
+// decimal places is rejected rather than silently rounded, as is anything
+// but digits either side of the point and amounts too large to hold in cents.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), "$"))
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if !isDigits(whole) && !(whole == "" && hasFrac) {
+		return 0, ErrInvalidMoney
+	}
+	if hasFrac && (!isDigits(frac) || len(frac) > 2) {
+		return 0, ErrInvalidMoney
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	dollars, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMoney
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMoney
+	}
+	if dollars > (math.MaxInt64-cents)/100 {
+		return 0, ErrInvalidMoney
+	}
+
+	amount := Money(dollars*100 + cents)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// isDigits reports whether s is one or more ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MulDiv returns m * num / den rounded half away from zero to the nearest cent
+func (m Money) MulDiv(num, den int64) Money {
+	product := int64(m) * num
+	quotient, remainder := product/den, product%den
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if 2*remainder >= den {
+		if product < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return Money(quotient)
+}
+
+// String formats the amount with two decimal places, e.g. "1250.05"
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Scan reads a NUMERIC column. lib/pq hands these over as text, so the value
+// is parsed as a decimal string and never passes through a float.
+func (m *Money) Scan(src any) error {
+	switch value := src.(type) {
+	case []byte:
+		return m.scanString(string(value))
+	case string:
+		return m.scanString(value)
+	case int64:
+		*m = Money(value * 100)
+		return nil
+	case nil:
+		*m = 0
+		return nil
+	default:
+		return fmt.Errorf("models: cannot scan %T into Money", src)
+	}
+}
+
+func (m *Money) scanString(s string) error {
+	// NUMERIC columns with a larger scale may carry trailing zeros
+	if whole, frac, ok := strings.Cut(s, "."); ok && len(frac) > 2 {
+		frac = strings.TrimRight(frac, "0")
+		s = whole
+		if frac != "" {
+			s += "." + frac
+		}
+	}
+
+	amount, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
+
+// Value writes the amount as a decimal string so Postgres stores it exactly
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// MarshalJSON writes the amount as a quoted decimal string, e.g. "12.50"
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+// UnmarshalJSON reads an amount written by MarshalJSON, or a bare JSON number
+// such as Postgres produces for a NUMERIC column
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	return m.scanString(s)
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  bool
+	}{
+		{in: "75", want: 7500},
+		{in: "75.5", want: 7550},
+		{in: "75.50", want: 7550},
+		{in: " $1250.05 ", want: 125005},
+		{in: ".5", want: 50},
+		{in: "0", want: 0},
+		{in: "-12.34", want: -1234},
+		{in: "92233720368547758.07", want: 9223372036854775807},
+		{in: "", err: true},
+		{in: "$", err: true},
+		{in: "-", err: true},
+		{in: ".", err: true},
+		{in: "5.", err: true},
+		{in: "1.005", err: true},
+		{in: "--5", err: true},
+		{in: "-+5", err: true},
+		{in: "+5", err: true},
+		{in: "1.+5", err: true},
+		{in: "1.-5", err: true},
+		{in: "1 000", err: true},
+		{in: "1e3", err: true},
+		{in: "١٢", err: true},
+		{in: "92233720368547758.08", err: true},
+		{in: "99999999999999999999", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidMoney) {
+				t.Errorf("ParseMoney(%q) = %v, %v; want ErrInvalidMoney", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMoneyMulDiv(t *testing.T) {
+	tests := []struct {
+		m        Money
+		num, den int64
+		want     Money
+	}{
+		{m: 7500, num: 90, den: 60, want: 11250},
+		{m: 1000, num: 1, den: 3, want: 333},
+		{m: 2000, num: 1, den: 3, want: 667},
+		{m: 1, num: 1, den: 2, want: 1},
+		{m: 3, num: 1, den: 2, want: 2},
+		{m: -1, num: 1, den: 2, want: -1},
+		{m: -3, num: 1, den: 2, want: -2},
+		{m: -1000, num: 1, den: 3, want: -333},
+		{m: 10000, num: 1250, den: 10000, want: 1250},
+		{m: 0, num: 45, den: 60, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.MulDiv(tt.num, tt.den); got != tt.want {
+			t.Errorf("%v.MulDiv(%d, %d) = %v; want %v", tt.m, tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{m: 0, want: "0.00"},
+		{m: 5, want: "0.05"},
+		{m: 125005, want: "1250.05"},
+		{m: -1234, want: "-12.34"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q; want %q", int64(tt.m), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  any
+		want Money
+		err  bool
+	}{
+		{name: "numeric text", src: []byte("12.50"), want: 1250},
+		{name: "string", src: "12.5", want: 1250},
+		{name: "trailing zeros past the cents", src: []byte("12.5000"), want: 1250},
+		{name: "only zeros past the point", src: []byte("12.000"), want: 1200},
+		{name: "negative with extra scale", src: []byte("-0.1000"), want: -10},
+		{name: "integer", src: int64(12), want: 1200},
+		{name: "null", src: nil, want: 0},
+		{name: "fractions of a cent", src: []byte("12.505"), err: true},
+		{name: "float", src: 12.5, err: true},
+		{name: "not a number", src: []byte("twelve"), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Money(99)
+			err := m.Scan(tt.src)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Scan(%v) = %v; want an error", tt.src, m)
+				}
+				return
+			}
+			if err != nil || m != tt.want {
+				t.Fatalf("Scan(%v) = %v, %v; want %v", tt.src, m, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := Money(1250).MarshalJSON()
+	if err != nil || string(b) != `"12.50"` {
+		t.Fatalf("MarshalJSON = %s, %v; want \"12.50\"", b, err)
+	}
+
+	for _, in := range []string{`"12.50"`, `12.5`, `12.500`} {
+		var m Money
+		err := m.UnmarshalJSON([]byte(in))
+		if err != nil || m != 1250 {
+			t.Errorf("UnmarshalJSON(%s) = %v, %v; want 12.50", in, m, err)
+		}
+	}
+}
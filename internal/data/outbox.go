@@ -0,0 +1,242 @@
+// Filename: internal/data/outbox.go
+// Description: Emails queued alongside reservation changes for delivery later
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Email templates, named after their files in ui/email
+const (
+	EmailBookingConfirmation  = "booking_confirmation"
+	EmailNewBooking           = "new_booking"
+	EmailReservationUpdated   = "reservation_updated"
+	EmailReservationCancelled = "reservation_cancelled"
+	EmailWaitlistOffer        = "waitlist_offer"
+)
+
+// Audiences of a reservation email
+const (
+	toCustomer = false
+	toOwner    = true
+)
+
+// MaxEmailAttempts is how many times delivery is tried before an email is
+// marked failed
+const MaxEmailAttempts = 8
+
+// OutboxEmail is an email waiting in the outbox
+type OutboxEmail struct {
+	ID        int64
+	Recipient string
+	Template  string
+	Payload   json.RawMessage
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// ReservationEmail is the snapshot of a reservation stored with each email
+// about it. Count is above one when the email covers several occurrences of
+// a series at once.
+type ReservationEmail struct {
+	ReservationID int64             `json:"reservation_id"`
+	CustomerName  string            `json:"customer_name"`
+	OwnerName     string            `json:"owner_name"`
+	VenueName     string            `json:"venue_name"`
+	Location      string            `json:"location"`
+	VenueEmail    string            `json:"venue_email"`
+	StartAt       time.Time         `json:"start_at"`
+	EndAt         time.Time         `json:"end_at"`
+	GuestCount    int64             `json:"guest_count"`
+	Total         Money             `json:"total"`
+	Fee           Money             `json:"cancellation_fee"`
+	Refund        Money             `json:"refund_amount"`
+	Status        ReservationStatus `json:"status"`
+	StatusReason  string            `json:"status_reason"`
+	Count         int               `json:"count"`
+
+	// Set only on waitlist offers, whose reservation doesn't exist yet
+	OfferExpiresAt time.Time `json:"offer_expires_at"`
+}
+
+// IsPending reports whether the booking is waiting for the owner's approval
+func (e ReservationEmail) IsPending() bool {
+	return e.Status == StatusPending
+}
+
+// IsRejected reports whether the owner turned the booking down
+func (e ReservationEmail) IsRejected() bool {
+	return e.Status == StatusRejected
+}
+
+// SameDay reports whether the reservation starts and ends on the same date
+func (e ReservationEmail) SameDay() bool {
+	return e.StartAt.Format("2006-01-02") == e.EndAt.Format("2006-01-02")
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// enqueueReservationEmail queues an email about the reservation for its
+// customer or for the venue's owner. It is called inside the transaction
+// that changes the reservation, so the snapshot matches what was committed
+// and nothing is queued if the change is rolled back.
+func enqueueReservationEmail(ctx context.Context, tx execer, reservationID int64, template string, owner bool, count int) error {
+	query := `
+		INSERT INTO email_outbox (recipient, template, reservation, payload)
+		SELECT CASE WHEN $3 THEN o.email ELSE c.email END, $2, r.id,
+			json_build_object(
+				'reservation_id', r.id,
+				'customer_name', c.name,
+				'owner_name', o.name,
+				'venue_name', v.name,
+				'location', v.location,
+				'venue_email', v.email,
+				'start_at', r.start_at,
+				'end_at', r.end_at,
+				'guest_count', r.guest_count,
+				'total', r.total,
+				'cancellation_fee', r.cancellation_fee,
+				'refund_amount', r.refund_amount,
+				'status', r.status,
+				'status_reason', r.status_reason,
+				'count', $4::int)
+		FROM reservation r
+		JOIN venue v ON r.venue = v.id
+		JOIN users c ON r.customer = c.id
+		JOIN users o ON v.owner = o.id
+		WHERE r.id = $1`
+
+	_, err := tx.ExecContext(ctx, query, reservationID, template, owner, count)
+	return err
+}
+
+// enqueueBookingEmails queues the emails for a new booking: a confirmation
+// for the customer and an alert for the owner. Holds get neither until they
+// are confirmed.
+func enqueueBookingEmails(ctx context.Context, tx execer, reservationID int64, count int) error {
+	err := enqueueReservationEmail(ctx, tx, reservationID, EmailBookingConfirmation, toCustomer, count)
+	if err != nil {
+		return err
+	}
+	return enqueueReservationEmail(ctx, tx, reservationID, EmailNewBooking, toOwner, count)
+}
+
+// enqueueChangeEmails queues an email about a change for both the customer
+// and the owner
+func enqueueChangeEmails(ctx context.Context, tx execer, reservationID int64, template string, count int) error {
+	err := enqueueReservationEmail(ctx, tx, reservationID, template, toCustomer, count)
+	if err != nil {
+		return err
+	}
+	return enqueueReservationEmail(ctx, tx, reservationID, template, toOwner, count)
+}
+
+// enqueueWaitlistOffer queues an email telling a customer on the waitlist
+// that their slot is free to claim. It is called inside the transaction that
+// makes the offer. There is no reservation yet, so the snapshot is taken from
+// the waitlist entry.
+func enqueueWaitlistOffer(ctx context.Context, tx execer, entryID int64) error {
+	query := `
+		INSERT INTO email_outbox (recipient, template, payload)
+		SELECT c.email, $2,
+			json_build_object(
+				'customer_name', c.name,
+				'owner_name', o.name,
+				'venue_name', v.name,
+				'location', v.location,
+				'venue_email', v.email,
+				'start_at', w.start_at,
+				'end_at', w.end_at,
+				'guest_count', w.guest_count,
+				'count', 1,
+				'offer_expires_at', w.offer_expires_at)
+		FROM waitlist w
+		JOIN venue v ON w.venue = v.id
+		JOIN users c ON w.customer = c.id
+		JOIN users o ON v.owner = o.id
+		WHERE w.id = $1`
+
+	_, err := tx.ExecContext(ctx, query, entryID, EmailWaitlistOffer)
+	return err
+}
+
+// OutboxModel holds the database connection for the email outbox
+type OutboxModel struct {
+	DB *sql.DB
+}
+
+// ClaimDue takes up to limit emails that are due for delivery. Each one is
+// leased until lease from now by pushing its next attempt back, so another
+// worker won't pick it up while it is being sent, and is counted as an
+// attempt. An email whose worker dies mid-send is retried once the lease runs
+// out.
+func (m *OutboxModel) ClaimDue(limit int, lease time.Duration) ([]*OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, recipient, template, payload, attempts, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []*OutboxEmail
+	for rows.Next() {
+		e := &OutboxEmail{}
+		err := rows.Scan(&e.ID, &e.Recipient, &e.Template, &e.Payload, &e.Attempts, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+
+	return emails, rows.Err()
+}
+
+// MarkSent records that an email was delivered
+func (m *OutboxModel) MarkSent(id int64) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), last_error = ''
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkFailed records a failed delivery. The email is tried again at retryAt,
+// or given up on as failed once it has used MaxEmailAttempts.
+func (m *OutboxModel) MarkFailed(email *OutboxEmail, sendErr error, retryAt time.Time) error {
+	query := `
+		UPDATE email_outbox
+		SET status = CASE WHEN attempts >= $2 THEN 'failed' ELSE 'pending' END,
+			last_error = $3, next_attempt_at = $4
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email.ID, MaxEmailAttempts, sendErr.Error(), retryAt)
+	return err
+}
@@ -0,0 +1,96 @@
+// Filename: internal/data/pricing.go
+// Description: Price quotes for reservations
+package data
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// MaxPrice is the highest hourly rate a venue may charge. With
+// MaxBookingDuration it keeps every quote within the reservation columns.
+const MaxPrice Money = 100000_00
+
+// MaxBookingDuration is the longest booking that can be priced
+const MaxBookingDuration = 366 * 24 * time.Hour
+
+// maxTotal is the largest amount the reservation's DECIMAL(12,2) price
+// columns hold
+const maxTotal Money = 9999999999_99
+
+// ErrQuoteTooLarge is returned when a booking's price doesn't fit in the
+// reservation, because it is too long or its rate is too high
+var ErrQuoteTooLarge = errors.New("models: booking is too long or too expensive to price")
+
+// Pricing turns a venue's hourly rate and a booking window into a quote.
+// TaxRate is in basis points, so 1250 is 12.5%.
+type Pricing struct {
+	TaxRate int64
+}
+
+// Quote is the cost breakdown of a single booking
+type Quote struct {
+	Rate     Money         `json:"price_per_hour"`
+	Duration time.Duration `json:"-"`
+	Subtotal Money         `json:"subtotal"`
+	Tax      Money         `json:"tax"`
+	Total    Money         `json:"total"`
+}
+
+// Quote prices a booking from start to end at the given hourly rate. The
+// duration is charged by the minute and every step rounds to the cent. It
+// returns ErrQuoteTooLarge for bookings longer than MaxBookingDuration and
+// totals too large to store.
+func (p Pricing) Quote(rate Money, start, end time.Time) (Quote, error) {
+	duration := end.Sub(start)
+	if duration < 0 {
+		duration = 0
+	}
+	if duration > MaxBookingDuration || rate < 0 || rate > maxTotal ||
+		p.TaxRate < 0 || p.TaxRate > math.MaxInt64/int64(maxTotal) {
+		return Quote{}, ErrQuoteTooLarge
+	}
+
+	// Neither product can overflow int64 within those bounds
+	subtotal := rate.MulDiv(int64(duration/time.Minute), 60)
+	if subtotal > maxTotal {
+		return Quote{}, ErrQuoteTooLarge
+	}
+	tax := subtotal.MulDiv(p.TaxRate, 10000)
+	if subtotal+tax > maxTotal {
+		return Quote{}, ErrQuoteTooLarge
+	}
+
+	return Quote{
+		Rate:     rate,
+		Duration: duration,
+		Subtotal: subtotal,
+		Tax:      tax,
+		Total:    subtotal + tax,
+	}, nil
+}
+
+// TaxPercent formats the tax rate for display, e.g. "12.5%"
+func (p Pricing) TaxPercent() string {
+	return strconv.FormatFloat(float64(p.TaxRate)/100, 'f', -1, 64) + "%"
+}
+
+// Hours formats the quoted duration to at most two decimals, e.g. "2.5"
+func (q Quote) Hours() string {
+	return strconv.FormatFloat(math.Round(q.Duration.Hours()*100)/100, 'f', -1, 64)
+}
+
+// PriceReservation quotes the reservation at the venue's current rate and
+// stores the breakdown on it, so later price changes leave the booking alone
+func (p Pricing) PriceReservation(reservation *Reservation, venue *Venue) (Quote, error) {
+	quote, err := p.Quote(venue.Price, reservation.StartAt, reservation.EndAt)
+	if err != nil {
+		return Quote{}, err
+	}
+	reservation.Subtotal = quote.Subtotal
+	reservation.Tax = quote.Tax
+	reservation.Total = quote.Total
+	return quote, nil
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPriceReservation(t *testing.T) {
+	start := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		taxRate  int64 // hundredths of a percent
+		rate     Money
+		duration time.Duration
+		subtotal Money
+		tax      Money
+	}{
+		{name: "whole hours", rate: 7500, duration: 2 * time.Hour, subtotal: 15000},
+		{name: "charged by the minute", rate: 6000, duration: 90 * time.Minute, subtotal: 9000},
+		{name: "part minutes are free", rate: 6000, duration: 90*time.Minute + 59*time.Second, subtotal: 9000},
+		{name: "subtotal rounds half up", rate: 100, duration: 30 * time.Minute, subtotal: 50},
+		{name: "odd minutes round to the cent", rate: 1000, duration: 20 * time.Minute, subtotal: 333},
+		{name: "tax", taxRate: 1250, rate: 10000, duration: time.Hour, subtotal: 10000, tax: 1250},
+		{name: "tax rounds to the cent", taxRate: 1250, rate: 1999, duration: time.Hour, subtotal: 1999, tax: 250},
+		{name: "free venue", taxRate: 1250, rate: 0, duration: 3 * time.Hour},
+		{name: "end before start", rate: 7500, duration: -time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Pricing{TaxRate: tt.taxRate}
+			venue := &Venue{Price: tt.rate}
+			reservation := &Reservation{StartAt: start, EndAt: start.Add(tt.duration)}
+
+			quote, err := p.PriceReservation(reservation, venue)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if quote.Subtotal != tt.subtotal || quote.Tax != tt.tax || quote.Total != tt.subtotal+tt.tax {
+				t.Fatalf("quote = %v + %v = %v; want %v + %v", quote.Subtotal, quote.Tax, quote.Total, tt.subtotal, tt.tax)
+			}
+			if quote.Rate != tt.rate {
+				t.Errorf("quote.Rate = %v; want %v", quote.Rate, tt.rate)
+			}
+			if reservation.Subtotal != quote.Subtotal || reservation.Tax != quote.Tax || reservation.Total != quote.Total {
+				t.Errorf("reservation records %v + %v = %v; want the quote %v + %v = %v",
+					reservation.Subtotal, reservation.Tax, reservation.Total, quote.Subtotal, quote.Tax, quote.Total)
+			}
+		})
+	}
+}
+
+func TestQuoteTooLarge(t *testing.T) {
+	start := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		taxRate  int64
+		rate     Money
+		duration time.Duration
+		err      bool
+	}{
+		{name: "top rate for the longest booking", taxRate: 10000, rate: MaxPrice, duration: MaxBookingDuration},
+		{name: "longer than the longest booking", rate: 100, duration: MaxBookingDuration + time.Minute, err: true},
+		{name: "years at a legacy rate", rate: 99999999_99, duration: 200 * 24 * time.Hour, err: true},
+		{name: "rate that would overflow", rate: math.MaxInt64 / 2, duration: time.Hour, err: true},
+		{name: "tax that would overflow", taxRate: math.MaxInt64 / 1000, rate: 100, duration: time.Hour, err: true},
+		{name: "tax pushing past the columns", taxRate: 10000, rate: 9999999999_99, duration: time.Hour, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := Pricing{TaxRate: tt.taxRate}.Quote(tt.rate, start, start.Add(tt.duration))
+			if tt.err {
+				if !errors.Is(err, ErrQuoteTooLarge) {
+					t.Fatalf("Quote = %+v, %v; want ErrQuoteTooLarge", quote, err)
+				}
+				return
+			}
+			if err != nil || quote.Total <= 0 || quote.Total > maxTotal {
+				t.Fatalf("Quote = %+v, %v; want a total that fits the columns", quote, err)
+			}
+		})
+	}
+}
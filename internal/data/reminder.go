@@ -0,0 +1,211 @@
+// Filename: internal/data/reminder.go
+// Description: Reminders sent to customers ahead of their bookings
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reminder is a reminder due for a confirmed reservation. Offset is how long
+// before the start it was scheduled for. The embedded snapshot has the same
+// fields as the booking emails.
+type Reminder struct {
+	CustomerID int64
+	Recipient  string
+	Offset     time.Duration
+	ReservationEmail
+}
+
+// StartsIn describes how soon the reservation starts, e.g. "48 hours"
+func (r Reminder) StartsIn() string {
+	left := time.Until(r.StartAt)
+	if left >= 90*time.Minute {
+		return pluralize(int(math.Round(left.Hours())), "hour")
+	}
+	return pluralize(max(int(math.Round(left.Minutes())), 1), "minute")
+}
+
+// pluralize writes n with the unit, adding an s unless n is 1
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// offsetMinutes converts reminder offsets to the whole minutes they are
+// recorded in
+func offsetMinutes(offsets []time.Duration) []int64 {
+	minutes := make([]int64, len(offsets))
+	for i, o := range offsets {
+		minutes[i] = int64(o / time.Minute)
+	}
+	return minutes
+}
+
+// ReminderModel holds the database connection for reminders
+type ReminderModel struct {
+	DB *sql.DB
+}
+
+// FetchDue finds the reminders that are due at the given offsets: confirmed
+// reservations that haven't started, whose reminder time has passed and that
+// haven't had that reminder yet. When several of a reservation's reminders
+// are due at once only the latest, the one with the smallest offset, comes
+// back. A reminder whose time had already passed when the booking was made is
+// never due, so a booking made the day before doesn't get a "48 hours"
+// reminder. Reservations and customers with reminders turned off are skipped.
+func (m *ReminderModel) FetchDue(offsets []time.Duration) ([]*Reminder, error) {
+	query := `
+		SELECT DISTINCT ON (r.id) r.id, r.customer, c.email, o.minutes,
+			c.name, v.name, v.location, v.email, r.start_at, r.end_at, r.guest_count, r.total, r.status
+		FROM reservation r
+		JOIN venue v ON r.venue = v.id
+		JOIN users c ON r.customer = c.id
+		CROSS JOIN unnest($1::int[]) AS o(minutes)
+		WHERE r.status = $2
+		AND r.reminders_enabled AND c.reminders_enabled
+		AND r.start_at > NOW()
+		AND r.start_at - make_interval(mins => o.minutes) <= NOW()
+		AND r.created_at < r.start_at - make_interval(mins => o.minutes)
+		AND NOT EXISTS (
+			SELECT 1 FROM reservation_reminder rr
+			WHERE rr.reservation = r.id AND rr.offset_minutes = o.minutes
+		)
+		ORDER BY r.id, o.minutes`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(offsetMinutes(offsets)), StatusConfirmed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []*Reminder
+	for rows.Next() {
+		r := &Reminder{ReservationEmail: ReservationEmail{Count: 1}}
+		var minutes int64
+		err := rows.Scan(&r.ReservationID, &r.CustomerID, &r.Recipient, &minutes,
+			&r.CustomerName, &r.VenueName, &r.Location, &r.VenueEmail, &r.StartAt, &r.EndAt, &r.GuestCount, &r.Total, &r.Status)
+		if err != nil {
+			return nil, err
+		}
+		r.Offset = time.Duration(minutes) * time.Minute
+		reminders = append(reminders, r)
+	}
+
+	return reminders, rows.Err()
+}
+
+// Claim records the reminder as sent before it goes out, so a second
+// scheduler or a restart can't send it again. Every longer offset is recorded
+// too: those reminders are overdue and this one replaces them. It reports
+// false when the reminder had already been claimed.
+func (m *ReminderModel) Claim(reminder *Reminder, offsets []time.Duration) (bool, error) {
+	var later []time.Duration
+	for _, o := range offsets {
+		if o >= reminder.Offset {
+			later = append(later, o)
+		}
+	}
+
+	query := `
+		INSERT INTO reservation_reminder (reservation, offset_minutes)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT DO NOTHING
+		RETURNING offset_minutes`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, reminder.ReservationID, pq.Array(offsetMinutes(later)))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	claimed := false
+	for rows.Next() {
+		var minutes int64
+		err := rows.Scan(&minutes)
+		if err != nil {
+			return false, err
+		}
+		if time.Duration(minutes)*time.Minute == reminder.Offset {
+			claimed = true
+		}
+	}
+
+	return claimed, rows.Err()
+}
+
+// Release forgets a claimed reminder that could not be sent, so the next run
+// of the scheduler tries it again
+func (m *ReminderModel) Release(reminder *Reminder) error {
+	query := `
+		DELETE FROM reservation_reminder
+		WHERE reservation = $1 AND offset_minutes = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, reminder.ReservationID, int64(reminder.Offset/time.Minute))
+	return err
+}
+
+// SetForReservation turns reminders on or off for one of the customer's
+// reservations
+func (m *ReminderModel) SetForReservation(reservationID, customerID int64, enabled bool) error {
+	query := `
+		UPDATE reservation
+		SET reminders_enabled = $1
+		WHERE id = $2 AND customer = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, enabled, reservationID, customerID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// SetForCustomer turns reminders on or off for all of a customer's
+// reservations. Reservations turned off one by one stay off.
+func (m *ReminderModel) SetForCustomer(customerID int64, enabled bool) error {
+	query := `
+		UPDATE users
+		SET reminders_enabled = $1
+		WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, enabled, customerID)
+	return err
+}
+
+// forgetReminders clears the reminders sent for a reservation when it is
+// moved, so they go out again for its new time
+func forgetReminders(ctx context.Context, tx execer, reservationID int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM reservation_reminder WHERE reservation = $1`, reservationID)
+	return err
+}
@@ -3,37 +3,144 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrReservationConflict is returned when a reservation overlaps another
+	// confirmed, pending or held reservation for the same venue
+	ErrReservationConflict = errors.New("models: reservation conflicts with an existing booking")
+
+	// ErrHoldExpired is returned when a customer tries to confirm a hold that
+	// has already lapsed
+	ErrHoldExpired = errors.New("models: reservation hold has expired")
+)
+
+// Views of an owner's reservation inbox
+const (
+	InboxPending  = "pending"
+	InboxUpcoming = "upcoming"
+	InboxPast     = "past"
 )
 
 type Reservation struct {
-	ID           int64     `json:"id"`
-	VenueID      int64     `json:"venue_id"`
-	CustomerID   int64     `json:"customer_id"`
-	CustomerName string    `json:"customer"` // <- this line is required
-	StartDate    time.Time `json:"start_date"`
-	StartTime    time.Time `json:"start_time"`
-	EndTime      time.Time `json:"end_time"`
-	Status       string    `json:"status"`
-	CreatedAt    time.Time `json:"created_at"`
-	VenueName    string    `json:"venue_name"`
+	ID           int64             `json:"id"`
+	VenueID      int64             `json:"venue_id"`
+	CustomerID   int64             `json:"customer_id"`
+	CustomerName string            `json:"customer"` // <- this line is required
+	SeriesID     int64             `json:"series_id,omitempty"`
+	StartAt      time.Time         `json:"start_at"`
+	EndAt        time.Time         `json:"end_at"`
+	BlockedFrom  time.Time         `json:"-"`
+	BlockedUntil time.Time         `json:"-"`
+	GuestCount   int64             `json:"guest_count"`
+	Subtotal     Money             `json:"subtotal"`
+	Tax          Money             `json:"tax"`
+	Total        Money             `json:"total"`
+	Fee          Money             `json:"cancellation_fee"` // kept by the venue when the booking was cancelled
+	Refund       Money             `json:"refund_amount"`
+	Cancellation string            `json:"cancellation_policy"`    // the venue's policy when the booking was made
+	RefundTiers  []RefundTier      `json:"refund_tiers,omitempty"` // only used by the custom policy
+	Status       ReservationStatus `json:"status"`
+	StatusReason string            `json:"status_reason,omitempty"`
+	HoldExpires  time.Time         `json:"hold_expires_at,omitempty"` // set while the reservation is on hold
+	Revision     int64             `json:"revision"`                  // goes up every time the reservation changes
+	Reminders    bool              `json:"reminders_enabled"`         // false when the customer turned reminders off for it
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	VenueName    string            `json:"venue_name"`
+	Location     string            `json:"location,omitempty"`
+}
+
+// InSeries reports whether the reservation is one occurrence of a recurring
+// booking
+func (r Reservation) InSeries() bool {
+	return r.SeriesID != 0
+}
+
+// HasBuffer reports whether the venue blocks time around the booking for
+// setup or cleanup
+func (r Reservation) HasBuffer() bool {
+	return r.BlockedFrom.Before(r.StartAt) || r.BlockedUntil.After(r.EndAt)
 }
 
-// ValidateReservation validates the input from the reservation form
-func ValidateReservation(v *validator.Validator, reservation *Reservation) {
+// IsPending reports whether the reservation is waiting for owner approval
+func (r Reservation) IsPending() bool {
+	return r.Status == StatusPending
+}
 
-	v.Check(validator.IsDateSelected(reservation.StartDate), "start_date", "must be provided")
-	v.Check(validator.IsDateInFuture(reservation.StartDate), "start_date", "must be a future date")
+// IsHeld reports whether the slot is pencilled in but not yet booked
+func (r Reservation) IsHeld() bool {
+	return r.Status == StatusHeld
+}
 
-	// Start time
-	v.Check(validator.IsDateSelected(reservation.StartTime), "start_time", "must be provided")
-	v.Check(validator.IsTimeInFuture(reservation.StartTime), "start_time", "must be a future time")
+// IsActive reports whether the reservation still holds its slot
+func (r Reservation) IsActive() bool {
+	return r.Status.IsActive()
+}
+
+// CanRemind reports whether the reservation is a confirmed booking that has
+// yet to start, so reminders may still be sent for it
+func (r Reservation) CanRemind() bool {
+	return r.Status == StatusConfirmed && r.StartAt.After(time.Now())
+}
+
+// CanMarkNoShow reports whether the owner may record that the customer never
+// turned up: the booking went ahead as far as the system knows and has ended
+func (r Reservation) CanMarkNoShow() bool {
+	return r.Status.CanTransitionTo(StatusNoShow) && r.EndAt.Before(time.Now())
+}
+
+// SameDay reports whether the reservation starts and ends on the same date
+func (r Reservation) SameDay() bool {
+	return r.StartAt.Format("2006-01-02") == r.EndAt.Format("2006-01-02")
+}
 
-	// End time
-	v.Check(validator.IsDateSelected(reservation.EndTime), "end_time", "must be provided")
-	v.Check(reservation.EndTime.After(reservation.StartTime), "end_time", "must be after the start time")
+// Duration returns how long the reservation lasts
+func (r Reservation) Duration() time.Duration {
+	return r.EndAt.Sub(r.StartAt)
+}
+
+// ValidateStatusReason validates the reason an owner gives when approving or
+// rejecting a reservation
+func ValidateStatusReason(v *validator.Validator, reason string, required bool) {
+	if required {
+		v.Check(validator.NotBlank(reason), "reason", "must be provided")
+	}
+	v.Check(validator.MaxLength(reason, 500), "reason", "must not be more than 500 bytes long")
+}
+
+// ValidateReservation validates the input from the reservation form against
+// the venue being booked
+func ValidateReservation(v *validator.Validator, reservation *Reservation, venue *Venue) {
+	// Start
+	v.Check(validator.IsDateSelected(reservation.StartAt), "start_time", "must be provided")
+	v.Check(validator.IsTimeInFuture(reservation.StartAt), "start_time", "must be a future time")
+
+	// End
+	v.Check(validator.IsDateSelected(reservation.EndAt), "end_time", "must be provided")
+	v.Check(reservation.EndAt.After(reservation.StartAt), "end_time", "must be after the start")
+	v.Check(reservation.Duration() <= MaxBookingDuration, "end_time", "booking must not be longer than 366 days")
+
+	// Booking rules, opening hours and blackouts
+	if v.ValidData() {
+		venue.checkBookingRules(v, reservation.StartAt, reservation.EndAt, time.Now())
+	}
+	if v.ValidData() {
+		v.Check(venue.IsOpen(reservation.StartAt, reservation.EndAt), "start_time", "is outside the venue's opening hours")
+		if b, found := venue.BlackoutDuring(reservation.StartAt, reservation.EndAt); found {
+			v.AddError("start_time", fmt.Sprintf("the venue is unavailable from %s to %s", b.StartAt.Format("Jan 02, 2006 15:04"), b.EndAt.Format("Jan 02, 2006 15:04")))
+		}
+	}
+
+	// Guests
+	v.Check(validator.NotZeroInt(reservation.GuestCount), "guest_count", "must be at least 1")
+	v.Check(reservation.GuestCount <= venue.MaxCapacity, "guest_count", fmt.Sprintf("must not be more than the venue's capacity of %d", venue.MaxCapacity))
 }
 
 // ReservationModel holds the database connection and methods for handling reservations
@@ -41,146 +148,373 @@ type ReservationModel struct {
 	DB *sql.DB
 }
 
-// Insert adds a new reservation record to the database
+// Insert adds a new reservation record to the database. A reservation with
+// HoldExpires set is placed on hold until then. Otherwise it is confirmed
+// straight away when the venue auto-accepts bookings, or waits as pending
+// until the owner approves it, and the customer and owner are emailed.
 func (m *ReservationModel) Insert(reservation *Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertReservation(ctx, tx, reservation)
+	if err != nil {
+		return err
+	}
+
+	if reservation.Status != StatusHeld {
+		err = enqueueBookingEmails(ctx, tx, reservation.ID, 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx, so a reservation can
+// be inserted on its own or as part of a larger transaction
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertReservation does the work of Insert using q
+func insertReservation(ctx context.Context, q rowQuerier, reservation *Reservation) error {
 	// Set creation time before insert
 	reservation.CreatedAt = time.Now()
 
 	query := `
-		INSERT INTO reservation (venue, customer, start_date, start_time, end_time, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, created_at`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	// Use QueryRowContext to assign the returned id and created_at
-	err := m.DB.QueryRowContext(
+		INSERT INTO reservation (venue, customer, start_at, end_at, blocked_from, blocked_until,
+			guest_count, subtotal, tax, total, status, created_at, hold_expires_at,
+			cancellation_policy, cancellation_tiers, was_confirmed)
+		SELECT v.id, $2, $3, $4,
+			$3::timestamptz - make_interval(mins => v.buffer_before_minutes),
+			$4::timestamptz + make_interval(mins => v.buffer_after_minutes),
+			$5, $6, $7, $8,
+			CASE WHEN $12::timestamptz IS NOT NULL THEN $13::int WHEN v.auto_accept THEN $9::int ELSE $10::int END,
+			$11, $12, v.cancellation_policy, v.cancellation_tiers,
+			$12::timestamptz IS NULL AND v.auto_accept
+		FROM venue v
+		WHERE v.id = $1
+		RETURNING id, status, blocked_from, blocked_until, created_at, cancellation_policy, cancellation_tiers`
+
+	// Use QueryRowContext to assign the returned id, status and created_at,
+	// and the cancellation policy copied from the venue
+	var tiers string
+	err := q.QueryRowContext(
 		ctx,
 		query,
 		reservation.VenueID,
 		reservation.CustomerID,
-		reservation.StartDate,
-		reservation.StartTime,
-		reservation.EndTime,
-		reservation.Status, // make sure you're passing this
+		reservation.StartAt,
+		reservation.EndAt,
+		reservation.GuestCount,
+		reservation.Subtotal,
+		reservation.Tax,
+		reservation.Total,
+		StatusConfirmed,
+		StatusPending,
 		reservation.CreatedAt,
-	).Scan(&reservation.ID, &reservation.CreatedAt)
+		sql.NullTime{Time: reservation.HoldExpires, Valid: !reservation.HoldExpires.IsZero()},
+		StatusHeld,
+	).Scan(&reservation.ID, &reservation.Status, &reservation.BlockedFrom, &reservation.BlockedUntil, &reservation.CreatedAt,
+		&reservation.Cancellation, &tiers)
 
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		if isOverlapViolation(err) {
+			return ErrReservationConflict
+		}
+		return err
+	}
+
+	reservation.RefundTiers, err = ParseRefundTiers(tiers)
 	return err
 }
 
-// FetchAllConfirmedReservations retrieves all confirmed reservations from the database
-func (m *ReservationModel) FetchAllConfirmedReservations() ([]*Reservation, error) {
+// ReservationFilters narrows a customer's reservation listing. Zero values
+// leave the corresponding filter switched off.
+type ReservationFilters struct {
+	Status  ReservationStatus
+	VenueID int64
+	From    time.Time
+	To      time.Time
+	Filters
+}
+
+// ValidateReservationFilters checks the filters supplied in the query string
+func ValidateReservationFilters(v *validator.Validator, f ReservationFilters) {
+	ValidateFilters(v, f.Filters)
+	v.Check(f.Status >= 0, "status", "must be a valid status")
+	v.Check(f.VenueID >= 0, "venue", "must be a valid venue")
+	if !f.From.IsZero() && !f.To.IsZero() {
+		v.Check(!f.To.Before(f.From), "to", "must not be before the from date")
+	}
+}
+
+// FetchForCustomer retrieves one page of the given customer's reservations.
+// Upcoming bookings come first, soonest at the top, followed by past bookings
+// with the most recent first.
+func (m *ReservationModel) FetchForCustomer(customerID int64, filters ReservationFilters) ([]*Reservation, Metadata, error) {
 	query := `
-        SELECT r.id, r.venue, r.start_date, r.start_time, r.end_time, r.status, r.created_at, venue.name
+		SELECT count(*) OVER(), r.id, r.venue, r.customer, COALESCE(r.series_id, 0), r.start_at, r.end_at, r.guest_count, r.subtotal, r.tax, r.total,
+			r.cancellation_fee, r.refund_amount, r.status, r.status_reason, r.hold_expires_at, r.reminders_enabled, r.created_at, v.name
 		FROM reservation r
-		JOIN venue ON r.venue = venue.id
-		WHERE r.status = 1
-		ORDER BY r.created_at DESC`
+		JOIN venue v ON r.venue = v.id
+		WHERE r.customer = $1
+		AND ($2 = 0 OR r.status = $2)
+		AND ($3 = 0 OR r.venue = $3)
+		AND ($4::date IS NULL OR r.end_at > $4::date)
+		AND ($5::date IS NULL OR r.start_at < $5::date + 1)
+		ORDER BY
+			(r.end_at < NOW()),
+			CASE WHEN r.end_at >= NOW() THEN r.start_at END ASC,
+			r.start_at DESC,
+			r.id
+		LIMIT $6 OFFSET $7`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-	rows, err := m.DB.Query(query)
+	rows, err := m.DB.QueryContext(
+		ctx,
+		query,
+		customerID,
+		filters.Status,
+		filters.VenueID,
+		nullDate(filters.From),
+		nullDate(filters.To),
+		filters.limit(),
+		filters.offset(),
+	)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	var reservations []*Reservation
 	for rows.Next() {
 		r := &Reservation{}
-		err := rows.Scan(&r.ID, &r.VenueID, &r.StartDate, &r.StartTime, &r.EndTime, &r.Status, &r.CreatedAt, &r.VenueName)
+		var holdExpires sql.NullTime
+		err := rows.Scan(&totalRecords, &r.ID, &r.VenueID, &r.CustomerID, &r.SeriesID, &r.StartAt, &r.EndAt, &r.GuestCount, &r.Subtotal, &r.Tax, &r.Total, &r.Fee, &r.Refund, &r.Status, &r.StatusReason, &holdExpires, &r.Reminders, &r.CreatedAt, &r.VenueName)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
+		r.HoldExpires = holdExpires.Time
 		reservations = append(reservations, r)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
-	return reservations, nil
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return reservations, metadata, nil
 }
 
-// FetchAllCancelledReservations retrieves all cancelled reservations from the database
-func (m *ReservationModel) FetchAllCancelledReservations() ([]*Reservation, error) {
+// nullDate converts a zero time into a SQL NULL so optional date filters can
+// be switched off inside the query
+func nullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+// Update reschedules an active reservation and emails the customer and owner
+// about the change. The status is left alone; it only changes through the
+// lifecycle methods.
+func (m *ReservationModel) Update(reservation *Reservation) error {
 	query := `
-		SELECT r.id, r.venue, r.start_date, r.start_time, r.end_time, r.status, r.created_at, venue.name
-		FROM reservation r
-		JOIN venue ON r.venue = venue.id
-		WHERE r.status = 2
-		ORDER BY r.created_at DESC`
+		UPDATE reservation r
+		SET start_at = $1, end_at = $2,
+			blocked_from = $1::timestamptz - make_interval(mins => v.buffer_before_minutes),
+			blocked_until = $2::timestamptz + make_interval(mins => v.buffer_after_minutes),
+			guest_count = $3, subtotal = $4, tax = $5, total = $6,
+			revision = r.revision + 1, updated_at = NOW()
+		FROM venue v
+		WHERE r.venue = v.id
+		AND r.id = $7 AND r.customer = $8 AND r.status IN (1, 3, 7)
+		RETURNING r.id, r.status, r.blocked_from, r.blocked_until`
 
-	rows, err := m.DB.Query(query)
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var reservations []*Reservation
-	for rows.Next() {
-		r := &Reservation{}
-		err := rows.Scan(&r.ID, &r.VenueID, &r.StartDate, &r.StartTime, &r.EndTime, &r.Status, &r.CreatedAt, &r.VenueName)
-		if err != nil {
-			return nil, err
+	// Execute the query and return the result
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		reservation.StartAt,
+		reservation.EndAt,
+		reservation.GuestCount,
+		reservation.Subtotal,
+		reservation.Tax,
+		reservation.Total,
+		reservation.ID,
+		reservation.CustomerID,
+	).Scan(&reservation.ID, &reservation.Status, &reservation.BlockedFrom, &reservation.BlockedUntil)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
 		}
-		reservations = append(reservations, r)
+		if isOverlapViolation(err) {
+			return ErrReservationConflict
+		}
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	err = forgetReminders(ctx, tx, reservation.ID)
+	if err != nil {
+		return err
 	}
 
-	return reservations, nil
+	if reservation.Status != StatusHeld {
+		err = enqueueChangeEmails(ctx, tx, reservation.ID, EmailReservationUpdated, 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-// Update updates an existing reservation record in the database
-func (m *ReservationModel) Update(reservation *Reservation) error {
+// FetchConflicting returns the confirmed, pending or held reservation that overlaps the given
+// reservation's slot at the same venue, or nil if the slot is free. Both bookings'
+// setup and cleanup buffers count as taken.
+func (m *ReservationModel) FetchConflicting(reservation *Reservation) (*Reservation, error) {
 	query := `
-		UPDATE reservation
-		SET start_date = $1, start_time = $2, end_time = $3, status = $4
-		WHERE id = $5
-		RETURNING id`
+		SELECT r.id, r.venue, r.start_at, r.end_at, r.blocked_from, r.blocked_until, r.status, r.created_at
+		FROM reservation r
+		JOIN venue v ON r.venue = v.id
+		WHERE r.venue = $1
+		AND r.id <> $2
+		AND r.status IN (1, 3, 7)
+		AND tstzrange(r.blocked_from, r.blocked_until, '[)') && tstzrange(
+			$3::timestamptz - make_interval(mins => v.buffer_before_minutes),
+			$4::timestamptz + make_interval(mins => v.buffer_after_minutes), '[)')
+		ORDER BY r.start_at
+		LIMIT 1`
 
-	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Execute the query and return the result
-	return m.DB.QueryRowContext(
+	var res Reservation
+	err := m.DB.QueryRowContext(
 		ctx,
 		query,
-		reservation.StartDate,
-		reservation.StartTime,
-		reservation.EndTime,
-		reservation.Status,
+		reservation.VenueID,
 		reservation.ID,
-	).Scan(&reservation.ID)
+		reservation.StartAt,
+		reservation.EndAt,
+	).Scan(&res.ID, &res.VenueID, &res.StartAt, &res.EndAt, &res.BlockedFrom, &res.BlockedUntil, &res.Status, &res.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &res, nil
 }
 
-// Cancel updates the status of an existing reservation to 'cancelled'
-func (m *ReservationModel) Cancel(reservationID int64) error {
-	query := `
-		UPDATE reservation
-		SET status = 2
-		WHERE id = $1`
+// isOverlapViolation reports whether err was raised by the reservation_no_overlap
+// exclusion constraint
+func isOverlapViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23P01" && pqErr.Constraint == "reservation_no_overlap"
+}
 
-	// Create a context with timeout
+// Cancel moves the customer's reservation to cancelled, recording the fee
+// and refund that the policy it was booked under gives at that moment. The quote
+// is worked out while the reservation is locked and returned.
+func (m *ReservationModel) Cancel(reservationID, customerID int64) (CancellationQuote, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Execute the update query
-	_, err := m.DB.ExecContext(ctx, query, reservationID)
-	return err // Return any error that occurred during the update operation
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return CancellationQuote{}, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT start_at, total, status, cancellation_policy, cancellation_tiers
+		FROM reservation
+		WHERE id = $1 AND customer = $2
+		FOR UPDATE`
+
+	r := &Reservation{ID: reservationID}
+	var tiers string
+	err = tx.QueryRowContext(ctx, query, reservationID, customerID).Scan(&r.StartAt, &r.Total, &r.Status, &r.Cancellation, &tiers)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CancellationQuote{}, ErrRecordNotFound
+		}
+		return CancellationQuote{}, err
+	}
+	r.RefundTiers, err = ParseRefundTiers(tiers)
+	if err != nil {
+		return CancellationQuote{}, err
+	}
+
+	if !r.Status.CanTransitionTo(StatusCancelled) {
+		return CancellationQuote{}, ErrInvalidTransition
+	}
+
+	quote := r.CancellationPolicy().Quote(r, time.Now())
+	err = cancelWithQuote(ctx, tx, r.ID, quote)
+	if err != nil {
+		return CancellationQuote{}, err
+	}
+
+	// Nobody was told about a hold, so nobody needs telling it has gone
+	if r.Status != StatusHeld {
+		err = enqueueChangeEmails(ctx, tx, r.ID, EmailReservationCancelled, 1)
+		if err != nil {
+			return CancellationQuote{}, err
+		}
+	}
+
+	return quote, tx.Commit()
+}
+
+// cancelWithQuote marks a locked reservation cancelled along with its fee and
+// refund
+func cancelWithQuote(ctx context.Context, tx *sql.Tx, reservationID int64, quote CancellationQuote) error {
+	query := `
+		UPDATE reservation
+		SET status = $1, cancellation_fee = $2, refund_amount = $3, status_changed_at = NOW(),
+			revision = revision + 1, updated_at = NOW()
+		WHERE id = $4`
+
+	_, err := tx.ExecContext(ctx, query, StatusCancelled, quote.Fee, quote.Refund, reservationID)
+	return err
 }
 
 // Query for 1 Reservation data by
 func (m *ReservationModel) FetchByID(id int) (*Reservation, error) {
 	query := `
 	SELECT 
-		r.id, r.venue, r.customer, c.name,
-		r.start_date, r.start_time, r.end_time, r.status, r.created_at,
-		v.name AS venue_name
+		r.id, r.venue, r.customer, c.name, COALESCE(r.series_id, 0),
+		r.start_at, r.end_at, r.guest_count, r.subtotal, r.tax, r.total,
+		r.status, r.revision, r.created_at, r.updated_at, v.name AS venue_name, v.location,
+		r.cancellation_policy, r.cancellation_tiers
 	FROM reservation r
 	JOIN venue v ON r.venue = v.id
 	JOIN users c ON r.customer = c.id
@@ -189,21 +523,325 @@ func (m *ReservationModel) FetchByID(id int) (*Reservation, error) {
 	row := m.DB.QueryRow(query, id)
 
 	var res Reservation
+	var tiers string
 	err := row.Scan(
 		&res.ID,           // r.id
 		&res.VenueID,      // r.venue
 		&res.CustomerID,   // r.customer
 		&res.CustomerName, // c.name
-		&res.StartDate,    // r.start_date
-		&res.StartTime,    // r.start_time
-		&res.EndTime,      // r.end_time
+		&res.SeriesID,     // r.series_id
+		&res.StartAt,      // r.start_at
+		&res.EndAt,        // r.end_at
+		&res.GuestCount,   // r.guest_count
+		&res.Subtotal,     // r.subtotal
+		&res.Tax,          // r.tax
+		&res.Total,        // r.total
 		&res.Status,       // r.status
+		&res.Revision,     // r.revision
 		&res.CreatedAt,    // r.created_at
+		&res.UpdatedAt,    // r.updated_at
 		&res.VenueName,    // v.name
+		&res.Location,     // v.location
+		&res.Cancellation, // r.cancellation_policy
+		&tiers,            // r.cancellation_tiers
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
 		return nil, err
 	}
 
+	res.RefundTiers, err = ParseRefundTiers(tiers)
+	if err != nil {
+		return nil, err
+	}
 	return &res, nil
 }
+
+// FetchForOwner retrieves the reservations across every venue the owner has,
+// for one view of the owner's inbox: pending requests, upcoming confirmed
+// bookings, or bookings that have already ended
+func (m *ReservationModel) FetchForOwner(ownerID int64, view string) ([]*Reservation, error) {
+	var condition, order string
+	switch view {
+	case InboxPending:
+		condition = "r.status = 3 AND r.end_at >= NOW()"
+		order = "r.start_at"
+	case InboxUpcoming:
+		condition = "r.status IN (1, 7) AND r.end_at >= NOW()"
+		order = "r.start_at"
+	case InboxPast:
+		condition = "r.end_at < NOW()"
+		order = "r.start_at DESC"
+	default:
+		return nil, errors.New("models: unknown inbox view " + view)
+	}
+
+	query := `
+		SELECT r.id, r.venue, r.customer, c.name, r.start_at, r.end_at, r.blocked_from, r.blocked_until,
+			r.guest_count, r.subtotal, r.tax, r.total, r.status, r.status_reason, r.created_at, v.name
+		FROM reservation r
+		JOIN venue v ON r.venue = v.id
+		JOIN users c ON r.customer = c.id
+		WHERE v.owner = $1
+		AND ` + condition + `
+		ORDER BY ` + order + `
+		LIMIT 100`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []*Reservation
+	for rows.Next() {
+		r := &Reservation{}
+		err := rows.Scan(&r.ID, &r.VenueID, &r.CustomerID, &r.CustomerName, &r.StartAt, &r.EndAt, &r.BlockedFrom, &r.BlockedUntil, &r.GuestCount,
+			&r.Subtotal, &r.Tax, &r.Total, &r.Status, &r.StatusReason, &r.CreatedAt, &r.VenueName)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// Approve confirms a pending reservation at one of the owner's venues
+func (m *ReservationModel) Approve(reservationID, ownerID int64, reason string) error {
+	return m.transition(reservationID, 0, ownerID, StatusConfirmed, reason)
+}
+
+// Reject turns down a pending reservation at one of the owner's venues
+func (m *ReservationModel) Reject(reservationID, ownerID int64, reason string) error {
+	return m.transition(reservationID, 0, ownerID, StatusRejected, reason)
+}
+
+// MarkNoShow records that the customer never turned up to a booking at one of
+// the owner's venues. Only a booking that has ended can be a no-show.
+func (m *ReservationModel) MarkNoShow(reservationID, ownerID int64) error {
+	return m.transition(reservationID, 0, ownerID, StatusNoShow, "")
+}
+
+// transition moves a reservation to a new status, refusing any move the
+// lifecycle doesn't allow. The row is locked while the move is checked so two
+// concurrent transitions can't both succeed. Exactly one of customerID and
+// ownerID should be set; it limits the move to the customer's own reservations
+// or to reservations at the owner's venues.
+func (m *ReservationModel) transition(reservationID, customerID, ownerID int64, to ReservationStatus, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT r.status, r.end_at
+		FROM reservation r
+		JOIN venue v ON r.venue = v.id
+		WHERE r.id = $1
+		AND (($2 <> 0 AND r.customer = $2) OR ($3 <> 0 AND v.owner = $3))
+		FOR UPDATE OF r`
+
+	var current ReservationStatus
+	var endAt time.Time
+	err = tx.QueryRowContext(ctx, query, reservationID, customerID, ownerID).Scan(&current, &endAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if !current.CanTransitionTo(to) {
+		return ErrInvalidTransition
+	}
+
+	// A customer can't fail to turn up to a booking that hasn't ended yet
+	if to == StatusNoShow && !endAt.Before(time.Now()) {
+		return ErrInvalidTransition
+	}
+
+	query = `
+		UPDATE reservation
+		SET status = $1, status_reason = $2, status_changed_at = NOW(),
+			was_confirmed = was_confirmed OR $1 = $4,
+			revision = revision + 1, updated_at = NOW()
+		WHERE id = $3`
+
+	_, err = tx.ExecContext(ctx, query, to, reason, reservationID, StatusConfirmed)
+	if err != nil {
+		if isOverlapViolation(err) {
+			return ErrReservationConflict
+		}
+		return err
+	}
+
+	// The customer hears the owner's decision on a pending booking
+	switch to {
+	case StatusConfirmed:
+		err = enqueueReservationEmail(ctx, tx, reservationID, EmailBookingConfirmation, toCustomer, 1)
+	case StatusRejected:
+		err = enqueueReservationEmail(ctx, tx, reservationID, EmailReservationCancelled, toCustomer, 1)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmHold turns the customer's hold into a booking before it lapses. Like
+// a new booking, it is confirmed straight away when the venue auto-accepts
+// bookings and left pending otherwise. The new status is stored on
+// reservation.
+func (m *ReservationModel) ConfirmHold(reservation *Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT r.status, r.hold_expires_at, v.auto_accept
+		FROM reservation r
+		JOIN venue v ON r.venue = v.id
+		WHERE r.id = $1 AND r.customer = $2
+		FOR UPDATE OF r`
+
+	var current ReservationStatus
+	var expires sql.NullTime
+	var autoAccept bool
+	err = tx.QueryRowContext(ctx, query, reservation.ID, reservation.CustomerID).Scan(&current, &expires, &autoAccept)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if current != StatusHeld {
+		return ErrInvalidTransition
+	}
+	if !time.Now().Before(expires.Time) {
+		return ErrHoldExpired
+	}
+
+	to := StatusPending
+	if autoAccept {
+		to = StatusConfirmed
+	}
+
+	query = `
+		UPDATE reservation
+		SET status = $1, hold_expires_at = NULL, status_changed_at = NOW(),
+			was_confirmed = $1 = $3, revision = revision + 1, updated_at = NOW()
+		WHERE id = $2`
+
+	_, err = tx.ExecContext(ctx, query, to, reservation.ID, StatusConfirmed)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueBookingEmails(ctx, tx, reservation.ID, 1)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	reservation.Status = to
+	reservation.HoldExpires = time.Time{}
+	return nil
+}
+
+// ReleaseExpiredHolds cancels holds whose time has run out and returns them,
+// so their slots can be passed on
+func (m *ReservationModel) ReleaseExpiredHolds() ([]*Reservation, error) {
+	query := `
+		UPDATE reservation
+		SET status = $1, status_reason = 'Hold expired', hold_expires_at = NULL, status_changed_at = NOW(),
+			revision = revision + 1, updated_at = NOW()
+		WHERE status = $2
+		AND hold_expires_at <= NOW()
+		RETURNING id, venue, customer, start_at, end_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, StatusCancelled, StatusHeld)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var released []*Reservation
+	for rows.Next() {
+		r := &Reservation{Status: StatusCancelled}
+		err := rows.Scan(&r.ID, &r.VenueID, &r.CustomerID, &r.StartAt, &r.EndAt)
+		if err != nil {
+			return nil, err
+		}
+		released = append(released, r)
+	}
+
+	return released, rows.Err()
+}
+
+// CompletePast marks confirmed reservations that have already ended as
+// completed and returns how many were updated
+func (m *ReservationModel) CompletePast() (int64, error) {
+	query := `
+		UPDATE reservation
+		SET status = $1, status_changed_at = NOW(),
+			revision = revision + 1, updated_at = NOW()
+		WHERE status = $2
+		AND end_at < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, StatusCompleted, StatusConfirmed)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// CountOverCapacity returns how many upcoming confirmed, pending or held reservations
+// at the venue expect more guests than the given capacity
+func (m *ReservationModel) CountOverCapacity(venueID, capacity int64) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM reservation
+		WHERE venue = $1
+		AND status IN (1, 3, 7)
+		AND end_at > NOW()
+		AND guest_count > $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, venueID, capacity).Scan(&count)
+	return count, err
+}
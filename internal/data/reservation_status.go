@@ -0,0 +1,69 @@
+// Filename: internal/data/reservation_status.go
+// Description: Reservation lifecycle states and the moves allowed between them
+package data
+
+import "errors"
+
+// ErrInvalidTransition is returned when a reservation is asked to move to a
+// status its current status can't reach
+var ErrInvalidTransition = errors.New("models: invalid reservation status transition")
+
+// ReservationStatus is a reservation's place in its lifecycle. The values
+// match the rows of the reservationStatus table.
+type ReservationStatus int64
+
+const (
+	StatusConfirmed ReservationStatus = 1
+	StatusCancelled ReservationStatus = 2
+	StatusPending   ReservationStatus = 3
+	StatusRejected  ReservationStatus = 4
+	StatusCompleted ReservationStatus = 5
+	StatusNoShow    ReservationStatus = 6
+	StatusHeld      ReservationStatus = 7
+)
+
+// statusTransitions lists the statuses each status may move to. Statuses
+// without an entry are final.
+var statusTransitions = map[ReservationStatus][]ReservationStatus{
+	StatusPending:   {StatusConfirmed, StatusRejected, StatusCancelled},
+	StatusConfirmed: {StatusCancelled, StatusCompleted, StatusNoShow},
+	StatusCompleted: {StatusNoShow},
+	StatusHeld:      {StatusConfirmed, StatusPending, StatusCancelled},
+}
+
+// CanTransitionTo reports whether the lifecycle allows a move from s to next
+func (s ReservationStatus) CanTransitionTo(next ReservationStatus) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether a reservation in this status holds its slot
+func (s ReservationStatus) IsActive() bool {
+	return s == StatusConfirmed || s == StatusPending || s == StatusHeld
+}
+
+// String returns a human readable name for the status
+func (s ReservationStatus) String() string {
+	switch s {
+	case StatusConfirmed:
+		return "Confirmed"
+	case StatusCancelled:
+		return "Cancelled"
+	case StatusPending:
+		return "Pending approval"
+	case StatusRejected:
+		return "Rejected"
+	case StatusCompleted:
+		return "Completed"
+	case StatusNoShow:
+		return "No-show"
+	case StatusHeld:
+		return "On hold"
+	default:
+		return "Unknown"
+	}
+}
@@ -5,6 +5,7 @@ package data
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
@@ -16,6 +17,7 @@ type Review struct {
 	CustomerName string    `json:"customer_name"`
 	VenueID      int64     `json:"venue_id"`
 	Comment      string    `json:"comment"`
+	Rating       int64     `json:"rating,omitempty"` // 1 to 5 stars, 0 when the reviewer gave none
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -23,6 +25,12 @@ type Review struct {
 func ValidateReview(v *validator.Validator, review *Review) {
 	v.Check(validator.NotBlank(review.Comment), "comment", "must be provided")
 	v.Check(validator.MaxLength(review.Comment, 500), "comment", "must not be more than 500 bytes long")
+	v.Check(review.Rating >= 0 && review.Rating <= 5, "rating", "must be between 1 and 5 stars")
+}
+
+// Stars draws the rating as five filled or empty stars
+func (r Review) Stars() string {
+	return strings.Repeat("★", int(r.Rating)) + strings.Repeat("☆", 5-int(r.Rating))
 }
 
 // ReviewModel holds the database connection and methods for handling venues
@@ -33,8 +41,8 @@ type ReviewModel struct {
 // Insert adds a new review record to the database
 func (m *ReviewModel) Insert(review *Review) error {
 	query := `
-		INSERT INTO review (customer, venue, comment, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO review (customer, venue, comment, rating, created_at)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -47,6 +55,7 @@ func (m *ReviewModel) Insert(review *Review) error {
 		review.CustomerID,
 		review.VenueID,
 		review.Comment,
+		sql.NullInt64{Int64: review.Rating, Valid: review.Rating != 0},
 		review.CreatedAt,
 	).Scan(&review.ID, &review.CreatedAt)
 }
@@ -54,7 +63,7 @@ func (m *ReviewModel) Insert(review *Review) error {
 // GetReviewByVenueID fetches reviews by venue ID
 func (m *ReviewModel) GetReviewByVenueID(venueID int64) ([]*Review, error) {
 	query := `
-		SELECT r.id, r.customer, u.name, r.venue, r.comment, r.created_at
+		SELECT r.id, r.customer, u.name, r.venue, r.comment, COALESCE(r.rating, 0), r.created_at
 		FROM review r
 		JOIN users u ON r.customer = u.id
 		WHERE r.venue = $1
@@ -76,6 +85,7 @@ func (m *ReviewModel) GetReviewByVenueID(venueID int64) ([]*Review, error) {
 			&r.CustomerName,
 			&r.VenueID,
 			&r.Comment,
+			&r.Rating,
 			&r.CreatedAt,
 		)
 		if err != nil {
@@ -0,0 +1,334 @@
+// Filename: internal/data/schedule.go
+// Description: Weekly opening hours and blackout dates for venues
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// minutesPerDay is the closing time of a venue that stays open until midnight
+const minutesPerDay = 24 * 60
+
+// OpeningHours is the time window a venue accepts bookings on one weekday,
+// in minutes after midnight. Closes may be 1440 for a venue open until midnight.
+type OpeningHours struct {
+	Weekday time.Weekday `json:"weekday"`
+	Opens   int          `json:"opens"`
+	Closes  int          `json:"closes"`
+}
+
+// OpensAt formats the opening time as HH:MM
+func (h OpeningHours) OpensAt() string {
+	return formatMinutes(h.Opens)
+}
+
+// ClosesAt formats the closing time as HH:MM, with midnight as 24:00
+func (h OpeningHours) ClosesAt() string {
+	return formatMinutes(h.Closes)
+}
+
+// ClosesAtInput formats the closing time for a time input, which writes
+// midnight as 00:00
+func (h OpeningHours) ClosesAtInput() string {
+	return formatMinutes(h.Closes % minutesPerDay)
+}
+
+// WeekdayHours is one row of the weekly schedule, including closed days
+type WeekdayHours struct {
+	OpeningHours
+	Open bool
+}
+
+// Blackout is a one-off period in which a venue takes no bookings
+type Blackout struct {
+	ID        int64     `json:"id"`
+	VenueID   int64     `json:"venue_id"`
+	StartAt   time.Time `json:"start_at"`
+	EndAt     time.Time `json:"end_at"`
+	Reason    string    `json:"reason"`
+	SourceID  int64     `json:"source_id,omitempty"` // the imported calendar it came from, if any
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsImported reports whether the blackout was synced from an external
+// calendar rather than added by the owner
+func (b Blackout) IsImported() bool {
+	return b.SourceID != 0
+}
+
+// Overlaps reports whether the blackout shares any time with start to end
+func (b Blackout) Overlaps(start, end time.Time) bool {
+	return b.StartAt.Before(end) && start.Before(b.EndAt)
+}
+
+func formatMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// ParseClock reads an HH:MM time from a form as minutes after midnight
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// weekOrder lists the weekdays the way the schedule is shown, Monday first
+var weekOrder = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday,
+	time.Friday, time.Saturday, time.Sunday,
+}
+
+// HoursFor returns the venue's opening hours on the given weekday
+func (venue *Venue) HoursFor(day time.Weekday) (OpeningHours, bool) {
+	for _, h := range venue.Hours {
+		if h.Weekday == day {
+			return h, true
+		}
+	}
+	return OpeningHours{}, false
+}
+
+// WeekHours returns all seven days of the venue's schedule, Monday first
+func (venue *Venue) WeekHours() []WeekdayHours {
+	week := make([]WeekdayHours, 0, len(weekOrder))
+	for _, day := range weekOrder {
+		h, open := venue.HoursFor(day)
+		if !open {
+			h = OpeningHours{Weekday: day, Opens: 9 * 60, Closes: 17 * 60}
+		}
+		week = append(week, WeekdayHours{OpeningHours: h, Open: open})
+	}
+	return week
+}
+
+// IsOpen reports whether the venue is open for the whole of start to end. A
+// venue without any opening hours is open all the time. Bookings that run
+// past midnight need the venue open until 24:00 and again from 00:00.
+func (venue *Venue) IsOpen(start, end time.Time) bool {
+	if len(venue.Hours) == 0 {
+		return true
+	}
+
+	for day := dayStart(start); day.Before(end); day = day.AddDate(0, 0, 1) {
+		from := int(maxTime(start, day).Sub(day) / time.Minute)
+		to := int(minTime(end, day.AddDate(0, 0, 1)).Sub(day) / time.Minute)
+
+		h, open := venue.HoursFor(day.Weekday())
+		if !open || from < h.Opens || to > h.Closes {
+			return false
+		}
+	}
+	return true
+}
+
+// BlackoutDuring returns the first of the venue's blackouts that overlaps
+// start to end, if any
+func (venue *Venue) BlackoutDuring(start, end time.Time) (*Blackout, bool) {
+	for _, b := range venue.Blackouts {
+		if b.Overlaps(start, end) {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// ValidateOpeningHours validates the weekly schedule from the venue edit page
+func ValidateOpeningHours(v *validator.Validator, hours []OpeningHours) {
+	for _, h := range hours {
+		v.Check(h.Opens < h.Closes, "hours", fmt.Sprintf("%s must close after it opens", h.Weekday))
+	}
+}
+
+// ValidateBlackout validates a blackout period added on the venue edit page
+func ValidateBlackout(v *validator.Validator, blackout *Blackout) {
+	v.Check(validator.IsDateSelected(blackout.StartAt), "blackout", "start must be provided")
+	v.Check(validator.IsDateSelected(blackout.EndAt), "blackout", "end must be provided")
+	v.Check(blackout.EndAt.After(blackout.StartAt), "blackout", "end must be after the start")
+	v.Check(validator.MaxLength(blackout.Reason, 200), "blackout", "reason must not be more than 200 bytes long")
+}
+
+// VenueScheduleModel holds the database connection and methods for handling
+// venue opening hours and blackout dates
+type VenueScheduleModel struct {
+	DB *sql.DB
+}
+
+// Load fills in the venue's opening hours and its blackouts that have not
+// yet ended
+func (m *VenueScheduleModel) Load(venue *Venue) error {
+	hours, err := m.GetHours(venue.ID)
+	if err != nil {
+		return err
+	}
+	blackouts, err := m.GetBlackouts(venue.ID)
+	if err != nil {
+		return err
+	}
+
+	venue.Hours = hours
+	venue.Blackouts = blackouts
+	return nil
+}
+
+// GetHours retrieves the venue's weekly opening hours
+func (m *VenueScheduleModel) GetHours(venueID int64) ([]OpeningHours, error) {
+	query := `
+		SELECT weekday, extract(epoch FROM opens_at)::int / 60, extract(epoch FROM closes_at)::int / 60
+		FROM venue_hours
+		WHERE venue = $1
+		ORDER BY weekday`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hours []OpeningHours
+	for rows.Next() {
+		var h OpeningHours
+		err := rows.Scan(&h.Weekday, &h.Opens, &h.Closes)
+		if err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+
+	return hours, rows.Err()
+}
+
+// SetHours replaces the venue's weekly opening hours. An empty schedule
+// means the venue can be booked at any time.
+func (m *VenueScheduleModel) SetHours(venueID int64, hours []OpeningHours) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM venue_hours WHERE venue = $1`, venueID)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hours {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO venue_hours (venue, weekday, opens_at, closes_at) VALUES ($1, $2, $3::time, $4::time)`,
+			venueID, int(h.Weekday), h.OpensAt(), h.ClosesAt(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetBlackouts retrieves the venue's blackouts that have not yet ended,
+// soonest first
+func (m *VenueScheduleModel) GetBlackouts(venueID int64) ([]*Blackout, error) {
+	query := `
+		SELECT id, venue, start_at, end_at, reason, COALESCE(source, 0), created_at
+		FROM venue_blackout
+		WHERE venue = $1 AND end_at > NOW()
+		ORDER BY start_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blackouts []*Blackout
+	for rows.Next() {
+		b := &Blackout{}
+		err := rows.Scan(&b.ID, &b.VenueID, &b.StartAt, &b.EndAt, &b.Reason, &b.SourceID, &b.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		blackouts = append(blackouts, b)
+	}
+
+	return blackouts, rows.Err()
+}
+
+// InsertBlackout adds a blackout period to a venue
+func (m *VenueScheduleModel) InsertBlackout(blackout *Blackout) error {
+	query := `
+		INSERT INTO venue_blackout (venue, start_at, end_at, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(
+		ctx,
+		query,
+		blackout.VenueID,
+		blackout.StartAt,
+		blackout.EndAt,
+		blackout.Reason,
+	).Scan(&blackout.ID, &blackout.CreatedAt)
+}
+
+// DeleteBlackout removes one of the venue's blackouts. Imported blackouts
+// can't be removed this way because the next sync would bring them back.
+func (m *VenueScheduleModel) DeleteBlackout(blackoutID, venueID int64) error {
+	query := `
+		DELETE FROM venue_blackout
+		WHERE id = $1 AND venue = $2 AND source IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, blackoutID, venueID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,495 @@
+// Filename: internal/data/series.go
+// Description: Recurring reservations expanded into individual bookings
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Recurrence frequencies
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// MaxOccurrences caps how many bookings one series may create
+const MaxOccurrences = 100
+
+// Recurrence describes how a booking repeats, modelled on an iCalendar RRULE.
+// Exactly one of Until or Count ends the series. Exceptions are dates that
+// the pattern would produce but should be skipped.
+type Recurrence struct {
+	Frequency  string      `json:"frequency"`
+	Interval   int         `json:"interval"`
+	Until      time.Time   `json:"until,omitempty"`
+	Count      int         `json:"count,omitempty"`
+	Exceptions []time.Time `json:"exceptions,omitempty"`
+}
+
+// ReservationSeries links the reservations made from one recurring booking
+type ReservationSeries struct {
+	ID         int64      `json:"id"`
+	VenueID    int64      `json:"venue_id"`
+	CustomerID int64      `json:"customer_id"`
+	Recurrence Recurrence `json:"recurrence"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// SeriesConflictError is returned when some occurrences of a series clash
+// with existing bookings. It matches ErrReservationConflict with errors.Is.
+type SeriesConflictError struct {
+	Dates []time.Time
+}
+
+func (e *SeriesConflictError) Error() string {
+	return fmt.Sprintf("models: %d occurrences conflict with existing bookings", len(e.Dates))
+}
+
+func (e *SeriesConflictError) Unwrap() error {
+	return ErrReservationConflict
+}
+
+// ValidateRecurrence validates the repeat options from the reservation form
+func ValidateRecurrence(v *validator.Validator, rec *Recurrence, start time.Time) {
+	v.Check(rec.Frequency == FrequencyDaily || rec.Frequency == FrequencyWeekly || rec.Frequency == FrequencyMonthly,
+		"repeat", "must be daily, weekly or monthly")
+	v.Check(rec.Interval >= 1 && rec.Interval <= 12, "interval", "must be between 1 and 12")
+
+	v.Check(rec.Until.IsZero() != (rec.Count == 0), "repeat_end", "choose either an end date or a number of occurrences")
+	if rec.Count != 0 {
+		v.Check(rec.Count >= 2 && rec.Count <= MaxOccurrences, "repeat_end", fmt.Sprintf("number of occurrences must be between 2 and %d", MaxOccurrences))
+	}
+	if !rec.Until.IsZero() {
+		v.Check(rec.Until.After(start), "repeat_end", "end date must be after the first booking")
+		v.Check(rec.Until.Before(start.AddDate(1, 0, 1)), "repeat_end", "end date must be within a year of the first booking")
+	}
+}
+
+// step returns the start of occurrence n of a series beginning at start, and
+// false when that date does not exist, such as the 31st of a short month
+func (rec Recurrence) step(start time.Time, n int) (time.Time, bool) {
+	switch rec.Frequency {
+	case FrequencyDaily:
+		return start.AddDate(0, 0, n*rec.Interval), true
+	case FrequencyWeekly:
+		return start.AddDate(0, 0, 7*n*rec.Interval), true
+	default:
+		t := start.AddDate(0, n*rec.Interval, 0)
+		return t, t.Day() == start.Day()
+	}
+}
+
+// isException reports whether t falls on one of the exception dates
+func (rec Recurrence) isException(t time.Time) bool {
+	for _, e := range rec.Exceptions {
+		if e.Year() == t.Year() && e.YearDay() == t.YearDay() {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand turns the first booking into the full list of occurrences, each
+// lasting as long as the first. As with RRULE, Count includes occurrences
+// later removed as exceptions.
+func (rec Recurrence) Expand(first *Reservation) []*Reservation {
+	duration := first.EndAt.Sub(first.StartAt)
+
+	var occurrences []*Reservation
+	for _, start := range rec.starts(first.StartAt, time.Time{}, MaxOccurrences) {
+		occurrence := *first
+		occurrence.StartAt = start
+		occurrence.EndAt = start.Add(duration)
+		occurrences = append(occurrences, &occurrence)
+	}
+
+	return occurrences
+}
+
+// starts lists when each occurrence of a series beginning at first starts,
+// leaving out the exceptions. The series stops at Count or Until, once limit
+// occurrences have been generated, or at the first one starting after
+// horizon. A zero limit or horizon doesn't stop it, so a series with neither
+// Count nor Until needs one of them.
+func (rec Recurrence) starts(first, horizon time.Time, limit int) []time.Time {
+	untilEnd := rec.Until.AddDate(0, 0, 1)
+
+	var starts []time.Time
+	generated := 0
+	for n := 0; limit == 0 || generated < limit; n++ {
+		start, exists := rec.step(first, n)
+		if !rec.Until.IsZero() && !start.Before(untilEnd) {
+			break
+		}
+		if !horizon.IsZero() && start.After(horizon) {
+			break
+		}
+		if !exists {
+			continue
+		}
+		if rec.Count != 0 && generated == rec.Count {
+			break
+		}
+		generated++
+
+		if rec.isException(start) {
+			continue
+		}
+		starts = append(starts, start)
+	}
+
+	return starts
+}
+
+// RRule formats the recurrence as an iCalendar RRULE value
+func (rec Recurrence) RRule() string {
+	parts := []string{"FREQ=" + strings.ToUpper(rec.Frequency)}
+	if rec.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", rec.Interval))
+	}
+	if rec.Count != 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", rec.Count))
+	}
+	if !rec.Until.IsZero() {
+		parts = append(parts, "UNTIL="+rec.Until.Format("20060102"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// ValidateOccurrences checks every occurrence of a series against the venue's
+// opening hours, blackouts and advance-booking window, listing the dates that
+// fall outside them. The first booking is expected to have gone through
+// ValidateReservation.
+func ValidateOccurrences(v *validator.Validator, occurrences []*Reservation, venue *Venue) {
+	if len(occurrences) == 0 {
+		v.AddError("repeat", "does not produce any bookings")
+		return
+	}
+
+	latest, limited := venue.BookingWindowEnd(time.Now())
+
+	var unavailable, tooFar []string
+	for _, o := range occurrences {
+		_, blackedOut := venue.BlackoutDuring(o.StartAt, o.EndAt)
+		switch {
+		case limited && o.StartAt.After(latest):
+			tooFar = append(tooFar, o.StartAt.Format("Jan 02, 2006"))
+		case blackedOut || !venue.IsOpen(o.StartAt, o.EndAt):
+			unavailable = append(unavailable, o.StartAt.Format("Jan 02, 2006"))
+		}
+	}
+	if len(unavailable) > 0 {
+		v.AddError("repeat", "the venue is closed or unavailable on "+strings.Join(unavailable, ", ")+"; add these as exceptions")
+	}
+	if len(tooFar) > 0 {
+		v.AddError("repeat", fmt.Sprintf("the venue only takes bookings up to %d days ahead; end the series sooner", venue.AdvanceDays))
+	}
+}
+
+// InsertSeries records a recurring booking and all of its occurrences in one
+// transaction, so either every occurrence is booked or none are. The
+// occurrences are filled in with their ids and statuses.
+func (m *ReservationModel) InsertSeries(series *ReservationSeries, occurrences []*Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Look for clashes first so the customer hears about every one of them
+	var conflicts []time.Time
+	for _, o := range occurrences {
+		var clash bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM reservation r
+				JOIN venue v ON r.venue = v.id
+				WHERE r.venue = $1 AND r.status IN (1, 3, 7)
+				AND tstzrange(r.blocked_from, r.blocked_until, '[)') && tstzrange(
+					$2::timestamptz - make_interval(mins => v.buffer_before_minutes),
+					$3::timestamptz + make_interval(mins => v.buffer_after_minutes), '[)')
+			)`, series.VenueID, o.StartAt, o.EndAt).Scan(&clash)
+		if err != nil {
+			return err
+		}
+		if clash {
+			conflicts = append(conflicts, o.StartAt)
+		}
+	}
+	if len(conflicts) > 0 {
+		return &SeriesConflictError{Dates: conflicts}
+	}
+
+	rec := series.Recurrence
+	exceptions := make([]string, len(rec.Exceptions))
+	for i, e := range rec.Exceptions {
+		exceptions[i] = e.Format("2006-01-02")
+	}
+
+	query := `
+		INSERT INTO reservation_series (venue, customer, frequency, repeat_interval, until_date, occurrence_count, exceptions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::date[])
+		RETURNING id, created_at`
+
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		series.VenueID,
+		series.CustomerID,
+		rec.Frequency,
+		rec.Interval,
+		nullDate(rec.Until),
+		sql.NullInt64{Int64: int64(rec.Count), Valid: rec.Count != 0},
+		pq.Array(exceptions),
+	).Scan(&series.ID, &series.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO reservation (venue, customer, series_id, start_at, end_at, blocked_from, blocked_until,
+			guest_count, subtotal, tax, total, status, created_at, cancellation_policy, cancellation_tiers, was_confirmed)
+		SELECT v.id, $2, $3, $4, $5,
+			$4::timestamptz - make_interval(mins => v.buffer_before_minutes),
+			$5::timestamptz + make_interval(mins => v.buffer_after_minutes),
+			$6, $7, $8, $9, CASE WHEN v.auto_accept THEN $10::int ELSE $11::int END, $12,
+			v.cancellation_policy, v.cancellation_tiers, v.auto_accept
+		FROM venue v
+		WHERE v.id = $1
+		RETURNING id, status, blocked_from, blocked_until, created_at, cancellation_policy, cancellation_tiers`
+
+	var tiers string
+	for _, o := range occurrences {
+		o.SeriesID = series.ID
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			series.VenueID,
+			series.CustomerID,
+			series.ID,
+			o.StartAt,
+			o.EndAt,
+			o.GuestCount,
+			o.Subtotal,
+			o.Tax,
+			o.Total,
+			StatusConfirmed,
+			StatusPending,
+			time.Now(),
+		).Scan(&o.ID, &o.Status, &o.BlockedFrom, &o.BlockedUntil, &o.CreatedAt, &o.Cancellation, &tiers)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrRecordNotFound
+			}
+			if isOverlapViolation(err) {
+				return &SeriesConflictError{Dates: []time.Time{o.StartAt}}
+			}
+			return err
+		}
+		o.RefundTiers, err = ParseRefundTiers(tiers)
+		if err != nil {
+			return err
+		}
+	}
+
+	// One email covers the whole series
+	err = enqueueBookingEmails(ctx, tx, occurrences[0].ID, len(occurrences))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FetchSeriesFrom retrieves the customer's active occurrences in the same
+// series as the given reservation, starting with that reservation
+func (m *ReservationModel) FetchSeriesFrom(reservation *Reservation) ([]*Reservation, error) {
+	query := `
+		SELECT id, venue, customer, series_id, start_at, end_at, guest_count, total, status,
+			cancellation_policy, cancellation_tiers
+		FROM reservation
+		WHERE series_id = $1
+		AND customer = $2
+		AND start_at >= $3
+		AND status IN (1, 3)
+		ORDER BY start_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, reservation.SeriesID, reservation.CustomerID, reservation.StartAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var occurrences []*Reservation
+	for rows.Next() {
+		o := &Reservation{}
+		var tiers string
+		err := rows.Scan(&o.ID, &o.VenueID, &o.CustomerID, &o.SeriesID, &o.StartAt, &o.EndAt, &o.GuestCount, &o.Total, &o.Status,
+			&o.Cancellation, &tiers)
+		if err != nil {
+			return nil, err
+		}
+		o.RefundTiers, err = ParseRefundTiers(tiers)
+		if err != nil {
+			return nil, err
+		}
+		occurrences = append(occurrences, o)
+	}
+
+	return occurrences, rows.Err()
+}
+
+// UpdateSeries reschedules several occurrences of a series in one
+// transaction. They are moved in the direction of the shift so that no
+// occurrence lands on a sibling that has not moved yet. One email about the
+// change goes to the customer and owner, describing the first occurrence.
+func (m *ReservationModel) UpdateSeries(occurrences []*Reservation, shift time.Duration) error {
+	if len(occurrences) == 0 {
+		return ErrRecordNotFound
+	}
+
+	sorted := append([]*Reservation(nil), occurrences...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if shift > 0 {
+			return sorted[i].StartAt.After(sorted[j].StartAt)
+		}
+		return sorted[i].StartAt.Before(sorted[j].StartAt)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE reservation r
+		SET start_at = $1, end_at = $2,
+			blocked_from = $1::timestamptz - make_interval(mins => v.buffer_before_minutes),
+			blocked_until = $2::timestamptz + make_interval(mins => v.buffer_after_minutes),
+			guest_count = $3, subtotal = $4, tax = $5, total = $6,
+			revision = r.revision + 1, updated_at = NOW()
+		FROM venue v
+		WHERE r.venue = v.id
+		AND r.id = $7 AND r.customer = $8 AND r.status IN (1, 3)`
+
+	for _, o := range sorted {
+		result, err := tx.ExecContext(ctx, query, o.StartAt, o.EndAt, o.GuestCount, o.Subtotal, o.Tax, o.Total, o.ID, o.CustomerID)
+		if err != nil {
+			if isOverlapViolation(err) {
+				return &SeriesConflictError{Dates: []time.Time{o.StartAt}}
+			}
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+
+		err = forgetReminders(ctx, tx, o.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = enqueueChangeEmails(ctx, tx, occurrences[0].ID, EmailReservationUpdated, len(occurrences))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CancelSeriesFrom cancels the customer's reservation and every later active
+// occurrence in its series. Each occurrence is charged under the policy it was
+// booked under, by its own notice. The cancelled occurrences come back with
+// their fees and refunds.
+func (m *ReservationModel) CancelSeriesFrom(reservationID, customerID int64) ([]*Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT r.id, r.venue, r.start_at, r.end_at, r.total, r.status, r.cancellation_policy, r.cancellation_tiers
+		FROM reservation r
+		JOIN reservation first ON r.series_id = first.series_id AND r.customer = first.customer
+		WHERE first.id = $1
+		AND first.customer = $2
+		AND r.start_at >= first.start_at
+		AND r.status IN (1, 3)
+		ORDER BY r.start_at
+		FOR UPDATE OF r`
+
+	rows, err := tx.QueryContext(ctx, query, reservationID, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var occurrences []*Reservation
+	for rows.Next() {
+		o := &Reservation{CustomerID: customerID}
+		var tiers string
+		err := rows.Scan(&o.ID, &o.VenueID, &o.StartAt, &o.EndAt, &o.Total, &o.Status, &o.Cancellation, &tiers)
+		if err == nil {
+			o.RefundTiers, err = ParseRefundTiers(tiers)
+		}
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		occurrences = append(occurrences, o)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(occurrences) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	now := time.Now()
+	for _, o := range occurrences {
+		quote := o.CancellationPolicy().Quote(o, now)
+		err = cancelWithQuote(ctx, tx, o.ID, quote)
+		if err != nil {
+			return nil, err
+		}
+		o.Status = StatusCancelled
+		o.Fee = quote.Fee
+		o.Refund = quote.Refund
+	}
+
+	err = enqueueChangeEmails(ctx, tx, occurrences[0].ID, EmailReservationCancelled, len(occurrences))
+	if err != nil {
+		return nil, err
+	}
+
+	return occurrences, tx.Commit()
+}
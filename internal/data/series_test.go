@@ -0,0 +1,247 @@
+package data
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// day returns midnight UTC on the given date
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestRecurrenceExpand(t *testing.T) {
+	tests := []struct {
+		name  string
+		rec   Recurrence
+		start time.Time
+		want  []string
+	}{
+		{
+			name:  "daily count",
+			rec:   Recurrence{Frequency: FrequencyDaily, Interval: 1, Count: 3},
+			start: day(2026, 3, 30),
+			want:  []string{"2026-03-30", "2026-03-31", "2026-04-01"},
+		},
+		{
+			name:  "every other week",
+			rec:   Recurrence{Frequency: FrequencyWeekly, Interval: 2, Count: 3},
+			start: day(2026, 1, 5),
+			want:  []string{"2026-01-05", "2026-01-19", "2026-02-02"},
+		},
+		{
+			name:  "until includes its own day",
+			rec:   Recurrence{Frequency: FrequencyWeekly, Interval: 1, Until: day(2026, 1, 19)},
+			start: day(2026, 1, 5).Add(18 * time.Hour),
+			want:  []string{"2026-01-05", "2026-01-12", "2026-01-19"},
+		},
+		{
+			name:  "until between occurrences",
+			rec:   Recurrence{Frequency: FrequencyDaily, Interval: 2, Until: day(2026, 1, 8)},
+			start: day(2026, 1, 5),
+			want:  []string{"2026-01-05", "2026-01-07"},
+		},
+		{
+			name:  "monthly on the 31st skips short months",
+			rec:   Recurrence{Frequency: FrequencyMonthly, Interval: 1, Count: 4},
+			start: day(2026, 1, 31),
+			want:  []string{"2026-01-31", "2026-03-31", "2026-05-31", "2026-07-31"},
+		},
+		{
+			name:  "monthly on the 31st until",
+			rec:   Recurrence{Frequency: FrequencyMonthly, Interval: 1, Until: day(2026, 6, 30)},
+			start: day(2026, 1, 31),
+			want:  []string{"2026-01-31", "2026-03-31", "2026-05-31"},
+		},
+		{
+			name:  "monthly on the 29th in a leap year",
+			rec:   Recurrence{Frequency: FrequencyMonthly, Interval: 1, Count: 3},
+			start: day(2028, 1, 29),
+			want:  []string{"2028-01-29", "2028-02-29", "2028-03-29"},
+		},
+		{
+			name: "exceptions count towards count",
+			rec: Recurrence{Frequency: FrequencyDaily, Interval: 1, Count: 4,
+				Exceptions: []time.Time{day(2026, 1, 6), day(2026, 1, 8)}},
+			start: day(2026, 1, 5).Add(9 * time.Hour),
+			want:  []string{"2026-01-05", "2026-01-07"},
+		},
+		{
+			name:  "exception matches the date, not the time",
+			rec:   Recurrence{Frequency: FrequencyWeekly, Interval: 1, Count: 2, Exceptions: []time.Time{day(2026, 1, 12)}},
+			start: day(2026, 1, 5).Add(23 * time.Hour),
+			want:  []string{"2026-01-05"},
+		},
+		{
+			name:  "every occurrence an exception",
+			rec:   Recurrence{Frequency: FrequencyDaily, Interval: 1, Count: 1, Exceptions: []time.Time{day(2026, 1, 5)}},
+			start: day(2026, 1, 5),
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &Reservation{VenueID: 7, CustomerID: 3, StartAt: tt.start, EndAt: tt.start.Add(2 * time.Hour), GuestCount: 10}
+
+			var got []string
+			for _, o := range tt.rec.Expand(first) {
+				got = append(got, o.StartAt.Format("2006-01-02"))
+				if o.EndAt.Sub(o.StartAt) != 2*time.Hour {
+					t.Errorf("occurrence on %s lasts %v; want 2h", o.StartAt.Format("2006-01-02"), o.EndAt.Sub(o.StartAt))
+				}
+				if o.StartAt.Hour() != tt.start.Hour() {
+					t.Errorf("occurrence on %s starts at %d:00; want %d:00", o.StartAt.Format("2006-01-02"), o.StartAt.Hour(), tt.start.Hour())
+				}
+				if o.VenueID != 7 || o.CustomerID != 3 || o.GuestCount != 10 {
+					t.Errorf("occurrence on %s = %+v; want the first booking's venue, customer and guests", o.StartAt.Format("2006-01-02"), o)
+				}
+			}
+
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Fatalf("Expand = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceExpandMaxOccurrences(t *testing.T) {
+	start := day(2026, 1, 1)
+	first := &Reservation{StartAt: start, EndAt: start.Add(time.Hour)}
+
+	rec := Recurrence{Frequency: FrequencyDaily, Interval: 1, Until: start.AddDate(1, 0, 0)}
+	occurrences := rec.Expand(first)
+
+	if len(occurrences) != MaxOccurrences {
+		t.Fatalf("Expand made %d occurrences; want MaxOccurrences (%d)", len(occurrences), MaxOccurrences)
+	}
+	if last := occurrences[len(occurrences)-1].StartAt; !last.Equal(start.AddDate(0, 0, MaxOccurrences-1)) {
+		t.Errorf("last occurrence = %v; want %v", last, start.AddDate(0, 0, MaxOccurrences-1))
+	}
+}
+
+func TestRecurrenceExpandMaxOccurrencesCountsExceptions(t *testing.T) {
+	start := day(2026, 1, 1)
+	first := &Reservation{StartAt: start, EndAt: start.Add(time.Hour)}
+
+	rec := Recurrence{Frequency: FrequencyDaily, Interval: 1, Until: start.AddDate(1, 0, 0),
+		Exceptions: []time.Time{start.AddDate(0, 0, 1), start.AddDate(0, 0, 2)}}
+	occurrences := rec.Expand(first)
+
+	if len(occurrences) != MaxOccurrences-2 {
+		t.Fatalf("Expand made %d occurrences; want %d", len(occurrences), MaxOccurrences-2)
+	}
+}
+
+func TestValidateOccurrences(t *testing.T) {
+	// A Monday a few weeks ahead, so the advance-booking window can be tested
+	// against the real clock
+	now := time.Now().UTC()
+	monday := day(now.Year(), now.Month(), now.Day()).AddDate(0, 0, 14)
+	for monday.Weekday() != time.Monday {
+		monday = monday.AddDate(0, 0, 1)
+	}
+
+	weekly := func(n int) []*Reservation {
+		rec := Recurrence{Frequency: FrequencyWeekly, Interval: 1, Count: n}
+		start := monday.Add(10 * time.Hour)
+		return rec.Expand(&Reservation{StartAt: start, EndAt: start.Add(2 * time.Hour)})
+	}
+	daily := func(n int) []*Reservation {
+		rec := Recurrence{Frequency: FrequencyDaily, Interval: 1, Count: n}
+		start := monday.Add(10 * time.Hour)
+		return rec.Expand(&Reservation{StartAt: start, EndAt: start.Add(2 * time.Hour)})
+	}
+	weekdays := []OpeningHours{
+		{Weekday: time.Monday, Opens: 9 * 60, Closes: 17 * 60},
+		{Weekday: time.Tuesday, Opens: 9 * 60, Closes: 17 * 60},
+		{Weekday: time.Wednesday, Opens: 9 * 60, Closes: 17 * 60},
+		{Weekday: time.Thursday, Opens: 9 * 60, Closes: 17 * 60},
+		{Weekday: time.Friday, Opens: 9 * 60, Closes: 17 * 60},
+	}
+	date := func(t time.Time) string { return t.Format("Jan 02, 2006") }
+
+	tests := []struct {
+		name        string
+		venue       *Venue
+		occurrences []*Reservation
+		want        []string // parts of the error on "repeat", none when valid
+	}{
+		{
+			name:        "no rules",
+			venue:       &Venue{},
+			occurrences: weekly(4),
+		},
+		{
+			name:        "no occurrences",
+			venue:       &Venue{},
+			occurrences: nil,
+			want:        []string{"does not produce any bookings"},
+		},
+		{
+			name:        "open on every occurrence",
+			venue:       &Venue{Hours: weekdays},
+			occurrences: weekly(4),
+		},
+		{
+			name:        "closed at weekends",
+			venue:       &Venue{Hours: weekdays},
+			occurrences: daily(7),
+			want: []string{
+				date(monday.AddDate(0, 0, 5)) + ", " + date(monday.AddDate(0, 0, 6)),
+				"add these as exceptions",
+			},
+		},
+		{
+			name: "blackout on one occurrence",
+			venue: &Venue{Blackouts: []*Blackout{{
+				StartAt: monday.AddDate(0, 0, 14),
+				EndAt:   monday.AddDate(0, 0, 15),
+			}}},
+			occurrences: weekly(4),
+			want:        []string{"closed or unavailable on " + date(monday.AddDate(0, 0, 14)) + ";"},
+		},
+		{
+			name: "blackout between occurrences",
+			venue: &Venue{Blackouts: []*Blackout{{
+				StartAt: monday.AddDate(0, 0, 1),
+				EndAt:   monday.AddDate(0, 0, 6),
+			}}},
+			occurrences: weekly(4),
+		},
+		{
+			name:        "past the advance-booking window",
+			venue:       &Venue{AdvanceDays: 30},
+			occurrences: weekly(10),
+			want:        []string{"up to 30 days ahead"},
+		},
+		{
+			name:        "within the advance-booking window",
+			venue:       &Venue{AdvanceDays: 365},
+			occurrences: weekly(10),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.NewValidator()
+			ValidateOccurrences(v, tt.occurrences, tt.venue)
+
+			got, invalid := v.Errors["repeat"]
+			if len(tt.want) == 0 {
+				if invalid {
+					t.Fatalf("repeat error = %q; want none", got)
+				}
+				return
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(got, part) {
+					t.Errorf("repeat error = %q; want it to contain %q", got, part)
+				}
+			}
+		})
+	}
+}
@@ -11,7 +11,7 @@ import (
 )
 
 var (
-	// ErrRecordNotFound     = errors.New("models: no matching recod found")
+	ErrRecordNotFound     = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
 )
@@ -23,6 +23,7 @@ type Users struct {
 	Email          string    `json:"email"`
 	HashedPassword []byte    `json:"hashedpassword"`
 	Active         bool      `json:"active"`
+	Reminders      bool      `json:"reminders_enabled"`
 	CreatedAt      time.Time `json:"created_at"`
 }
 
@@ -119,7 +120,7 @@ func (m *UsersModel) Authenticate(email, password string) (int, error) {
 
 func (m *UsersModel) Get(id int) (*Users, error) {
 	query := `
-		SELECT id, name, email, role, password_hash, activated, created_at
+		SELECT id, name, email, role, password_hash, activated, reminders_enabled, created_at
 		FROM users
 		WHERE id = $1`
 
@@ -135,6 +136,7 @@ func (m *UsersModel) Get(id int) (*Users, error) {
 		&user.Role,
 		&user.HashedPassword,
 		&user.Active,
+		&user.Reminders,
 		&user.CreatedAt,
 	)
 
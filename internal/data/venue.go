@@ -5,27 +5,112 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/aiycoleman/VenueSystemTest2/internal/geo"
 	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
 )
 
 type Venue struct {
-	ID          int64     `json:"id"`
-	OwnerID     int64     `json:"owner"`
-	VenueName   string    `json:"venue_name"`
-	Description string    `json:"description"`
-	Location    string    `json:"location"`
-	Email       string    `json:"email"`
-	Price       float64   `json:"price_per_hour"`
-	MaxCapacity int64     `json:"max_capacity"`
-	Image       string    `json:"image_link"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID           int64        `json:"id"`
+	OwnerID      int64        `json:"owner"`
+	VenueName    string       `json:"venue_name"`
+	Description  string       `json:"description"`
+	Location     string       `json:"location"`
+	Email        string       `json:"email"`
+	Price        Money        `json:"price_per_hour"`
+	MaxCapacity  int64        `json:"max_capacity"`
+	ImageKey     string       `json:"image_key"` // the gallery's cover image, "" when there is none
+	AutoAccept   bool         `json:"auto_accept"`
+	BufferBefore int64        `json:"buffer_before_minutes"` // setup time kept free before each booking
+	BufferAfter  int64        `json:"buffer_after_minutes"`  // cleanup time kept free after each booking
+	MinDuration  int64        `json:"min_duration_minutes"`  // shortest booking, 0 for no minimum
+	MaxDuration  int64        `json:"max_duration_minutes"`  // longest booking, 0 for no maximum
+	SlotMinutes  int64        `json:"slot_minutes"`          // bookings start and last in steps of this, 0 for any minute
+	LeadHours    int64        `json:"min_lead_hours"`        // notice needed before a booking starts
+	AdvanceDays  int64        `json:"max_advance_days"`      // how far ahead bookings may start, 0 for no limit
+	Cancellation string       `json:"cancellation_policy"`
+	RefundTiers  []RefundTier `json:"refund_tiers,omitempty"` // only used by the custom policy
+	Coordinates  *geo.Point   `json:"coordinates,omitempty"`  // nil until the venue is placed on the map
+	CreatedAt    time.Time    `json:"created_at"`
+
+	// Filled in by Search: the average star rating and how many reviews
+	// gave one, and for keyword searches how well the venue matched and an
+	// extract of its description with the matching words marked
+	Rating      float64       `json:"rating,omitempty"`
+	RatingCount int64         `json:"rating_count,omitempty"`
+	Rank        float64       `json:"rank,omitempty"`
+	Snippet     []SnippetPart `json:"snippet,omitempty"`
+
+	// Filled in by Search when searching near a point: how far away the
+	// venue is in kilometres, nil if it hasn't been placed on the map
+	Distance *float64 `json:"distance_km,omitempty"`
+
+	// Filled in by VenueScheduleModel.Load
+	Hours     []OpeningHours `json:"hours,omitempty"`
+	Blackouts []*Blackout    `json:"blackouts,omitempty"`
+
+	// Filled in by VenueImageModel.Load, in gallery order
+	Images []*VenueImage `json:"images,omitempty"`
 
 	// Reviews []Review
 }
 
+// Sizes each uploaded image is stored in
+const (
+	ImageLarge  = "large"
+	ImageMedium = "medium"
+	ImageThumb  = "thumb"
+)
+
+// ImageKey names the stored copy of an uploaded image in one of its sizes
+func ImageKey(key, size string) string {
+	return key + "/" + size + ".jpg"
+}
+
+// ImageURL is where the venue's cover image is served in the given size, or
+// "" when it has none
+func (v Venue) ImageURL(size string) string {
+	if v.ImageKey == "" {
+		return ""
+	}
+	return "/images/" + ImageKey(v.ImageKey, size)
+}
+
+// Away describes how far away the venue is, e.g. "850 m" or "12.4 km", or
+// is empty when the distance isn't known
+func (v Venue) Away() string {
+	if v.Distance == nil {
+		return ""
+	}
+	metres := int(math.Round(*v.Distance*100)) * 10
+	if metres < 1000 {
+		return fmt.Sprintf("%d m", metres)
+	}
+	return fmt.Sprintf("%.1f km", *v.Distance)
+}
+
+// latLng splits the venue's coordinates into nullable latitude and
+// longitude for the database
+func (v *Venue) latLng() (sql.NullFloat64, sql.NullFloat64) {
+	if v.Coordinates == nil {
+		return sql.NullFloat64{}, sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: v.Coordinates.Lat, Valid: true}, sql.NullFloat64{Float64: v.Coordinates.Lng, Valid: true}
+}
+
+// scanCoordinates sets the venue's coordinates from nullable columns
+func (v *Venue) scanCoordinates(lat, lng sql.NullFloat64) {
+	v.Coordinates = nil
+	if lat.Valid && lng.Valid {
+		v.Coordinates = &geo.Point{Lat: lat.Float64, Lng: lng.Float64}
+	}
+}
+
 // ValidateVenue validates input from the venue form
 func ValidateVenue(v *validator.Validator, venue *Venue) {
 	v.Check(validator.NotBlank(venue.VenueName), "venue_name", "must be provided")
@@ -41,13 +126,21 @@ func ValidateVenue(v *validator.Validator, venue *Venue) {
 	v.Check(validator.IsValidEmail(venue.Email), "email", "invalid email address")
 	v.Check(validator.MaxLength(venue.Email, 100), "email", "must not be more than 100 bytes long")
 
-	v.Check(validator.NotFree(venue.Price), "price_per_hour", "must be greater than 0")
+	v.Check(venue.Price > 0, "price_per_hour", "must be greater than 0")
+	v.Check(venue.Price <= MaxPrice, "price_per_hour", "must not be more than "+MaxPrice.String())
 
 	v.Check(validator.NotZeroInt(venue.MaxCapacity), "max_capacity", "must be greater than 0")
 
-	v.Check(validator.NotBlank(venue.Image), "image_link", "must be provided")
-	v.Check(validator.MinLength(venue.Image, 10), "image_link", "must be at least 10 characters")
-	v.Check(validator.IsValidURL(venue.Image), "image_link", "must be a valid URL")
+	v.Check(venue.BufferBefore >= 0 && venue.BufferBefore <= 24*60, "buffer_before", "must be between 0 and 1440 minutes")
+	v.Check(venue.BufferAfter >= 0 && venue.BufferAfter <= 24*60, "buffer_after", "must be between 0 and 1440 minutes")
+
+	ValidateBookingRules(v, venue)
+	ValidateCancellationPolicy(v, venue)
+
+	if venue.Coordinates != nil {
+		v.Check(venue.Coordinates.Lat >= -90 && venue.Coordinates.Lat <= 90, "latitude", "must be between -90 and 90")
+		v.Check(venue.Coordinates.Lng >= -180 && venue.Coordinates.Lng <= 180, "longitude", "must be between -180 and 180")
+	}
 }
 
 // VenueModel holds the database connection and methods for handling venues
@@ -55,18 +148,29 @@ type VenueModel struct {
 	DB *sql.DB
 }
 
-// Insert adds a new venue record to the database
+// Insert adds a new venue record to the database. When the venue has an
+// image it is added as the cover of the venue's gallery.
 func (m *VenueModel) Insert(venue *Venue) error {
 	query := `
-		INSERT INTO venue (owner, name, description, location, email, price_per_hour, max_capacity, image_link, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO venue (owner, name, description, location, email, price_per_hour, max_capacity, auto_accept,
+			buffer_before_minutes, buffer_after_minutes, min_duration_minutes, max_duration_minutes, slot_minutes,
+			min_lead_hours, max_advance_days, cancellation_policy, cancellation_tiers, latitude, longitude, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
 		RETURNING id, created_at`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lat, lng := venue.latLng()
+
 	// Use QueryRowContext to assign the returned id and created_at
-	return m.DB.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		query,
 		venue.OwnerID,
@@ -76,28 +180,72 @@ func (m *VenueModel) Insert(venue *Venue) error {
 		venue.Email,
 		venue.Price,
 		venue.MaxCapacity,
-		venue.Image, // Assuming Image is stored as a byte slice (you'll need to convert it)
+		venue.AutoAccept,
+		venue.BufferBefore,
+		venue.BufferAfter,
+		venue.MinDuration,
+		venue.MaxDuration,
+		venue.SlotMinutes,
+		venue.LeadHours,
+		venue.AdvanceDays,
+		venue.Cancellation,
+		FormatRefundTiers(venue.RefundTiers),
+		lat,
+		lng,
 		venue.CreatedAt,
 	).Scan(&venue.ID, &venue.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if venue.ImageKey != "" {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO venue_images (venue, image_key, position, is_cover)
+			VALUES ($1, $2, 1, true)`, venue.ID, venue.ImageKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // GetVenueByID retrieves a venue by its ID from the database.
 func (m *VenueModel) GetVenueByID(id int) (*Venue, error) {
 	venue := &Venue{}
+	var tiers string
+	var lat, lng sql.NullFloat64
 	query := `
-		SELECT id, name, description, location, email, price_per_hour, max_capacity, image_link, created_at
-		FROM venue
-		WHERE id = $1`
+		SELECT v.id, v.owner, v.name, v.description, v.location, v.email, v.price_per_hour, v.max_capacity,
+			COALESCE(ci.image_key, ''), v.auto_accept, v.buffer_before_minutes, v.buffer_after_minutes,
+			v.min_duration_minutes, v.max_duration_minutes, v.slot_minutes, v.min_lead_hours, v.max_advance_days,
+			v.cancellation_policy, v.cancellation_tiers, v.latitude, v.longitude, v.created_at
+		FROM venue v
+		LEFT JOIN venue_images ci ON ci.venue = v.id AND ci.is_cover
+		WHERE v.id = $1`
 
 	err := m.DB.QueryRow(query, id).Scan(
 		&venue.ID,
+		&venue.OwnerID,
 		&venue.VenueName,
 		&venue.Description,
 		&venue.Location,
 		&venue.Email,
 		&venue.Price,
 		&venue.MaxCapacity,
-		&venue.Image,
+		&venue.ImageKey,
+		&venue.AutoAccept,
+		&venue.BufferBefore,
+		&venue.BufferAfter,
+		&venue.MinDuration,
+		&venue.MaxDuration,
+		&venue.SlotMinutes,
+		&venue.LeadHours,
+		&venue.AdvanceDays,
+		&venue.Cancellation,
+		&tiers,
+		&lat,
+		&lng,
 		&venue.CreatedAt,
 	)
 	if err != nil {
@@ -106,12 +254,22 @@ func (m *VenueModel) GetVenueByID(id int) (*Venue, error) {
 		}
 		return nil, err // Error fetching the venue
 	}
+	venue.scanCoordinates(lat, lng)
+
+	venue.RefundTiers, err = ParseRefundTiers(tiers)
+	if err != nil {
+		return nil, err
+	}
 	return venue, nil
 }
 
 // FetchAllVenues retrieves all venues from the database
 func (m *VenueModel) FetchAllVenues() ([]*Venue, error) {
-	query := `SELECT id, name, description, location, image_link FROM venue ORDER BY created_at DESC`
+	query := `
+		SELECT v.id, v.name, v.description, v.location, COALESCE(ci.image_key, '')
+		FROM venue v
+		LEFT JOIN venue_images ci ON ci.venue = v.id AND ci.is_cover
+		ORDER BY v.created_at DESC`
 
 	rows, err := m.DB.Query(query)
 	if err != nil {
@@ -122,7 +280,7 @@ func (m *VenueModel) FetchAllVenues() ([]*Venue, error) {
 	var venues []*Venue
 	for rows.Next() {
 		v := &Venue{}
-		err := rows.Scan(&v.ID, &v.VenueName, &v.Description, &v.Location, &v.Image)
+		err := rows.Scan(&v.ID, &v.VenueName, &v.Description, &v.Location, &v.ImageKey)
 		if err != nil {
 			return nil, err
 		}
@@ -137,20 +295,381 @@ func (m *VenueModel) FetchAllVenues() ([]*Venue, error) {
 	return venues, nil
 }
 
-// Update updates an existing venue record in the database
-func (m *VenueModel) Update(venue *Venue) error {
+// Sort orders of the venue listing
+const (
+	SortNewest       = "newest"
+	SortPriceLow     = "price"
+	SortPriceHigh    = "-price"
+	SortCapacityLow  = "capacity"
+	SortCapacityHigh = "-capacity"
+	SortRating       = "rating"
+	SortRelevance    = "relevance"
+	SortDistance     = "distance"
+)
+
+// venueSortOrders maps each sort order onto its ORDER BY clause. Only these
+// clauses are ever put into the query.
+var venueSortOrders = map[string]string{
+	SortNewest:       "v.created_at DESC",
+	SortPriceLow:     "v.price_per_hour ASC",
+	SortPriceHigh:    "v.price_per_hour DESC",
+	SortCapacityLow:  "v.max_capacity ASC",
+	SortCapacityHigh: "v.max_capacity DESC",
+	SortRating:       "rv.rating DESC NULLS LAST, rv.ratings DESC",
+	SortRelevance:    "rank DESC, v.created_at DESC",
+	SortDistance:     "d.distance ASC NULLS LAST",
+}
+
+// MaxSearchRadius is the widest radius, in kilometres, a venue search may
+// cover
+const MaxSearchRadius = 500
+
+// VenueFilters narrows and orders the venue listing. Zero values leave the
+// corresponding filter switched off.
+type VenueFilters struct {
+	Keyword     string // full-text search over the name, location and description
+	Location    string
+	MinCapacity int64
+	MaxCapacity int64
+	MinPrice    Money
+	MaxPrice    Money
+	Sort        string
+
+	// Near is the point distances are measured from. With RadiusKm only
+	// venues that close are kept; Box keeps only venues inside it instead.
+	Near     *geo.Point
+	RadiusKm float64
+	Box      *geo.Box
+
+	Filters
+}
+
+// ValidateVenueFilters checks the filters supplied in the query string
+func ValidateVenueFilters(v *validator.Validator, f VenueFilters) {
+	ValidateFilters(v, f.Filters)
+	v.Check(validator.MaxLength(f.Keyword, 100), "q", "must not be more than 100 bytes long")
+	v.Check(validator.MaxLength(f.Location, 100), "location", "must not be more than 100 bytes long")
+	v.Check(f.MinCapacity >= 0, "min_capacity", "must not be negative")
+	v.Check(f.MaxCapacity >= 0, "max_capacity", "must not be negative")
+	if f.MinCapacity > 0 && f.MaxCapacity > 0 {
+		v.Check(f.MaxCapacity >= f.MinCapacity, "max_capacity", "must not be less than the minimum")
+	}
+	v.Check(f.MinPrice >= 0, "min_price", "must not be negative")
+	v.Check(f.MaxPrice >= 0, "max_price", "must not be negative")
+	if f.MinPrice > 0 && f.MaxPrice > 0 {
+		v.Check(f.MaxPrice >= f.MinPrice, "max_price", "must not be less than the minimum")
+	}
+	v.Check(f.RadiusKm >= 0 && f.RadiusKm <= MaxSearchRadius, "radius", fmt.Sprintf("must be between 0 and %d km", MaxSearchRadius))
+	if f.RadiusKm > 0 {
+		v.Check(f.Near != nil, "near", "must be provided to search within a radius")
+	}
+	if f.Near != nil {
+		v.Check(f.Near.Valid(), "near", "must be a point on the map")
+	}
+	if f.Box != nil {
+		v.Check(f.Box.Valid(), "bbox", "must be an area on the map")
+		v.Check(f.RadiusKm == 0, "bbox", "cannot be combined with a radius")
+	}
+
+	_, ok := venueSortOrders[f.Sort]
+	v.Check(ok, "sort", "must be a valid sort order")
+	if f.Sort == SortDistance {
+		v.Check(f.Near != nil, "sort", "needs a location to measure distance from")
+	}
+}
+
+// searchArea is the box a venue search is limited to, if any: the one asked
+// for, or the one around the search radius
+func (f VenueFilters) searchArea() *geo.Box {
+	if f.Near != nil && f.RadiusKm > 0 {
+		b := f.Near.BoundingBox(f.RadiusKm)
+		return &b
+	}
+	return f.Box
+}
+
+// containsPattern turns s into an ILIKE pattern matching it anywhere, with
+// its own wildcard characters escaped
+func containsPattern(s string) string {
+	return "%" + escapePattern(s) + "%"
+}
+
+// escapePattern escapes the LIKE wildcard characters in s
+func escapePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// Markers ts_headline puts around matching words. They are control
+// characters that don't turn up in venue descriptions, so the snippet can be
+// split on them and escaped like any other text.
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// snippetOptions shapes the extracts returned by Search
+var snippetOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=30, MinWords=12, MaxFragments=2, FragmentDelimiter=\" … \"",
+	snippetStart, snippetStop)
+
+// SnippetPart is a run of text from a search snippet. Match is set on the
+// words that matched the search.
+type SnippetPart struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// parseSnippet splits a headline from ts_headline into plain and matching
+// runs of text
+func parseSnippet(headline string) []SnippetPart {
+	var parts []SnippetPart
+	for headline != "" {
+		start := strings.Index(headline, snippetStart)
+		if start < 0 {
+			parts = append(parts, SnippetPart{Text: headline})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, SnippetPart{Text: headline[:start]})
+		}
+		headline = headline[start+len(snippetStart):]
+
+		stop := strings.Index(headline, snippetStop)
+		if stop < 0 {
+			stop = len(headline)
+		}
+		parts = append(parts, SnippetPart{Text: headline[:stop], Match: true})
+		headline = strings.TrimPrefix(headline[stop:], snippetStop)
+	}
+	return parts
+}
+
+// Search retrieves one page of venues matching the filters, in the
+// requested order, along with each venue's average rating. The keyword is
+// searched as a web-style query ("quoted phrases", or, -excluded) over the
+// venue's name, location and description, and each match is ranked and
+// given a snippet of its description. Without a keyword every venue
+// matches. When searching near a point, each venue's haversine distance from
+// it is worked out; a radius search first narrows the venues down to the
+// box around the circle, so the coordinates index can be used, then keeps
+// those truly within the radius. Venues tied on the sort order keep a stable
+// order by ID.
+func (m *VenueModel) Search(filters VenueFilters) ([]*Venue, Metadata, error) {
+	// Only filter on the search column when there is a keyword, so the
+	// planner can use its index
+	match := "TRUE"
+	if filters.Keyword != "" {
+		match = "v.search @@ q"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), v.id, v.owner, v.name, v.description, v.location, v.price_per_hour, v.max_capacity,
+			COALESCE(ci.image_key, ''), v.created_at, COALESCE(rv.rating, 0), COALESCE(rv.ratings, 0),
+			ts_rank_cd(v.search, q) AS rank,
+			CASE WHEN numnode(q) = 0 THEN '' ELSE ts_headline('english', v.description, q, $2) END,
+			v.latitude, v.longitude, d.distance
+		FROM venue v
+		CROSS JOIN websearch_to_tsquery('english', $1) AS q
+		CROSS JOIN LATERAL (
+			SELECT 2 * %g * asin(least(1, sqrt(
+				power(sin(radians(v.latitude - $11::float8) / 2), 2) +
+				cos(radians($11::float8)) * cos(radians(v.latitude)) * power(sin(radians(v.longitude - $12::float8) / 2), 2)
+			))) AS distance
+		) d
+		LEFT JOIN (
+			SELECT venue, AVG(rating)::float8 AS rating, COUNT(rating) AS ratings
+			FROM review
+			GROUP BY venue
+		) rv ON rv.venue = v.id
+		LEFT JOIN venue_images ci ON ci.venue = v.id AND ci.is_cover
+		WHERE %s
+		AND ($3 = '' OR v.location ILIKE $4)
+		AND ($5 = 0 OR v.max_capacity >= $5)
+		AND ($6 = 0 OR v.max_capacity <= $6)
+		AND ($7::numeric = 0 OR v.price_per_hour >= $7::numeric)
+		AND ($8::numeric = 0 OR v.price_per_hour <= $8::numeric)
+		AND ($13::float8 = 0 OR d.distance <= $13::float8)
+		AND ($14::float8 IS NULL OR v.latitude BETWEEN $14::float8 AND $15::float8)
+		AND ($16::float8 IS NULL
+			OR ($16::float8 <= $17::float8 AND v.longitude BETWEEN $16::float8 AND $17::float8)
+			OR ($16::float8 > $17::float8 AND (v.longitude >= $16::float8 OR v.longitude <= $17::float8)))
+		ORDER BY %s, v.id
+		LIMIT $9 OFFSET $10`, geo.EarthRadiusKm, match, venueSortOrders[filters.Sort])
+
+	var nearLat, nearLng sql.NullFloat64
+	if filters.Near != nil {
+		nearLat = sql.NullFloat64{Float64: filters.Near.Lat, Valid: true}
+		nearLng = sql.NullFloat64{Float64: filters.Near.Lng, Valid: true}
+	}
+
+	// A box spanning every longitude only needs its latitudes checked
+	var minLat, maxLat, minLng, maxLng sql.NullFloat64
+	if area := filters.searchArea(); area != nil {
+		minLat = sql.NullFloat64{Float64: area.MinLat, Valid: true}
+		maxLat = sql.NullFloat64{Float64: area.MaxLat, Valid: true}
+		if area.MinLng > -180 || area.MaxLng < 180 {
+			minLng = sql.NullFloat64{Float64: area.MinLng, Valid: true}
+			maxLng = sql.NullFloat64{Float64: area.MaxLng, Valid: true}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(
+		ctx,
+		query,
+		filters.Keyword,
+		snippetOptions,
+		filters.Location,
+		containsPattern(filters.Location),
+		filters.MinCapacity,
+		filters.MaxCapacity,
+		filters.MinPrice,
+		filters.MaxPrice,
+		filters.limit(),
+		filters.offset(),
+		nearLat,
+		nearLng,
+		filters.RadiusKm,
+		minLat,
+		maxLat,
+		minLng,
+		maxLng,
+	)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var venues []*Venue
+	for rows.Next() {
+		v := &Venue{}
+		var headline string
+		var lat, lng, distance sql.NullFloat64
+		err := rows.Scan(&totalRecords, &v.ID, &v.OwnerID, &v.VenueName, &v.Description, &v.Location, &v.Price,
+			&v.MaxCapacity, &v.ImageKey, &v.CreatedAt, &v.Rating, &v.RatingCount, &v.Rank, &headline,
+			&lat, &lng, &distance)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		v.Snippet = parseSnippet(headline)
+		v.scanCoordinates(lat, lng)
+		if distance.Valid {
+			v.Distance = &distance.Float64
+		}
+		venues = append(venues, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return venues, metadata, nil
+}
+
+// Suggestion is an autocomplete suggestion for the venue search: a venue
+// name or a location
+type Suggestion struct {
+	Text string `json:"text"`
+	Kind string `json:"kind"` // "venue" or "location"
+}
+
+// Suggest returns up to limit venue names and up to limit locations that
+// start with prefix, ignoring case. Names come first.
+func (m *VenueModel) Suggest(prefix string, limit int) ([]Suggestion, error) {
 	query := `
-		UPDATE venue
-		SET name = $1, email = $2, description = $3, location = $4, price_per_hour = $5, max_capacity = $6, image_link = $7, created_at = $8
-		WHERE id = $9
-		RETURNING id`
+		(SELECT DISTINCT name, 'venue' FROM venue
+		WHERE lower(name) LIKE $1
+		ORDER BY name
+		LIMIT $2)
+		UNION ALL
+		(SELECT DISTINCT location, 'location' FROM venue
+		WHERE lower(location) LIKE $1
+		ORDER BY location
+		LIMIT $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, escapePattern(strings.ToLower(prefix))+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		err := rows.Scan(&s.Text, &s.Kind)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	return suggestions, rows.Err()
+}
+
+// BufferConflictError is returned when new setup or cleanup times would make
+// upcoming bookings at a venue overlap. It matches ErrReservationConflict
+// with errors.Is.
+type BufferConflictError struct {
+	Bookings []*Reservation
+}
 
+func (e *BufferConflictError) Error() string {
+	return fmt.Sprintf("models: %d bookings would overlap with the new buffers", len(e.Bookings))
+}
+
+func (e *BufferConflictError) Unwrap() error {
+	return ErrReservationConflict
+}
+
+// Update updates an existing venue record in the database. When the setup or
+// cleanup time changes, the time kept free around the venue's active
+// upcoming bookings changes with it, in the same transaction. A
+// BufferConflictError listing the bookings is returned when they would then
+// overlap. Only the owner of the venue may update it.
+func (m *VenueModel) Update(venue *Venue, ownerID int64) error {
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Execute the query and return the result
-	return m.DB.QueryRowContext(
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the venue and read its buffers as they were; no row comes back
+	// when the venue belongs to someone else
+	var bufferBefore, bufferAfter int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT buffer_before_minutes, buffer_after_minutes
+		FROM venue
+		WHERE id = $1 AND owner = $2
+		FOR UPDATE`, venue.ID, ownerID).Scan(&bufferBefore, &bufferAfter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	query := `
+		UPDATE venue
+		SET name = $1, email = $2, description = $3, location = $4, price_per_hour = $5, max_capacity = $6, auto_accept = $7,
+			buffer_before_minutes = $8, buffer_after_minutes = $9, min_duration_minutes = $10, max_duration_minutes = $11,
+			slot_minutes = $12, min_lead_hours = $13, max_advance_days = $14, cancellation_policy = $15,
+			cancellation_tiers = $16, created_at = $17, latitude = $18, longitude = $19
+		WHERE id = $20`
+
+	lat, lng := venue.latLng()
+
+	_, err = tx.ExecContext(
 		ctx,
 		query,
 		venue.VenueName,
@@ -159,23 +678,156 @@ func (m *VenueModel) Update(venue *Venue) error {
 		venue.Location,
 		venue.Price,
 		venue.MaxCapacity,
-		venue.Image,
+		venue.AutoAccept,
+		venue.BufferBefore,
+		venue.BufferAfter,
+		venue.MinDuration,
+		venue.MaxDuration,
+		venue.SlotMinutes,
+		venue.LeadHours,
+		venue.AdvanceDays,
+		venue.Cancellation,
+		FormatRefundTiers(venue.RefundTiers),
 		venue.CreatedAt,
+		lat,
+		lng,
 		venue.ID,
-	).Scan(&venue.ID)
+	)
+	if err != nil {
+		return err
+	}
+
+	if venue.BufferBefore != bufferBefore || venue.BufferAfter != bufferAfter {
+		err = rebuffer(ctx, tx, venue)
+		if err != nil {
+			if !isOverlapViolation(err) {
+				return err
+			}
+			// The transaction can't be used after the violation
+			tx.Rollback()
+			bookings, err := m.bufferConflicts(venue)
+			if err != nil {
+				return err
+			}
+			return &BufferConflictError{Bookings: bookings}
+		}
+	}
+
+	return tx.Commit()
 }
 
-// Delete deletes a venue record from the database by its ID
-func (m *VenueModel) Delete(venueID int64) error {
+// rebuffer works out again the time kept free around the venue's active
+// bookings that haven't ended, using its new buffers. The ranges are first
+// narrowed to the bookings themselves, so the exclusion constraint only
+// fails on overlaps the new buffers really cause and not on ones between a
+// new range and one not yet updated.
+func rebuffer(ctx context.Context, tx *sql.Tx, venue *Venue) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE reservation
+		SET blocked_from = start_at, blocked_until = end_at
+		WHERE venue = $1 AND status IN (1, 3, 7) AND end_at > NOW()`, venue.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE reservation
+		SET blocked_from = start_at - make_interval(mins => $2),
+			blocked_until = end_at + make_interval(mins => $3)
+		WHERE venue = $1 AND status IN (1, 3, 7) AND end_at > NOW()`,
+		venue.ID, venue.BufferBefore, venue.BufferAfter)
+	return err
+}
+
+// bufferConflicts lists the venue's active upcoming bookings that would
+// overlap another active booking if its new buffers were applied, earliest
+// first
+func (m *VenueModel) bufferConflicts(venue *Venue) ([]*Reservation, error) {
 	query := `
-		DELETE FROM venue
-		WHERE id = $1`
+		WITH active AS (
+			SELECT id, start_at, end_at, status,
+				CASE WHEN end_at > NOW() THEN start_at - make_interval(mins => $2) ELSE blocked_from END AS blocked_from,
+				CASE WHEN end_at > NOW() THEN end_at + make_interval(mins => $3) ELSE blocked_until END AS blocked_until
+			FROM reservation
+			WHERE venue = $1 AND status IN (1, 3, 7)
+		)
+		SELECT DISTINCT r.id, r.start_at, r.end_at, r.blocked_from, r.blocked_until, r.status
+		FROM active r
+		JOIN active o ON o.id <> r.id
+			AND tstzrange(o.blocked_from, o.blocked_until, '[)') && tstzrange(r.blocked_from, r.blocked_until, '[)')
+		WHERE r.end_at > NOW()
+		ORDER BY r.start_at, r.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
+	rows, err := m.DB.QueryContext(ctx, query, venue.ID, venue.BufferBefore, venue.BufferAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []*Reservation
+	for rows.Next() {
+		res := &Reservation{VenueID: venue.ID}
+		err := rows.Scan(&res.ID, &res.StartAt, &res.EndAt, &res.BlockedFrom, &res.BlockedUntil, &res.Status)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, res)
+	}
+
+	return bookings, rows.Err()
+}
+
+// Delete deletes a venue record from the database by its ID. Only the owner
+// of the venue may delete it. The keys of the images in the venue's gallery
+// are returned so the stored images can be removed too.
+func (m *VenueModel) Delete(venueID, ownerID int64) ([]string, error) {
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Execute the delete query
-	_, err := m.DB.ExecContext(ctx, query, venueID)
-	return err // Return any error that occurred during the delete operation
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Take the gallery out first, so the keys of its images come back
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM venue_images i
+		USING venue v
+		WHERE i.venue = v.id AND v.id = $1 AND v.owner = $2
+		RETURNING i.image_key`, venueID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		err := rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Execute the delete query; no row comes back when the venue belongs to
+	// someone else
+	var id int64
+	err = tx.QueryRowContext(ctx, `DELETE FROM venue WHERE id = $1 AND owner = $2 RETURNING id`, venueID, ownerID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return keys, tx.Commit()
 }
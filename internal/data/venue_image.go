@@ -0,0 +1,373 @@
+// Filename: internal/data/venue_image.go
+// Description: The gallery of images shown on a venue's page
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/aiycoleman/VenueSystemTest2/internal/validator"
+)
+
+// MaxVenueImages is how many images a venue's gallery may hold
+const MaxVenueImages = 20
+
+// ErrGalleryFull is returned when an image is added to a gallery that
+// already holds MaxVenueImages
+var ErrGalleryFull = errors.New("models: venue gallery is full")
+
+// VenueImage is one image in a venue's gallery. Images are shown in Position
+// order and exactly one of them, the cover, stands for the venue on the
+// listing.
+type VenueImage struct {
+	ID        int64     `json:"id"`
+	VenueID   int64     `json:"venue_id"`
+	Key       string    `json:"image_key"`
+	Caption   string    `json:"caption"`
+	Position  int       `json:"position"`
+	Cover     bool      `json:"is_cover"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// URL is where the image is served in the given size
+func (i VenueImage) URL(size string) string {
+	return "/images/" + ImageKey(i.Key, size)
+}
+
+// ValidateVenueImage validates a caption from the gallery on the venue edit
+// page
+func ValidateVenueImage(v *validator.Validator, image *VenueImage) {
+	v.Check(validator.MaxLength(image.Caption, 200), "gallery", "caption must not be more than 200 bytes long")
+}
+
+// VenueImageModel holds the database connection and methods for handling
+// venue galleries
+type VenueImageModel struct {
+	DB *sql.DB
+}
+
+// Load fills in the venue's gallery
+func (m *VenueImageModel) Load(venue *Venue) error {
+	images, err := m.GetForVenue(venue.ID)
+	if err != nil {
+		return err
+	}
+
+	venue.Images = images
+	return nil
+}
+
+// GetForVenue retrieves the images in the venue's gallery, in order
+func (m *VenueImageModel) GetForVenue(venueID int64) ([]*VenueImage, error) {
+	query := `
+		SELECT id, venue, image_key, caption, position, is_cover, created_at
+		FROM venue_images
+		WHERE venue = $1
+		ORDER BY position, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, venueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*VenueImage
+	for rows.Next() {
+		i := &VenueImage{}
+		err := rows.Scan(&i.ID, &i.VenueID, &i.Key, &i.Caption, &i.Position, &i.Cover, &i.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, i)
+	}
+
+	return images, rows.Err()
+}
+
+// lockGallery locks the venue's row so changes to its gallery are made one
+// at a time
+func lockGallery(ctx context.Context, tx *sql.Tx, venueID int64) error {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM venue WHERE id = $1 FOR UPDATE`, venueID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// Insert adds an image to the end of the venue's gallery. The first image
+// added to a gallery becomes its cover.
+func (m *VenueImageModel) Insert(image *VenueImage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockGallery(ctx, tx, image.VenueID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT count(*) FROM venue_images WHERE venue = $1`, image.VenueID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= MaxVenueImages {
+		return ErrGalleryFull
+	}
+
+	query := `
+		INSERT INTO venue_images (venue, image_key, caption, position, is_cover)
+		SELECT $1, $2, $3, COALESCE(max(position), 0) + 1, NOT COALESCE(bool_or(is_cover), false)
+		FROM venue_images
+		WHERE venue = $1
+		RETURNING id, position, is_cover, created_at`
+
+	err = tx.QueryRowContext(ctx, query, image.VenueID, image.Key, image.Caption).Scan(
+		&image.ID, &image.Position, &image.Cover, &image.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateCaption changes the caption of one of the venue's images
+func (m *VenueImageModel) UpdateCaption(image *VenueImage) error {
+	query := `
+		UPDATE venue_images
+		SET caption = $1
+		WHERE id = $2 AND venue = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, image.Caption, image.ID, image.VenueID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Move swaps one of the venue's images with its neighbour, the one before it
+// when earlier is true and the one after it otherwise. Moving the first image
+// earlier or the last one later leaves the gallery as it is.
+func (m *VenueImageModel) Move(imageID, venueID int64, earlier bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockGallery(ctx, tx, venueID)
+	if err != nil {
+		return err
+	}
+
+	var position int
+	err = tx.QueryRowContext(ctx, `SELECT position FROM venue_images WHERE id = $1 AND venue = $2`,
+		imageID, venueID).Scan(&position)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	query := `
+		SELECT id, position FROM venue_images
+		WHERE venue = $1 AND position > $2
+		ORDER BY position
+		LIMIT 1`
+	if earlier {
+		query = `
+			SELECT id, position FROM venue_images
+			WHERE venue = $1 AND position < $2
+			ORDER BY position DESC
+			LIMIT 1`
+	}
+
+	var neighbourID int64
+	var neighbourPosition int
+	err = tx.QueryRowContext(ctx, query, venueID, position).Scan(&neighbourID, &neighbourPosition)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE venue_images
+		SET position = CASE WHEN id = $1 THEN $4::int ELSE $3::int END
+		WHERE id IN ($1, $2)`, imageID, neighbourID, position, neighbourPosition)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetCover makes one of the venue's images its cover in place of the current
+// one
+func (m *VenueImageModel) SetCover(imageID, venueID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockGallery(ctx, tx, venueID)
+	if err != nil {
+		return err
+	}
+
+	// The old cover has to go first; a venue can't have two at once
+	_, err = tx.ExecContext(ctx, `
+		UPDATE venue_images
+		SET is_cover = false
+		WHERE venue = $1 AND is_cover AND id <> $2`, venueID, imageID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE venue_images
+		SET is_cover = true
+		WHERE id = $1 AND venue = $2`, imageID, venueID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes one of the venue's images and returns its key so the
+// stored image can be removed too. When the cover is removed the first of
+// the remaining images takes its place.
+func (m *VenueImageModel) Delete(imageID, venueID int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	err = lockGallery(ctx, tx, venueID)
+	if err != nil {
+		return "", err
+	}
+
+	var key string
+	var cover bool
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM venue_images
+		WHERE id = $1 AND venue = $2
+		RETURNING image_key, is_cover`, imageID, venueID).Scan(&key, &cover)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+
+	if cover {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE venue_images
+			SET is_cover = true
+			WHERE id = (
+				SELECT id FROM venue_images
+				WHERE venue = $1
+				ORDER BY position, id
+				LIMIT 1
+			)`, venueID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return key, tx.Commit()
+}
+
+// LinkedImage is an external image link an owner pasted before images were
+// uploaded and stored by the app
+type LinkedImage struct {
+	VenueID int64
+	Link    string
+}
+
+// GetLinkedImages lists the venues that still have an image link and nothing
+// in their gallery
+func (m *VenueImageModel) GetLinkedImages() ([]LinkedImage, error) {
+	query := `
+		SELECT v.id, v.image_link
+		FROM venue v
+		WHERE v.image_link IS NOT NULL AND v.image_link <> ''
+		AND NOT EXISTS (SELECT 1 FROM venue_images i WHERE i.venue = v.id)
+		ORDER BY v.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []LinkedImage
+	for rows.Next() {
+		var l LinkedImage
+		err := rows.Scan(&l.VenueID, &l.Link)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+
+	return links, rows.Err()
+}
+
+// ClearLink forgets a venue's image link once it has been imported
+func (m *VenueImageModel) ClearLink(venueID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE venue SET image_link = NULL WHERE id = $1`, venueID)
+	return err
+}
@@ -0,0 +1,416 @@
+// Filename: internal/data/waitlist.go
+// Description: Waitlist for time slots that are already booked
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrAlreadyWaitlisted is returned when a customer queues twice for the
+	// same slot
+	ErrAlreadyWaitlisted = errors.New("models: already on the waitlist for this slot")
+
+	// ErrOfferExpired is returned when a customer tries to claim a waitlist
+	// offer after its time ran out
+	ErrOfferExpired = errors.New("models: waitlist offer has expired")
+)
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered"
+	WaitlistClaimed = "claimed"
+	WaitlistExpired = "expired"
+	WaitlistLeft    = "left"
+)
+
+// WaitlistEntry is a customer's place in the queue for a venue and time range
+type WaitlistEntry struct {
+	ID             int64     `json:"id"`
+	VenueID        int64     `json:"venue_id"`
+	CustomerID     int64     `json:"customer_id"`
+	StartAt        time.Time `json:"start_at"`
+	EndAt          time.Time `json:"end_at"`
+	GuestCount     int64     `json:"guest_count"`
+	Status         string    `json:"status"`
+	OfferExpiresAt time.Time `json:"offer_expires_at,omitempty"` // zero unless an offer has been made
+	CreatedAt      time.Time `json:"created_at"`
+
+	// Filled in when listing a customer's entries
+	VenueName string `json:"venue_name,omitempty"`
+	Position  int    `json:"position,omitempty"` // 1 for the front of the queue
+}
+
+// IsOffered reports whether the slot is currently being offered to the
+// customer
+func (e *WaitlistEntry) IsOffered() bool {
+	return e.Status == WaitlistOffered && time.Now().Before(e.OfferExpiresAt)
+}
+
+// Reservation returns the booking the customer would get by claiming the entry
+func (e *WaitlistEntry) Reservation() *Reservation {
+	return &Reservation{
+		VenueID:    e.VenueID,
+		CustomerID: e.CustomerID,
+		StartAt:    e.StartAt,
+		EndAt:      e.EndAt,
+		GuestCount: e.GuestCount,
+	}
+}
+
+// WaitlistModel holds the database connection and methods for handling the
+// waitlist
+type WaitlistModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a customer to the back of the queue for a slot
+func (m *WaitlistModel) Insert(entry *WaitlistEntry) error {
+	query := `
+		INSERT INTO waitlist (venue, customer, start_at, end_at, guest_count)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		entry.VenueID,
+		entry.CustomerID,
+		entry.StartAt,
+		entry.EndAt,
+		entry.GuestCount,
+	).Scan(&entry.ID, &entry.Status, &entry.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "waitlist_one_entry" {
+			return ErrAlreadyWaitlisted
+		}
+		return err
+	}
+
+	return nil
+}
+
+// FetchForCustomer retrieves the customer's waiting and offered entries for
+// slots that have not started yet, along with their place in each queue.
+// Only earlier entries for an overlapping slot count towards the position.
+func (m *WaitlistModel) FetchForCustomer(customerID int64) ([]*WaitlistEntry, error) {
+	query := `
+		SELECT w.id, w.venue, w.customer, w.start_at, w.end_at, w.guest_count, w.status,
+			COALESCE(w.offer_expires_at, 'epoch'), w.created_at, v.name,
+			1 + (
+				SELECT count(*) FROM waitlist a
+				WHERE a.venue = w.venue
+				AND a.status IN ('waiting', 'offered')
+				AND (a.created_at, a.id) < (w.created_at, w.id)
+				AND a.start_at < w.end_at AND a.end_at > w.start_at
+			)
+		FROM waitlist w
+		JOIN venue v ON w.venue = v.id
+		WHERE w.customer = $1
+		AND w.status IN ('waiting', 'offered')
+		AND w.start_at > NOW()
+		ORDER BY w.start_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*WaitlistEntry
+	for rows.Next() {
+		e := &WaitlistEntry{}
+		err := rows.Scan(&e.ID, &e.VenueID, &e.CustomerID, &e.StartAt, &e.EndAt, &e.GuestCount, &e.Status,
+			&e.OfferExpiresAt, &e.CreatedAt, &e.VenueName, &e.Position)
+		if err != nil {
+			return nil, err
+		}
+		if e.Status != WaitlistOffered {
+			e.OfferExpiresAt = time.Time{}
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Get retrieves one of the customer's waitlist entries
+func (m *WaitlistModel) Get(entryID, customerID int64) (*WaitlistEntry, error) {
+	query := `
+		SELECT id, venue, customer, start_at, end_at, guest_count, status,
+			COALESCE(offer_expires_at, 'epoch'), created_at
+		FROM waitlist
+		WHERE id = $1 AND customer = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	e := &WaitlistEntry{}
+	err := m.DB.QueryRowContext(ctx, query, entryID, customerID).Scan(
+		&e.ID, &e.VenueID, &e.CustomerID, &e.StartAt, &e.EndAt, &e.GuestCount, &e.Status,
+		&e.OfferExpiresAt, &e.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Leave takes the customer out of the queue. It returns the entry as it was,
+// so the caller can pass on a slot the customer was being offered.
+func (m *WaitlistModel) Leave(entryID, customerID int64) (*WaitlistEntry, error) {
+	query := `
+		UPDATE waitlist w
+		SET status = 'left'
+		FROM waitlist old
+		WHERE w.id = old.id
+		AND w.id = $1 AND w.customer = $2
+		AND w.status IN ('waiting', 'offered')
+		RETURNING old.id, old.venue, old.customer, old.start_at, old.end_at, old.guest_count, old.status,
+			COALESCE(old.offer_expires_at, 'epoch'), old.created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	e := &WaitlistEntry{}
+	err := m.DB.QueryRowContext(ctx, query, entryID, customerID).Scan(
+		&e.ID, &e.VenueID, &e.CustomerID, &e.StartAt, &e.EndAt, &e.GuestCount, &e.Status,
+		&e.OfferExpiresAt, &e.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// OfferNext offers freed time at a venue to the longest-waiting customer whose
+// slot overlaps start to end and is now completely free, taking the venue's
+// buffers and any other outstanding offers into account. The offer lasts for
+// ttl, and the customer is emailed about it once the offer is committed. It
+// returns nil when nobody in the queue can use the time.
+func (m *WaitlistModel) OfferNext(venueID int64, start, end time.Time, ttl time.Duration) (*WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Offers for one venue are made one at a time so two can't overlap
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, venueID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT w.id
+		FROM waitlist w
+		JOIN venue v ON w.venue = v.id
+		WHERE w.venue = $1
+		AND w.status = 'waiting'
+		AND w.start_at > NOW()
+		AND w.start_at < $3 AND w.end_at > $2
+		AND NOT EXISTS (
+			SELECT 1 FROM reservation r
+			WHERE r.venue = w.venue AND r.status IN (1, 3, 7)
+			AND tstzrange(r.blocked_from, r.blocked_until, '[)') && tstzrange(
+				w.start_at - make_interval(mins => v.buffer_before_minutes),
+				w.end_at + make_interval(mins => v.buffer_after_minutes), '[)')
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM waitlist o
+			WHERE o.venue = w.venue AND o.status = 'offered' AND o.offer_expires_at > NOW()
+			AND tstzrange(
+				o.start_at - make_interval(mins => v.buffer_before_minutes),
+				o.end_at + make_interval(mins => v.buffer_after_minutes), '[)') && tstzrange(
+				w.start_at - make_interval(mins => v.buffer_before_minutes),
+				w.end_at + make_interval(mins => v.buffer_after_minutes), '[)')
+		)
+		ORDER BY w.created_at, w.id
+		LIMIT 1
+		FOR UPDATE OF w`
+
+	var entryID int64
+	err = tx.QueryRowContext(ctx, query, venueID, start, end).Scan(&entryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	query = `
+		UPDATE waitlist
+		SET status = 'offered', offer_expires_at = NOW() + make_interval(secs => $2)
+		WHERE id = $1
+		RETURNING id, venue, customer, start_at, end_at, guest_count, status, offer_expires_at, created_at`
+
+	e := &WaitlistEntry{}
+	err = tx.QueryRowContext(ctx, query, entryID, ttl.Seconds()).Scan(
+		&e.ID, &e.VenueID, &e.CustomerID, &e.StartAt, &e.EndAt, &e.GuestCount, &e.Status,
+		&e.OfferExpiresAt, &e.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enqueueWaitlistOffer(ctx, tx, e.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, tx.Commit()
+}
+
+// OfferDuring returns an outstanding offer to another customer that clashes
+// with a booking from start to end at the venue, or nil if there is none.
+// Offered time is held for the customer it was offered to until the offer
+// runs out, buffers included, just as if it had been booked.
+func (m *WaitlistModel) OfferDuring(venueID int64, start, end time.Time, customerID int64) (*WaitlistEntry, error) {
+	query := `
+		SELECT w.id, w.venue, w.customer, w.start_at, w.end_at, w.guest_count, w.status,
+			w.offer_expires_at, w.created_at
+		FROM waitlist w
+		JOIN venue v ON w.venue = v.id
+		WHERE w.venue = $1
+		AND w.status = 'offered' AND w.offer_expires_at > NOW()
+		AND tstzrange(
+			w.start_at - make_interval(mins => v.buffer_before_minutes),
+			w.end_at + make_interval(mins => v.buffer_after_minutes), '[)') && tstzrange(
+			$2::timestamptz - make_interval(mins => v.buffer_before_minutes),
+			$3::timestamptz + make_interval(mins => v.buffer_after_minutes), '[)')
+		AND w.customer <> $4
+		ORDER BY w.offer_expires_at
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	e := &WaitlistEntry{}
+	err := m.DB.QueryRowContext(ctx, query, venueID, start, end, customerID).Scan(
+		&e.ID, &e.VenueID, &e.CustomerID, &e.StartAt, &e.EndAt, &e.GuestCount, &e.Status,
+		&e.OfferExpiresAt, &e.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Claim books the slot a customer has been offered. The reservation is
+// inserted and the entry marked claimed in one transaction, so an offer can
+// only be claimed once.
+func (m *WaitlistModel) Claim(entryID int64, reservation *Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var expiresAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, offer_expires_at
+		FROM waitlist
+		WHERE id = $1 AND customer = $2
+		FOR UPDATE`, entryID, reservation.CustomerID).Scan(&status, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if status == WaitlistExpired || (status == WaitlistOffered && !time.Now().Before(expiresAt.Time)) {
+		return ErrOfferExpired
+	}
+	if status != WaitlistOffered {
+		return ErrRecordNotFound
+	}
+
+	err = insertReservation(ctx, tx, reservation)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueBookingEmails(ctx, tx, reservation.ID, 1)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE waitlist SET status = 'claimed' WHERE id = $1`, entryID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ExpireOffers closes offers whose time has run out and returns them, so the
+// slots can be offered to the next customer in line. Entries for slots that
+// have already started are closed too.
+func (m *WaitlistModel) ExpireOffers() ([]*WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE waitlist
+		SET status = 'expired'
+		WHERE status = 'waiting' AND start_at <= NOW()`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		UPDATE waitlist
+		SET status = 'expired'
+		WHERE status = 'offered' AND offer_expires_at <= NOW()
+		RETURNING id, venue, customer, start_at, end_at, guest_count, status, offer_expires_at, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []*WaitlistEntry
+	for rows.Next() {
+		e := &WaitlistEntry{}
+		err := rows.Scan(&e.ID, &e.VenueID, &e.CustomerID, &e.StartAt, &e.EndAt, &e.GuestCount, &e.Status,
+			&e.OfferExpiresAt, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, e)
+	}
+
+	return expired, rows.Err()
+}
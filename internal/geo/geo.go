@@ -0,0 +1,106 @@
+// Filename: internal/geo/geo.go
+// Description: Points on the map and the areas searched around them
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadiusKm is the mean radius of the Earth used for distances
+const EarthRadiusKm = 6371.0
+
+// Point is a position in decimal degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Valid reports whether the point is on the map
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// Box is an area bounded by lines of latitude and longitude. MinLng is
+// greater than MaxLng when the box crosses the antimeridian.
+type Box struct {
+	MinLat float64 `json:"min_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// ParseBox reads a box written "minLng,minLat,maxLng,maxLat", the order
+// used by most map libraries
+func ParseBox(s string) (Box, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 4 {
+		return Box{}, fmt.Errorf("geo: a box needs four coordinates, got %d", len(fields))
+	}
+
+	var n [4]float64
+	for i, field := range fields {
+		f, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return Box{}, fmt.Errorf("geo: invalid coordinate %q", field)
+		}
+		n[i] = f
+	}
+
+	b := Box{MinLng: n[0], MinLat: n[1], MaxLng: n[2], MaxLat: n[3]}
+	if !b.Valid() {
+		return Box{}, fmt.Errorf("geo: box %q is off the map", s)
+	}
+	return b, nil
+}
+
+// Valid reports whether the box is on the map and not upside down
+func (b Box) Valid() bool {
+	return Point{b.MinLat, b.MinLng}.Valid() && Point{b.MaxLat, b.MaxLng}.Valid() && b.MinLat <= b.MaxLat
+}
+
+// BoundingBox is the smallest box holding every point within radiusKm of p.
+// It is used to narrow a radius search down with an index before the exact
+// distance is worked out. Near the poles it spans every longitude.
+func (p Point) BoundingBox(radiusKm float64) Box {
+	angle := radiusKm / EarthRadiusKm
+	lat := radians(p.Lat)
+
+	b := Box{
+		MinLat: degrees(lat - angle),
+		MaxLat: degrees(lat + angle),
+		MinLng: -180,
+		MaxLng: 180,
+	}
+	if b.MinLat <= -90 || b.MaxLat >= 90 {
+		b.MinLat = max(b.MinLat, -90)
+		b.MaxLat = min(b.MaxLat, 90)
+		return b
+	}
+
+	delta := degrees(math.Asin(math.Sin(angle) / math.Cos(lat)))
+	b.MinLng = wrapLng(p.Lng - delta)
+	b.MaxLng = wrapLng(p.Lng + delta)
+	return b
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// wrapLng brings a longitude back into -180 to 180
+func wrapLng(lng float64) float64 {
+	for lng < -180 {
+		lng += 360
+	}
+	for lng > 180 {
+		lng -= 360
+	}
+	return lng
+}
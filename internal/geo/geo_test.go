@@ -0,0 +1,136 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+// destination is the point distanceKm from p heading bearing degrees
+// clockwise from north, on the same sphere BoundingBox uses
+func destination(p Point, bearing, distanceKm float64) Point {
+	angle := distanceKm / EarthRadiusKm
+	lat, lng, brg := radians(p.Lat), radians(p.Lng), radians(bearing)
+
+	lat2 := math.Asin(math.Sin(lat)*math.Cos(angle) + math.Cos(lat)*math.Sin(angle)*math.Cos(brg))
+	lng2 := lng + math.Atan2(math.Sin(brg)*math.Sin(angle)*math.Cos(lat), math.Cos(angle)-math.Sin(lat)*math.Sin(lat2))
+	return Point{Lat: degrees(lat2), Lng: wrapLng(degrees(lng2))}
+}
+
+// contains reports whether the box holds p, allowing for rounding
+func (b Box) contains(p Point) bool {
+	const slack = 1e-9
+	if p.Lat < b.MinLat-slack || p.Lat > b.MaxLat+slack {
+		return false
+	}
+	if b.MinLng <= b.MaxLng {
+		return p.Lng >= b.MinLng-slack && p.Lng <= b.MaxLng+slack
+	}
+	return p.Lng >= b.MinLng-slack || p.Lng <= b.MaxLng+slack
+}
+
+func TestBoundingBox(t *testing.T) {
+	// A degree of latitude on the sphere BoundingBox uses
+	degreeKm := EarthRadiusKm * math.Pi / 180
+
+	tests := []struct {
+		name     string
+		p        Point
+		radiusKm float64
+		want     Box
+	}{
+		{
+			name: "on the equator", p: Point{Lat: 0, Lng: 10}, radiusKm: degreeKm,
+			want: Box{MinLat: -1, MinLng: 9, MaxLat: 1, MaxLng: 11},
+		},
+		{
+			name: "wider at higher latitudes", p: Point{Lat: 60, Lng: 10}, radiusKm: degreeKm,
+			want: Box{MinLat: 59, MinLng: 8.0002, MaxLat: 61, MaxLng: 11.9998},
+		},
+		{
+			name: "across the antimeridian, east side", p: Point{Lat: 0, Lng: 179.5}, radiusKm: degreeKm,
+			want: Box{MinLat: -1, MinLng: 178.5, MaxLat: 1, MaxLng: -179.5},
+		},
+		{
+			name: "across the antimeridian, west side", p: Point{Lat: -20, Lng: -179.8}, radiusKm: degreeKm / 2,
+			want: Box{MinLat: -20.5, MinLng: 179.6679, MaxLat: -19.5, MaxLng: -179.2679},
+		},
+		{
+			name: "reaching the north pole", p: Point{Lat: 89.5, Lng: 30}, radiusKm: degreeKm,
+			want: Box{MinLat: 88.5, MinLng: -180, MaxLat: 90, MaxLng: 180},
+		},
+		{
+			name: "reaching the south pole", p: Point{Lat: -89, Lng: -120}, radiusKm: 2 * degreeKm,
+			want: Box{MinLat: -90, MinLng: -180, MaxLat: -87, MaxLng: 180},
+		},
+		{
+			name: "at the pole", p: Point{Lat: 90, Lng: 0}, radiusKm: 10,
+			want: Box{MinLat: 90 - 10/degreeKm, MinLng: -180, MaxLat: 90, MaxLng: 180},
+		},
+		{
+			name: "close to the pole without reaching it", p: Point{Lat: 88, Lng: 0}, radiusKm: degreeKm,
+			want: Box{MinLat: 87, MinLng: -30.005, MaxLat: 89, MaxLng: 30.005},
+		},
+		{
+			name: "zero radius", p: Point{Lat: 51.5, Lng: -0.1}, radiusKm: 0,
+			want: Box{MinLat: 51.5, MinLng: -0.1, MaxLat: 51.5, MaxLng: -0.1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.p.BoundingBox(tt.radiusKm)
+
+			near := func(got, want float64) bool { return math.Abs(got-want) < 0.1 }
+			if !near(b.MinLat, tt.want.MinLat) || !near(b.MaxLat, tt.want.MaxLat) ||
+				!near(b.MinLng, tt.want.MinLng) || !near(b.MaxLng, tt.want.MaxLng) {
+				t.Fatalf("BoundingBox = %+v; want about %+v", b, tt.want)
+			}
+			if !b.Valid() {
+				t.Fatalf("BoundingBox = %+v, which is not a valid box", b)
+			}
+
+			// Every point on the circle must fall inside the box
+			for bearing := 0.0; bearing < 360; bearing += 5 {
+				edge := destination(tt.p, bearing, tt.radiusKm)
+				if !b.contains(edge) {
+					t.Errorf("%+v, %.0f km away at %.0f degrees, is outside %+v", edge, tt.radiusKm, bearing, b)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBox(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Box
+		err  bool
+	}{
+		{in: "-0.5,51.2,0.3,51.7", want: Box{MinLng: -0.5, MinLat: 51.2, MaxLng: 0.3, MaxLat: 51.7}},
+		{in: " -0.5 , 51.2 , 0.3 , 51.7 ", want: Box{MinLng: -0.5, MinLat: 51.2, MaxLng: 0.3, MaxLat: 51.7}},
+		{in: "170,-20,-170,-10", want: Box{MinLng: 170, MinLat: -20, MaxLng: -170, MaxLat: -10}},
+		{in: "-180,-90,180,90", want: Box{MinLng: -180, MinLat: -90, MaxLng: 180, MaxLat: 90}},
+		{in: "", err: true},
+		{in: "1,2,3", err: true},
+		{in: "1,2,3,4,5", err: true},
+		{in: "a,2,3,4", err: true},
+		{in: "1,2,3,", err: true},
+		{in: "0,91,1,92", err: true},
+		{in: "-181,0,1,1", err: true},
+		{in: "0,10,1,5", err: true},
+		{in: "NaN,0,1,1", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBox(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseBox(%q) = %+v; want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBox(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
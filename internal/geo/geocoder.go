@@ -0,0 +1,158 @@
+// Filename: internal/geo/geocoder.go
+// Description: Turning addresses into points on the map
+package geo
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned when an address can't be placed on the map
+var ErrNotFound = errors.New("geo: address not found")
+
+// Geocoder finds where an address is. Implementations must be safe to call
+// from several goroutines.
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (Point, error)
+}
+
+// Static geocodes from a fixed list of places, keyed by name, without
+// going over the network. An address matches a place when it is the place's
+// name or ends with it after a comma, so "12 Front Street, Springfield" is
+// found under "Springfield". Case and extra spaces are ignored.
+type Static map[string]Point
+
+// NewStatic builds a Static geocoder from places keyed by name
+func NewStatic(places map[string]Point) Static {
+	s := make(Static, len(places))
+	for name, p := range places {
+		s[normalizePlace(name)] = p
+	}
+	return s
+}
+
+// LoadStatic reads a Static geocoder from CSV rows of name, latitude and
+// longitude
+func LoadStatic(r io.Reader) (Static, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 3
+	cr.Comment = '#'
+
+	s := Static{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lat, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("geo: invalid latitude for %q: %w", record[0], err)
+		}
+		lng, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("geo: invalid longitude for %q: %w", record[0], err)
+		}
+		p := Point{Lat: lat, Lng: lng}
+		if !p.Valid() {
+			return nil, fmt.Errorf("geo: %q is off the map", record[0])
+		}
+		s[normalizePlace(record[0])] = p
+	}
+}
+
+// Geocode finds the address in the list, trying the whole address first and
+// then each shorter tail of it
+func (s Static) Geocode(ctx context.Context, address string) (Point, error) {
+	parts := strings.Split(address, ",")
+	for i := range parts {
+		if p, ok := s[normalizePlace(strings.Join(parts[i:], ","))]; ok {
+			return p, nil
+		}
+	}
+	return Point{}, ErrNotFound
+}
+
+// normalizePlace lowercases a place name and tidies its spacing
+func normalizePlace(name string) string {
+	parts := strings.Split(name, ",")
+	for i, part := range parts {
+		parts[i] = strings.Join(strings.Fields(strings.ToLower(part)), " ")
+	}
+	return strings.Join(parts, ",")
+}
+
+// Nominatim geocodes with a Nominatim search API, such as the one run by
+// OpenStreetMap. Public instances ask for an identifying User-Agent and no
+// more than one request a second.
+type Nominatim struct {
+	URL       string // e.g. "https://nominatim.openstreetmap.org/search"
+	UserAgent string
+	Client    *http.Client
+}
+
+// Geocode looks the address up and returns the best match
+func (g *Nominatim) Geocode(ctx context.Context, address string) (Point, error) {
+	u, err := url.Parse(g.URL)
+	if err != nil {
+		return Point{}, fmt.Errorf("geo: invalid geocoder URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("q", address)
+	q.Set("format", "jsonv2")
+	q.Set("limit", "1")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Point{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if g.UserAgent != "" {
+		req.Header.Set("User-Agent", g.UserAgent)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return Point{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Point{}, fmt.Errorf("geo: geocoder responded %s", resp.Status)
+	}
+
+	// Nominatim sends coordinates as strings
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&results)
+	if err != nil {
+		return Point{}, fmt.Errorf("geo: could not read the geocoder response: %w", err)
+	}
+	if len(results) == 0 {
+		return Point{}, ErrNotFound
+	}
+
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("geo: invalid latitude in geocoder response: %w", err)
+	}
+	lng, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("geo: invalid longitude in geocoder response: %w", err)
+	}
+	return Point{Lat: lat, Lng: lng}, nil
+}
@@ -0,0 +1,72 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStaticGeocode(t *testing.T) {
+	springfield := Point{Lat: 39.8, Lng: -89.6}
+	portland := Point{Lat: 45.5, Lng: -122.7}
+	portlandMaine := Point{Lat: 43.7, Lng: -70.3}
+
+	s := NewStatic(map[string]Point{
+		"Springfield":           springfield,
+		"Portland":              portland,
+		"Portland,  Maine":      portlandMaine,
+		"Front Street, Belfast": {Lat: 54.6, Lng: -5.9},
+	})
+
+	tests := []struct {
+		address string
+		want    Point
+		err     error
+	}{
+		{address: "Springfield", want: springfield},
+		{address: "  SPRINGFIELD ", want: springfield},
+		{address: "12 Front Street, Springfield", want: springfield},
+		{address: "Flat 2, 12 Front Street,Springfield", want: springfield},
+		{address: "1 Main St, Portland", want: portland},
+		{address: "1 Main St, Portland, Maine", want: portlandMaine},
+		{address: "1 Main St, portland ,  MAINE", want: portlandMaine},
+		{address: "Flat 2, Front Street, Belfast", want: Point{Lat: 54.6, Lng: -5.9}},
+		{address: "12 Front Street, Belfast", err: ErrNotFound},
+		{address: "Springfield Road, Belfast", err: ErrNotFound},
+		{address: "West Springfield", err: ErrNotFound},
+		{address: "Springfield, Illinois", err: ErrNotFound},
+		{address: "", err: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		got, err := s.Geocode(context.Background(), tt.address)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Geocode(%q) = %+v, %v; want %v", tt.address, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Geocode(%q) = %+v, %v; want %+v", tt.address, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadStatic(t *testing.T) {
+	s, err := LoadStatic(strings.NewReader("# name, lat, lng\nSpringfield, 39.8, -89.6\n\"Portland, Maine\",43.7,-70.3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Geocode(context.Background(), "1 Main St, Portland, Maine")
+	if err != nil || got != (Point{Lat: 43.7, Lng: -70.3}) {
+		t.Fatalf("Geocode = %+v, %v; want Portland, Maine", got, err)
+	}
+
+	for _, in := range []string{"Springfield,north,-89.6\n", "Springfield,39.8\n", "Nowhere,95,0\n"} {
+		if _, err := LoadStatic(strings.NewReader(in)); err == nil {
+			t.Errorf("LoadStatic(%q) succeeded; want an error", in)
+		}
+	}
+}
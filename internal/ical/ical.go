@@ -0,0 +1,148 @@
+// Filename: internal/ical/ical.go
+// Description: Writing calendars in the iCalendar format (RFC 5545)
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event statuses
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// prodID identifies this application as the producer of its calendars
+const prodID = "-//VenueSystem//Venue Reservations//EN"
+
+// maxLineOctets is the longest a content line may be before it is folded
+const maxLineOctets = 75
+
+// Calendar is a VCALENDAR object holding a list of events
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Event is a VEVENT. UID and Sequence let calendar apps match an event to the
+// copy they already have: the UID never changes and Sequence goes up whenever
+// the event does.
+type Event struct {
+	UID         string
+	Sequence    int64
+	Start       time.Time
+	End         time.Time
+	Created     time.Time
+	Modified    time.Time
+	Summary     string
+	Location    string
+	Description string
+	Status      string
+
+	// Transparent is set on parsed events that don't take up time, such as
+	// reminders. It is never written out.
+	Transparent bool
+
+	// Set on parsed events that repeat: the RRULE value as written, extra
+	// occurrences from RDATE and occurrences left out by EXDATE. An event
+	// with a RecurrenceID replaces the occurrence of the event with the same
+	// UID that starts then. None of these are written out.
+	RRule        string
+	RDates       []time.Time
+	ExDates      []time.Time
+	RecurrenceID time.Time
+}
+
+// Repeats reports whether the event has occurrences beyond its first
+func (e Event) Repeats() bool {
+	return e.RRule != "" || len(e.RDates) > 0
+}
+
+// Write writes the calendar to w with CRLF line endings, folding long lines
+func (c *Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", prodID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escapeText(c.Name))
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", formatTime(e.Modified))
+		line("DTSTART", formatTime(e.Start))
+		line("DTEND", formatTime(e.End))
+		line("SEQUENCE", strconv.FormatInt(e.Sequence, 10))
+		if !e.Created.IsZero() {
+			line("CREATED", formatTime(e.Created))
+		}
+		line("LAST-MODIFIED", formatTime(e.Modified))
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Location != "" {
+			line("LOCATION", escapeText(e.Location))
+		}
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.Status != "" {
+			line("STATUS", e.Status)
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// formatTime writes t as a UTC date-time, e.g. 20250102T150405Z
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeText escapes a TEXT value (RFC 5545 section 3.3.11)
+func escapeText(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		`;`, `\;`,
+		`,`, `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	)
+	return r.Replace(s)
+}
+
+// writeLine writes one content line, folding it onto continuation lines that
+// start with a space once it passes 75 octets. Lines are only broken between
+// characters so multi-byte UTF-8 sequences stay whole.
+func writeLine(w *bufio.Writer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+
+		// Continuation lines lose one octet to the leading space
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
@@ -0,0 +1,174 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// goldenCalendar is what testCalendar writes, with LF line endings standing
+// in for CRLF
+const goldenCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//VenueSystem//Venue Reservations//EN
+CALSCALE:GREGORIAN
+METHOD:PUBLISH
+X-WR-CALNAME:Bookings\; Main Hall\, Belize
+BEGIN:VEVENT
+UID:reservation-42@venuesystem
+DTSTAMP:20260112T083000Z
+DTSTART:20260215T000000Z
+DTEND:20260215T053000Z
+SEQUENCE:3
+CREATED:20260110T083000Z
+LAST-MODIFIED:20260112T083000Z
+SUMMARY:Wedding\; reception\, "Garcia" \\ family
+LOCATION:Main Hall\, 12 Front St.
+DESCRIPTION:Line one\nLine two\nLine three\nend
+STATUS:CONFIRMED
+END:VEVENT
+BEGIN:VEVENT
+UID:reservation-43@venuesystem
+DTSTAMP:20260110T083000Z
+DTSTART:20260215T090000Z
+DTEND:20260215T100000Z
+SEQUENCE:0
+LAST-MODIFIED:20260110T083000Z
+SUMMARY:Café meeting — über-long description follows to check folding o
+ n multi-byte characters
+DESCRIPTION:ééééééééééééééééééééééééééééééé
+ ééééééééééééééééééééééééééééééééééééé
+ ééééééééééééééééé€€€
+END:VEVENT
+END:VCALENDAR
+`
+
+func testCalendar() *Calendar {
+	created := time.Date(2026, 1, 10, 8, 30, 0, 0, time.UTC)
+	belize := time.FixedZone("CST", -6*60*60)
+
+	return &Calendar{
+		Name: "Bookings; Main Hall, Belize",
+		Events: []Event{
+			{
+				UID:         "reservation-42@venuesystem",
+				Sequence:    3,
+				Start:       time.Date(2026, 2, 14, 18, 0, 0, 0, belize),
+				End:         time.Date(2026, 2, 14, 23, 30, 0, 0, belize),
+				Created:     created,
+				Modified:    created.Add(48 * time.Hour),
+				Summary:     `Wedding; reception, "Garcia" \ family`,
+				Location:    "Main Hall, 12 Front St.",
+				Description: "Line one\nLine two\r\nLine three\rend",
+				Status:      StatusConfirmed,
+			},
+			{
+				UID:         "reservation-43@venuesystem",
+				Start:       time.Date(2026, 2, 15, 9, 0, 0, 0, time.UTC),
+				End:         time.Date(2026, 2, 15, 10, 0, 0, 0, time.UTC),
+				Modified:    created,
+				Summary:     "Café meeting — über-long description follows to check folding on multi-byte characters",
+				Description: strings.Repeat("é", 85) + "€€€",
+			},
+		},
+	}
+}
+
+func TestCalendarWrite(t *testing.T) {
+	var b bytes.Buffer
+	err := testCalendar().Write(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.ReplaceAll(goldenCalendar, "\n", "\r\n")
+	if got := b.String(); got != want {
+		t.Fatalf("Write produced\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCalendarWriteIsStable(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := testCalendar().Write(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := testCalendar().Write(&second); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.String() != second.String() {
+		t.Fatal("writing the same calendar twice gave different output")
+	}
+}
+
+func TestWriteLineFolding(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "short", line: "SUMMARY:Board meeting"},
+		{name: "exactly 75 octets", line: "SUMMARY:" + strings.Repeat("a", 67)},
+		{name: "76 octets", line: "SUMMARY:" + strings.Repeat("a", 68)},
+		{name: "two-byte characters across the fold", line: "SUMMARY:a" + strings.Repeat("é", 100)},
+		{name: "three-byte characters across the fold", line: "SUMMARY:" + strings.Repeat("€", 90)},
+		{name: "four-byte characters across the fold", line: "SUMMARY:ab" + strings.Repeat("🎉", 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			w := bufio.NewWriter(&b)
+			writeLine(w, tt.line)
+			w.Flush()
+			out := b.String()
+
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("output %q doesn't end in CRLF", out)
+			}
+			physical := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			for i, l := range physical {
+				if len(l) > maxLineOctets {
+					t.Errorf("line %d is %d octets; want at most %d", i, len(l), maxLineOctets)
+				}
+				if !utf8.ValidString(l) {
+					t.Errorf("line %d %q splits a UTF-8 sequence", i, l)
+				}
+				if strings.Contains(l, "\n") || strings.Contains(l, "\r") {
+					t.Errorf("line %d %q has a bare line break", i, l)
+				}
+				if i > 0 && !strings.HasPrefix(l, " ") {
+					t.Errorf("continuation line %d %q doesn't start with a space", i, l)
+				}
+			}
+			if len(tt.line) <= maxLineOctets && len(physical) != 1 {
+				t.Errorf("a %d-octet line was folded", len(tt.line))
+			}
+
+			if unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); unfolded != tt.line {
+				t.Errorf("unfolded output = %q; want %q", unfolded, tt.line)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "plain text", want: "plain text"},
+		{in: `back\slash`, want: `back\\slash`},
+		{in: "a;b,c", want: `a\;b\,c`},
+		{in: "one\ntwo\r\nthree\rfour", want: `one\ntwo\nthree\nfour`},
+		{in: `\n`, want: `\\n`},
+		{in: `colon: kept "quotes"`, want: `colon: kept "quotes"`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
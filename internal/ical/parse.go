@@ -0,0 +1,285 @@
+// Filename: internal/ical/parse.go
+// Description: Reading events out of iCalendar data (RFC 5545)
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxEvents is the most events Parse reads from one calendar
+const MaxEvents = 5000
+
+var (
+	ErrNotCalendar   = errors.New("ical: not an iCalendar file")
+	ErrTooManyEvents = errors.New("ical: too many events")
+)
+
+// Parse reads the VEVENTs from an iCalendar stream. Times keep the zone
+// named by their TZID, so repeating events follow its daylight saving
+// changes; UTC, floating and unknown-zone times are returned in UTC. All-day
+// events run from midnight to midnight. Events without a start are skipped,
+// as are any components nested inside events, such as alarms. Repeating
+// events come back once, with their RRULE, RDATE and EXDATE recorded for
+// the caller to expand.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events   []Event
+		event    *Event
+		duration time.Duration
+		hasEnd   bool
+		allDay   bool
+		depth    int
+		seenCal  bool
+	)
+
+	for _, line := range lines {
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			seenCal = true
+			continue
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT") && event == nil:
+			event = &Event{}
+			duration, hasEnd, allDay, depth = 0, false, false, 0
+			continue
+		case event == nil:
+			continue
+		case name == "BEGIN":
+			depth++
+			continue
+		case name == "END" && depth > 0:
+			depth--
+			continue
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if !event.Start.IsZero() {
+				if !hasEnd {
+					event.End = event.Start.Add(duration)
+					if duration == 0 && allDay {
+						event.End = event.Start.AddDate(0, 0, 1)
+					}
+				}
+				if len(events) == MaxEvents {
+					return nil, ErrTooManyEvents
+				}
+				events = append(events, *event)
+			}
+			event = nil
+			continue
+		case depth > 0:
+			continue
+		}
+
+		switch name {
+		case "UID":
+			event.UID = value
+		case "SUMMARY":
+			event.Summary = unescapeText(value)
+		case "LOCATION":
+			event.Location = unescapeText(value)
+		case "DESCRIPTION":
+			event.Description = unescapeText(value)
+		case "STATUS":
+			event.Status = strings.ToUpper(value)
+		case "TRANSP":
+			event.Transparent = strings.EqualFold(value, "TRANSPARENT")
+		case "SEQUENCE":
+			event.Sequence, _ = strconv.ParseInt(value, 10, 64)
+		case "DTSTART":
+			event.Start, allDay = parseTime(value, params)
+		case "DTEND":
+			event.End, _ = parseTime(value, params)
+			hasEnd = !event.End.IsZero()
+		case "DURATION":
+			duration = parseDuration(value)
+		case "RRULE":
+			event.RRule = strings.ToUpper(value)
+		case "RDATE":
+			event.RDates = append(event.RDates, parseTimes(value, params)...)
+		case "EXDATE":
+			event.ExDates = append(event.ExDates, parseTimes(value, params)...)
+		case "RECURRENCE-ID":
+			event.RecurrenceID, _ = parseTime(value, params)
+		}
+	}
+
+	if !seenCal {
+		return nil, ErrNotCalendar
+	}
+	return events, nil
+}
+
+// unfold reads the content lines, joining folded lines back together
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// splitLine splits a content line into its upper-cased name, its parameters
+// and its value. Colons inside quoted parameter values are not separators.
+func splitLine(line string) (name string, params map[string]string, value string, ok bool) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		}
+		if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params = make(map[string]string)
+	for _, p := range parts[1:] {
+		k, v, found := strings.Cut(p, "=")
+		if found {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+// parseTime reads a DATE or DATE-TIME value, reporting whether it was a date
+func parseTime(value string, params map[string]string) (time.Time, bool) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t, true
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t, false
+	}
+
+	loc := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, false
+}
+
+// parseTimes reads a comma-separated list of DATE or DATE-TIME values, as
+// used by RDATE and EXDATE. Values it can't read, such as periods, are
+// skipped.
+func parseTimes(value string, params map[string]string) []time.Time {
+	var times []time.Time
+	for _, v := range strings.Split(value, ",") {
+		t, _ := parseTime(strings.TrimSpace(v), params)
+		if !t.IsZero() {
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// parseDuration reads a DURATION value such as PT1H30M or P1D. Anything it
+// can't read is zero.
+func parseDuration(value string) time.Duration {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(value, "-"):
+		sign = -1
+		value = value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if !strings.HasPrefix(value, "P") {
+		return 0
+	}
+
+	var total time.Duration
+	num := 0
+	inTime := false
+	for _, c := range value[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			num = num*10 + int(c-'0')
+			continue
+		case c == 'T':
+			inTime = true
+		case c == 'W':
+			total += time.Duration(num) * 7 * 24 * time.Hour
+		case c == 'D':
+			total += time.Duration(num) * 24 * time.Hour
+		case c == 'H' && inTime:
+			total += time.Duration(num) * time.Hour
+		case c == 'M' && inTime:
+			total += time.Duration(num) * time.Minute
+		case c == 'S' && inTime:
+			total += time.Duration(num) * time.Second
+		default:
+			return 0
+		}
+		num = 0
+	}
+
+	return sign * total
+}
+
+// unescapeText reverses escapeText
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
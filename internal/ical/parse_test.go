@@ -0,0 +1,286 @@
+package ical
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // so TZID tests don't depend on the system's zone files
+)
+
+// crlf turns a calendar written with LF line endings into one with CRLF
+func crlf(s string) string {
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+const parseCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example//Bookings//EN
+BEGIN:VTIMEZONE
+TZID:America/New_York
+BEGIN:STANDARD
+DTSTART:19701101T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:folded@example.com
+DTSTART:20260301T150000Z
+DTEND:20260301T170000Z
+SUMMARY:A summary long enough that the exporting calendar folded it onto
+  a second line
+DESCRIPTION:Tab-folded\, with escapes\; and a\nnew line
+	 continued
+LOCATION:Room "A": upstairs
+END:VEVENT
+BEGIN:VEVENT
+UID:zoned@example.com
+DTSTART;TZID=America/New_York:20260310T090000
+DTEND;TZID="America/New_York":20260310T103000
+SUMMARY:Zoned
+END:VEVENT
+BEGIN:VEVENT
+UID:allday@example.com
+DTSTART;VALUE=DATE:20260320
+SUMMARY:All day
+END:VEVENT
+BEGIN:VEVENT
+UID:multiday@example.com
+DTSTART;VALUE=DATE:20260401
+DTEND;VALUE=DATE:20260404
+SUMMARY:Three days
+END:VEVENT
+BEGIN:VEVENT
+UID:duration@example.com
+DTSTART:20260402T080000Z
+DURATION:PT1H30M
+SUMMARY:By duration
+END:VEVENT
+BEGIN:VEVENT
+UID:alarm@example.com
+DTSTART:20260405T120000Z
+DTEND:20260405T130000Z
+SUMMARY:With an alarm
+STATUS:tentative
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+SUMMARY:Not the event's summary
+DESCRIPTION:Reminder
+DTSTART:20990101T000000Z
+END:VALARM
+TRANSP:TRANSPARENT
+END:VEVENT
+BEGIN:VEVENT
+UID:repeating@example.com
+DTSTART;TZID=America/New_York:20260302T180000
+DTEND;TZID=America/New_York:20260302T200000
+RRULE:freq=weekly;byday=MO,WE;count=6
+EXDATE;TZID=America/New_York:20260304T180000,20260309T180000
+RDATE;VALUE=DATE:20260315
+SEQUENCE:4
+SUMMARY:Weekly class
+END:VEVENT
+BEGIN:VEVENT
+UID:repeating@example.com
+RECURRENCE-ID;TZID=America/New_York:20260311T180000
+DTSTART;TZID=America/New_York:20260311T190000
+DTEND;TZID=America/New_York:20260311T210000
+SUMMARY:Weekly class (moved)
+END:VEVENT
+BEGIN:VEVENT
+UID:nostart@example.com
+SUMMARY:No start, skipped
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(crlf(parseCalendar)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byUID := map[string][]Event{}
+	var order []string
+	for _, e := range events {
+		byUID[e.UID] = append(byUID[e.UID], e)
+		order = append(order, e.UID)
+	}
+	wantOrder := "folded zoned allday multiday duration alarm repeating repeating"
+	if got := strings.ReplaceAll(strings.Join(order, " "), "@example.com", ""); got != wantOrder {
+		t.Fatalf("events = %s; want %s", got, wantOrder)
+	}
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	utc := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", s)
+		return t
+	}
+
+	t.Run("unfolding and escapes", func(t *testing.T) {
+		e := byUID["folded@example.com"][0]
+		if want := "A summary long enough that the exporting calendar folded it onto a second line"; e.Summary != want {
+			t.Errorf("Summary = %q; want %q", e.Summary, want)
+		}
+		if want := "Tab-folded, with escapes; and a\nnew line continued"; e.Description != want {
+			t.Errorf("Description = %q; want %q", e.Description, want)
+		}
+		if want := `Room "A": upstairs`; e.Location != want {
+			t.Errorf("Location = %q; want %q", e.Location, want)
+		}
+	})
+
+	t.Run("TZID", func(t *testing.T) {
+		e := byUID["zoned@example.com"][0]
+		if !e.Start.Equal(utc("2026-03-10 13:00")) || !e.End.Equal(utc("2026-03-10 14:30")) {
+			t.Errorf("Start, End = %v, %v; want 13:00 to 14:30 UTC", e.Start, e.End)
+		}
+		if e.Start.Location().String() != "America/New_York" {
+			t.Errorf("Start is in %v; want America/New_York", e.Start.Location())
+		}
+	})
+
+	t.Run("all-day", func(t *testing.T) {
+		e := byUID["allday@example.com"][0]
+		if !e.Start.Equal(utc("2026-03-20 00:00")) || !e.End.Equal(utc("2026-03-21 00:00")) {
+			t.Errorf("Start, End = %v, %v; want the whole of 20 March", e.Start, e.End)
+		}
+
+		e = byUID["multiday@example.com"][0]
+		if !e.Start.Equal(utc("2026-04-01 00:00")) || !e.End.Equal(utc("2026-04-04 00:00")) {
+			t.Errorf("Start, End = %v, %v; want 1 to 4 April", e.Start, e.End)
+		}
+	})
+
+	t.Run("DURATION", func(t *testing.T) {
+		e := byUID["duration@example.com"][0]
+		if !e.End.Equal(utc("2026-04-02 09:30")) {
+			t.Errorf("End = %v; want 09:30 UTC", e.End)
+		}
+	})
+
+	t.Run("nested VALARM", func(t *testing.T) {
+		e := byUID["alarm@example.com"][0]
+		if e.Summary != "With an alarm" || e.Description != "" {
+			t.Errorf("Summary, Description = %q, %q; the alarm's leaked into the event", e.Summary, e.Description)
+		}
+		if !e.Start.Equal(utc("2026-04-05 12:00")) {
+			t.Errorf("Start = %v; the alarm's DTSTART leaked into the event", e.Start)
+		}
+		if e.Status != StatusTentative {
+			t.Errorf("Status = %q; want %q", e.Status, StatusTentative)
+		}
+		if !e.Transparent {
+			t.Error("TRANSP after the alarm was not read")
+		}
+	})
+
+	t.Run("repeating", func(t *testing.T) {
+		e := byUID["repeating@example.com"][0]
+		if e.RRule != "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6" {
+			t.Errorf("RRule = %q", e.RRule)
+		}
+		if e.Sequence != 4 {
+			t.Errorf("Sequence = %d; want 4", e.Sequence)
+		}
+		if len(e.ExDates) != 2 || !e.ExDates[0].Equal(time.Date(2026, 3, 4, 18, 0, 0, 0, newYork)) ||
+			!e.ExDates[1].Equal(time.Date(2026, 3, 9, 18, 0, 0, 0, newYork)) {
+			t.Errorf("ExDates = %v", e.ExDates)
+		}
+		if len(e.RDates) != 1 || !e.RDates[0].Equal(utc("2026-03-15 00:00")) {
+			t.Errorf("RDates = %v", e.RDates)
+		}
+		if !e.Repeats() || !e.RecurrenceID.IsZero() {
+			t.Errorf("Repeats, RecurrenceID = %v, %v; want true and none", e.Repeats(), e.RecurrenceID)
+		}
+
+		moved := byUID["repeating@example.com"][1]
+		if !moved.RecurrenceID.Equal(time.Date(2026, 3, 11, 18, 0, 0, 0, newYork)) {
+			t.Errorf("RecurrenceID = %v", moved.RecurrenceID)
+		}
+		if moved.Repeats() {
+			t.Error("the moved occurrence repeats")
+		}
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want error
+	}{
+		{name: "empty", in: "", want: ErrNotCalendar},
+		{name: "html", in: "<html><body>Not found</body></html>", want: ErrNotCalendar},
+		{
+			name: "too many events",
+			in: "BEGIN:VCALENDAR\n" +
+				strings.Repeat("BEGIN:VEVENT\nDTSTART:20260101T000000Z\nEND:VEVENT\n", MaxEvents+1) +
+				"END:VCALENDAR\n",
+			want: ErrTooManyEvents,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(crlf(tt.in)))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Parse = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{in: "PT1H30M", want: 90 * time.Minute},
+		{in: "P1D", want: 24 * time.Hour},
+		{in: "P1DT12H", want: 36 * time.Hour},
+		{in: "P2W", want: 14 * 24 * time.Hour},
+		{in: "PT45S", want: 45 * time.Second},
+		{in: "+PT15M", want: 15 * time.Minute},
+		{in: "-PT15M", want: -15 * time.Minute},
+		{in: "P1H", want: 0},
+		{in: "1H", want: 0},
+		{in: "PT1X", want: 0},
+		{in: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseDuration(tt.in); got != tt.want {
+			t.Errorf("parseDuration(%q) = %v; want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseReadsWrite(t *testing.T) {
+	var b strings.Builder
+	if err := testCalendar().Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := Parse(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testCalendar().Events
+	if len(events) != len(want) {
+		t.Fatalf("read back %d events; want %d", len(events), len(want))
+	}
+	for i, e := range events {
+		w := want[i]
+		if e.UID != w.UID || e.Sequence != w.Sequence || !e.Start.Equal(w.Start) || !e.End.Equal(w.End) ||
+			e.Summary != w.Summary || e.Location != w.Location {
+			t.Errorf("event %d read back as %+v; want %+v", i, e, w)
+		}
+	}
+	if want := "Line one\nLine two\nLine three\nend"; events[0].Description != want {
+		t.Errorf("Description read back as %q; want %q", events[0].Description, want)
+	}
+}
@@ -0,0 +1,136 @@
+// Filename: internal/imaging/imaging.go
+// Description: Checking uploaded images and scaling them down to set sizes
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"io"
+	"net/http"
+)
+
+var (
+	// ErrUnsupported is returned for files that aren't JPEG, PNG or GIF
+	// images, whatever their name or declared type says
+	ErrUnsupported = errors.New("imaging: not a JPEG, PNG or GIF image")
+
+	// ErrTooLarge is returned for images with more than MaxPixels pixels
+	ErrTooLarge = errors.New("imaging: image dimensions are too large")
+)
+
+// MaxPixels caps the size of an image that will be decoded, so a small file
+// can't claim huge dimensions and use up memory. Decoding and scaling one
+// this size takes a few hundred MB.
+const MaxPixels = 16_000_000
+
+// JPEGQuality is the quality images are encoded at
+const JPEGQuality = 85
+
+// supported are the formats accepted, by their sniffed content type
+var supported = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Decode checks that b holds a supported image, by its content rather than
+// its name, and that it isn't too large before decoding it
+func Decode(b []byte) (image.Image, error) {
+	if !supported[http.DetectContentType(b)] {
+		return nil, ErrUnsupported
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if cfg.Width < 1 || cfg.Height < 1 {
+		return nil, ErrUnsupported
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	return img, nil
+}
+
+// Fit scales img down so neither side is longer than size, keeping its
+// shape. Images already small enough are copied at their own size; nothing
+// is scaled up. Transparent areas are filled with white, as JPEG has no
+// transparency.
+func Fit(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	src := flatten(img)
+	if w == b.Dx() && h == b.Dy() {
+		return src
+	}
+	return shrink(src, w, h)
+}
+
+// flatten copies img onto a white background
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// shrink scales src down to w by h, averaging the block of source pixels
+// behind each new pixel
+func shrink(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					bl += uint64(row[i+2])
+					a += uint64(row[i+3])
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8((r + n/2) / n)
+			dst.Pix[i+1] = uint8((g + n/2) / n)
+			dst.Pix[i+2] = uint8((bl + n/2) / n)
+			dst.Pix[i+3] = uint8((a + n/2) / n)
+		}
+	}
+
+	return dst
+}
+
+// EncodeJPEG writes img as a JPEG. Only the pixels are written, so any
+// metadata in the upload, such as where a photo was taken, is dropped.
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: JPEGQuality})
+}
@@ -0,0 +1,202 @@
+// Filename: internal/mailer/mailer.go
+// Description: Sending email over SMTP, or to the log when no server is set up
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is one email, with plain text and HTML versions of the same body
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends email. Implementations must be safe to call from several
+// goroutines.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTP sends email through an SMTP server. STARTTLS is used whenever the
+// server offers it, and the connection is authenticated when Username is set.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string // e.g. "Venue System <no-reply@example.com>"
+}
+
+// Send delivers msg, giving up when ctx is done
+func (m *SMTP) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(m.Sender)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid sender: %w", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid recipient: %w", err)
+	}
+
+	body, err := buildMessage(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.Host, strconv.Itoa(m.Port)))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: m.Host})
+		if err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(to.Address)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// buildMessage writes msg as a multipart/alternative email with CRLF line
+// endings, the plain text part first so clients that can show HTML prefer it
+func buildMessage(from, to *mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, p := range parts {
+		if p.body == "" {
+			continue
+		}
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = writeQuotedPrintable(pw, p.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable encodes body onto w
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qw := quotedprintable.NewWriter(w)
+	_, err := qw.Write([]byte(body))
+	if err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// messageID makes a unique Message-ID in the sender's domain
+func messageID(from *mail.Address) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	domain := "localhost"
+	if at := strings.LastIndexByte(from.Address, '@'); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
+
+// Log writes email to the logger instead of sending it, for development
+// without an SMTP server
+type Log struct {
+	Logger *slog.Logger
+}
+
+// Send logs msg
+func (m *Log) Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return errors.New("mailer: no recipient")
+	}
+	m.Logger.Info("email not sent, no SMTP server configured", "to", msg.To, "subject", msg.Subject, "body", msg.Text)
+	return nil
+}
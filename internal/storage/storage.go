@@ -0,0 +1,131 @@
+// Filename: internal/storage/storage.go
+// Description: Storing uploaded files as blobs, on the local disk or elsewhere
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	// ErrNotFound is returned when no blob is stored under a key
+	ErrNotFound = errors.New("storage: blob not found")
+
+	// ErrInvalidKey is returned for keys that aren't made of safe path
+	// segments
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// keyRX matches keys of slash-separated segments of letters, digits, dots,
+// dashes and underscores. Segments can't start with a dot, so a key can't
+// climb out of the store.
+var keyRX = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`)
+
+// ValidKey reports whether key can name a blob
+func ValidKey(key string) bool {
+	return len(key) <= 255 && keyRX.MatchString(key)
+}
+
+// BlobStore keeps blobs under keys such as "venues/3f9c/thumb.jpg".
+// Implementations must be safe to call from several goroutines.
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any blob already
+	// there. Readers never see a partly written blob.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Open returns the blob stored under key. The caller closes it.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the blob stored under key. Deleting a blob that
+	// doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Local stores blobs as files under a directory on the local disk
+type Local struct {
+	Root string
+}
+
+// path is where the blob for key is kept
+func (s *Local) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file beside its final place and then
+// renames it into place
+func (s *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Open opens the blob's file. The *os.File returned can seek, so it can be
+// served with http.ServeContent.
+func (s *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete removes the blob's file
+func (s *Local) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -111,3 +111,13 @@ func IsTimeInFuture(t time.Time) bool {
 func IsValidChoice(choice string) bool {
 	return choice == "1" || choice == "2"
 }
+
+// PermittedValue checks if value is one of the permitted values
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	for _, permitted := range permittedValues {
+		if value == permitted {
+			return true
+		}
+	}
+	return false
+}
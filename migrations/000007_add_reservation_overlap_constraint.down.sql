@@ -0,0 +1,3 @@
+-- Filename: migrations/000007_add_reservation_overlap_constraint.down.sql
+-- Bookings cancelled to make way for the constraint stay cancelled
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
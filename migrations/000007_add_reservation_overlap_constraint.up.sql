@@ -0,0 +1,41 @@
+-- Filename: migrations/000007_add_reservation_overlap_constraint.up.sql
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- Bookings made before the constraint may already overlap, which would stop
+-- it being added. The first one made keeps its slot and each later one that
+-- clashes with a booking still standing is cancelled, one at a time so a
+-- booking is only cancelled over one that is kept. An end time at or before
+-- the start time is an overnight booking that ends the next day.
+INSERT INTO reservationStatus (id, status)
+VALUES (2, 'cancelled')
+ON CONFLICT (id) DO NOTHING;
+
+DO $$
+DECLARE
+    clash bigint;
+BEGIN
+    LOOP
+        SELECT r.id INTO clash
+        FROM reservation r
+        JOIN reservation o ON o.venue = r.venue AND o.id < r.id AND o.status = 1
+        WHERE r.status = 1
+        AND tsrange(r.start_date + r.start_time,
+                r.start_date + CASE WHEN r.end_time > r.start_time THEN 0 ELSE 1 END + r.end_time, '[)') &&
+            tsrange(o.start_date + o.start_time,
+                o.start_date + CASE WHEN o.end_time > o.start_time THEN 0 ELSE 1 END + o.end_time, '[)')
+        ORDER BY r.id
+        LIMIT 1;
+
+        EXIT WHEN clash IS NULL;
+        UPDATE reservation SET status = 2 WHERE id = clash;
+    END LOOP;
+END $$;
+
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tsrange(start_date + start_time,
+            start_date + CASE WHEN end_time > start_time THEN 0 ELSE 1 END + end_time, '[)') WITH &&
+    )
+    WHERE (status = 1);
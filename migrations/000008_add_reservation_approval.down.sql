@@ -0,0 +1,17 @@
+-- Filename: migrations/000008_add_reservation_approval.down.sql
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
+UPDATE reservation SET status = 2 WHERE status IN (3, 4);
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tsrange(start_date + start_time, start_date + end_time, '[)') WITH &&
+    )
+    WHERE (status = 1);
+
+ALTER TABLE reservation DROP COLUMN IF EXISTS status_changed_at;
+ALTER TABLE reservation DROP COLUMN IF EXISTS status_reason;
+
+ALTER TABLE venue DROP COLUMN IF EXISTS auto_accept;
+
+DELETE FROM reservationStatus WHERE id IN (3, 4);
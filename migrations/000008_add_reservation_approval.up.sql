@@ -0,0 +1,21 @@
+-- Filename: migrations/000008_add_reservation_approval.up.sql
+INSERT INTO reservationStatus (id, status)
+VALUES (1, 'confirmed'), (2, 'cancelled'), (3, 'pending'), (4, 'rejected')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('reservationstatus', 'id'), (SELECT MAX(id) FROM reservationStatus));
+
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS auto_accept bool NOT NULL DEFAULT TRUE;
+
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS status_reason text NOT NULL DEFAULT '';
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS status_changed_at timestamp(0) WITH TIME ZONE;
+
+-- Pending requests hold their slot until the owner decides
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tsrange(start_date + start_time, start_date + end_time, '[)') WITH &&
+    )
+    WHERE (status IN (1, 3));
@@ -0,0 +1,3 @@
+-- Filename: migrations/000009_add_reservation_lifecycle_statuses.down.sql
+UPDATE reservation SET status = 1 WHERE status IN (5, 6);
+DELETE FROM reservationStatus WHERE id IN (5, 6);
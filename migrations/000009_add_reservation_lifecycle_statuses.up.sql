@@ -0,0 +1,6 @@
+-- Filename: migrations/000009_add_reservation_lifecycle_statuses.up.sql
+INSERT INTO reservationStatus (id, status)
+VALUES (5, 'completed'), (6, 'no-show')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('reservationstatus', 'id'), (SELECT MAX(id) FROM reservationStatus));
@@ -0,0 +1,33 @@
+-- Filename: migrations/000010_convert_reservation_to_time_range.down.sql
+DROP INDEX IF EXISTS reservation_customer_start_idx;
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_end_after_start;
+
+ALTER TABLE reservation ADD COLUMN start_date date;
+ALTER TABLE reservation ADD COLUMN start_time time;
+ALTER TABLE reservation ADD COLUMN end_time time;
+
+-- Multi-day bookings lose everything past their first day. Dates and times
+-- are taken in UTC, as the up migration reads them.
+UPDATE reservation
+SET start_date = (start_at AT TIME ZONE 'UTC')::date,
+    start_time = (start_at AT TIME ZONE 'UTC')::time,
+    end_time = CASE
+        WHEN (end_at AT TIME ZONE 'UTC')::date = (start_at AT TIME ZONE 'UTC')::date THEN (end_at AT TIME ZONE 'UTC')::time
+        ELSE '23:59:59'::time
+    END;
+
+ALTER TABLE reservation ALTER COLUMN start_date SET NOT NULL;
+ALTER TABLE reservation ALTER COLUMN start_time SET NOT NULL;
+ALTER TABLE reservation ALTER COLUMN end_time SET NOT NULL;
+
+ALTER TABLE reservation DROP COLUMN start_at;
+ALTER TABLE reservation DROP COLUMN end_at;
+
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tsrange(start_date + start_time, start_date + end_time, '[)') WITH &&
+    )
+    WHERE (status IN (1, 3));
@@ -0,0 +1,32 @@
+-- Filename: migrations/000010_convert_reservation_to_time_range.up.sql
+ALTER TABLE reservation ADD COLUMN start_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE reservation ADD COLUMN end_at timestamp(0) WITH TIME ZONE;
+
+-- An end time at or before the start time was an overnight booking. The
+-- dates and times are read as UTC, the app's default -timezone, rather than
+-- in whatever zone the migrating session happens to use.
+UPDATE reservation
+SET start_at = (start_date + start_time) AT TIME ZONE 'UTC',
+    end_at = CASE
+        WHEN end_time > start_time THEN (start_date + end_time) AT TIME ZONE 'UTC'
+        ELSE (start_date + 1 + end_time) AT TIME ZONE 'UTC'
+    END;
+
+ALTER TABLE reservation ALTER COLUMN start_at SET NOT NULL;
+ALTER TABLE reservation ALTER COLUMN end_at SET NOT NULL;
+ALTER TABLE reservation ADD CONSTRAINT reservation_end_after_start CHECK (end_at > start_at);
+
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
+ALTER TABLE reservation DROP COLUMN start_date;
+ALTER TABLE reservation DROP COLUMN start_time;
+ALTER TABLE reservation DROP COLUMN end_time;
+
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tstzrange(start_at, end_at, '[)') WITH &&
+    )
+    WHERE (status IN (1, 3));
+
+CREATE INDEX IF NOT EXISTS reservation_customer_start_idx ON reservation (customer, start_at);
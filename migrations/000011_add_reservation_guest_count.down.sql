@@ -0,0 +1,3 @@
+-- Filename: migrations/000011_add_reservation_guest_count.down.sql
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_guest_count_positive;
+ALTER TABLE reservation DROP COLUMN IF EXISTS guest_count;
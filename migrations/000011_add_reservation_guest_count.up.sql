@@ -0,0 +1,3 @@
+-- Filename: migrations/000011_add_reservation_guest_count.up.sql
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS guest_count int NOT NULL DEFAULT 1;
+ALTER TABLE reservation ADD CONSTRAINT reservation_guest_count_positive CHECK (guest_count > 0);
@@ -0,0 +1,4 @@
+-- Filename: migrations/000012_add_reservation_price.down.sql
+ALTER TABLE reservation DROP COLUMN IF EXISTS total;
+ALTER TABLE reservation DROP COLUMN IF EXISTS tax;
+ALTER TABLE reservation DROP COLUMN IF EXISTS subtotal;
@@ -0,0 +1,11 @@
+-- Filename: migrations/000012_add_reservation_price.up.sql
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS subtotal DECIMAL(12,2) NOT NULL DEFAULT 0;
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS tax DECIMAL(12,2) NOT NULL DEFAULT 0;
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS total DECIMAL(12,2) NOT NULL DEFAULT 0;
+
+-- Price existing bookings at the venue's current rate, without tax
+UPDATE reservation r
+SET subtotal = round(v.price_per_hour * extract(epoch FROM (r.end_at - r.start_at)) / 3600, 2),
+    total = round(v.price_per_hour * extract(epoch FROM (r.end_at - r.start_at)) / 3600, 2)
+FROM venue v
+WHERE r.venue = v.id;
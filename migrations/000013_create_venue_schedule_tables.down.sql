@@ -0,0 +1,3 @@
+-- Filename: migrations/000013_create_venue_schedule_tables.down.sql
+DROP TABLE IF EXISTS venue_blackout;
+DROP TABLE IF EXISTS venue_hours;
@@ -0,0 +1,24 @@
+-- Filename: migrations/000013_create_venue_schedule_tables.up.sql
+CREATE TABLE IF NOT EXISTS venue_hours (
+    id bigserial PRIMARY KEY,
+    venue int NOT NULL,
+    weekday smallint NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    opens_at time NOT NULL,
+    closes_at time NOT NULL,
+    FOREIGN KEY (venue) REFERENCES venue(id) ON DELETE CASCADE,
+    UNIQUE (venue, weekday),
+    CONSTRAINT venue_hours_close_after_open CHECK (closes_at > opens_at)
+);
+
+CREATE TABLE IF NOT EXISTS venue_blackout (
+    id bigserial PRIMARY KEY,
+    venue int NOT NULL,
+    start_at timestamp(0) WITH TIME ZONE NOT NULL,
+    end_at timestamp(0) WITH TIME ZONE NOT NULL,
+    reason text NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (venue) REFERENCES venue(id) ON DELETE CASCADE,
+    CONSTRAINT venue_blackout_end_after_start CHECK (end_at > start_at)
+);
+
+CREATE INDEX IF NOT EXISTS venue_blackout_venue_idx ON venue_blackout (venue, end_at);
@@ -0,0 +1,4 @@
+-- Filename: migrations/000014_create_reservation_series_table.down.sql
+DROP INDEX IF EXISTS reservation_series_id_idx;
+ALTER TABLE reservation DROP COLUMN IF EXISTS series_id;
+DROP TABLE IF EXISTS reservation_series;
@@ -0,0 +1,18 @@
+-- Filename: migrations/000014_create_reservation_series_table.up.sql
+CREATE TABLE IF NOT EXISTS reservation_series (
+    id bigserial PRIMARY KEY,
+    venue int NOT NULL,
+    customer int NOT NULL,
+    frequency text NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly')),
+    repeat_interval int NOT NULL DEFAULT 1 CHECK (repeat_interval > 0),
+    until_date date,
+    occurrence_count int,
+    exceptions date[] NOT NULL DEFAULT '{}',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (venue) REFERENCES venue(id) ON DELETE CASCADE,
+    FOREIGN KEY (customer) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT reservation_series_one_end CHECK ((until_date IS NULL) <> (occurrence_count IS NULL))
+);
+
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS series_id bigint REFERENCES reservation_series(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS reservation_series_id_idx ON reservation (series_id, start_at);
@@ -0,0 +1,17 @@
+-- Filename: migrations/000015_add_venue_buffers.down.sql
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tstzrange(start_at, end_at, '[)') WITH &&
+    )
+    WHERE (status IN (1, 3));
+
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_blocked_covers_booking;
+ALTER TABLE reservation DROP COLUMN IF EXISTS blocked_until;
+ALTER TABLE reservation DROP COLUMN IF EXISTS blocked_from;
+
+ALTER TABLE venue DROP CONSTRAINT IF EXISTS venue_buffers_not_negative;
+ALTER TABLE venue DROP COLUMN IF EXISTS buffer_after_minutes;
+ALTER TABLE venue DROP COLUMN IF EXISTS buffer_before_minutes;
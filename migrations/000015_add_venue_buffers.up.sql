@@ -0,0 +1,24 @@
+-- Filename: migrations/000015_add_venue_buffers.up.sql
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS buffer_before_minutes int NOT NULL DEFAULT 0;
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS buffer_after_minutes int NOT NULL DEFAULT 0;
+ALTER TABLE venue ADD CONSTRAINT venue_buffers_not_negative CHECK (buffer_before_minutes >= 0 AND buffer_after_minutes >= 0);
+
+-- The time a booking occupies, setup and cleanup included
+ALTER TABLE reservation ADD COLUMN blocked_from timestamp(0) WITH TIME ZONE;
+ALTER TABLE reservation ADD COLUMN blocked_until timestamp(0) WITH TIME ZONE;
+
+UPDATE reservation SET blocked_from = start_at, blocked_until = end_at;
+
+ALTER TABLE reservation ALTER COLUMN blocked_from SET NOT NULL;
+ALTER TABLE reservation ALTER COLUMN blocked_until SET NOT NULL;
+ALTER TABLE reservation ADD CONSTRAINT reservation_blocked_covers_booking
+    CHECK (blocked_from <= start_at AND blocked_until >= end_at);
+
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tstzrange(blocked_from, blocked_until, '[)') WITH &&
+    )
+    WHERE (status IN (1, 3));
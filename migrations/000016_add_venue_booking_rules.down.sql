@@ -0,0 +1,7 @@
+-- Filename: migrations/000016_add_venue_booking_rules.down.sql
+ALTER TABLE venue DROP CONSTRAINT IF EXISTS venue_booking_rules_valid;
+ALTER TABLE venue DROP COLUMN IF EXISTS max_advance_days;
+ALTER TABLE venue DROP COLUMN IF EXISTS min_lead_hours;
+ALTER TABLE venue DROP COLUMN IF EXISTS slot_minutes;
+ALTER TABLE venue DROP COLUMN IF EXISTS max_duration_minutes;
+ALTER TABLE venue DROP COLUMN IF EXISTS min_duration_minutes;
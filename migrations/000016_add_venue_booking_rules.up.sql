@@ -0,0 +1,16 @@
+-- Filename: migrations/000016_add_venue_booking_rules.up.sql
+-- A value of 0 means the venue has no rule of that kind
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS min_duration_minutes int NOT NULL DEFAULT 0;
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS max_duration_minutes int NOT NULL DEFAULT 0;
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS slot_minutes int NOT NULL DEFAULT 0;
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS min_lead_hours int NOT NULL DEFAULT 0;
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS max_advance_days int NOT NULL DEFAULT 0;
+
+ALTER TABLE venue ADD CONSTRAINT venue_booking_rules_valid CHECK (
+    min_duration_minutes >= 0
+    AND max_duration_minutes >= 0
+    AND (max_duration_minutes = 0 OR max_duration_minutes >= min_duration_minutes)
+    AND slot_minutes >= 0
+    AND min_lead_hours >= 0
+    AND max_advance_days >= 0
+);
@@ -0,0 +1,2 @@
+-- Filename: migrations/000017_create_waitlist_table.down.sql
+DROP TABLE IF EXISTS waitlist;
@@ -0,0 +1,26 @@
+-- Filename: migrations/000017_create_waitlist_table.up.sql
+CREATE TABLE IF NOT EXISTS waitlist (
+    id bigserial PRIMARY KEY,
+    venue int NOT NULL,
+    customer int NOT NULL,
+    start_at timestamp(0) WITH TIME ZONE NOT NULL,
+    end_at timestamp(0) WITH TIME ZONE NOT NULL,
+    guest_count int NOT NULL DEFAULT 1 CHECK (guest_count > 0),
+    status text NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'offered', 'claimed', 'expired', 'left')),
+    offer_expires_at timestamp(0) WITH TIME ZONE,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (venue) REFERENCES venue(id) ON DELETE CASCADE,
+    FOREIGN KEY (customer) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT waitlist_end_after_start CHECK (end_at > start_at),
+    CONSTRAINT waitlist_offer_has_expiry CHECK (status <> 'offered' OR offer_expires_at IS NOT NULL)
+);
+
+-- A customer can only queue once for the same slot
+CREATE UNIQUE INDEX IF NOT EXISTS waitlist_one_entry
+    ON waitlist (venue, customer, start_at, end_at)
+    WHERE status IN ('waiting', 'offered');
+
+CREATE INDEX IF NOT EXISTS waitlist_queue_idx
+    ON waitlist (venue, created_at)
+    WHERE status IN ('waiting', 'offered');
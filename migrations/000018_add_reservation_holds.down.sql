@@ -0,0 +1,17 @@
+-- Filename: migrations/000018_add_reservation_holds.down.sql
+UPDATE reservation SET status = 2, status_reason = 'Hold expired' WHERE status = 7;
+
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tstzrange(blocked_from, blocked_until, '[)') WITH &&
+    )
+    WHERE (status IN (1, 3));
+
+DROP INDEX IF EXISTS reservation_hold_expiry_idx;
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_hold_has_expiry;
+ALTER TABLE reservation DROP COLUMN IF EXISTS hold_expires_at;
+
+DELETE FROM reservationStatus WHERE id = 7;
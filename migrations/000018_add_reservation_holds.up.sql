@@ -0,0 +1,22 @@
+-- Filename: migrations/000018_add_reservation_holds.up.sql
+INSERT INTO reservationStatus (id, status)
+VALUES (7, 'held')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('reservationstatus', 'id'), (SELECT MAX(id) FROM reservationStatus));
+
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS hold_expires_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE reservation ADD CONSTRAINT reservation_hold_has_expiry
+    CHECK (status <> 7 OR hold_expires_at IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS reservation_hold_expiry_idx ON reservation (hold_expires_at) WHERE status = 7;
+
+-- Held slots are blocked just like pending and confirmed ones
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_no_overlap;
+ALTER TABLE reservation
+    ADD CONSTRAINT reservation_no_overlap
+    EXCLUDE USING gist (
+        venue WITH =,
+        tstzrange(blocked_from, blocked_until, '[)') WITH &&
+    )
+    WHERE (status IN (1, 3, 7));
@@ -0,0 +1,5 @@
+-- Filename: migrations/000019_add_cancellation_policies.down.sql
+ALTER TABLE reservation DROP COLUMN IF EXISTS refund_amount;
+ALTER TABLE reservation DROP COLUMN IF EXISTS cancellation_fee;
+ALTER TABLE venue DROP COLUMN IF EXISTS cancellation_tiers;
+ALTER TABLE venue DROP COLUMN IF EXISTS cancellation_policy;
@@ -0,0 +1,10 @@
+-- Filename: migrations/000019_add_cancellation_policies.up.sql
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS cancellation_policy text NOT NULL DEFAULT 'flexible'
+    CHECK (cancellation_policy IN ('flexible', 'moderate', 'strict', 'custom'));
+
+-- Custom refund tiers, e.g. '7d:100, 48h:50'
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS cancellation_tiers text NOT NULL DEFAULT '';
+
+-- What the customer paid and got back when the booking was cancelled
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS cancellation_fee DECIMAL(12,2) NOT NULL DEFAULT 0;
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS refund_amount DECIMAL(12,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Filename: migrations/000020_add_reservation_revision.down.sql
+ALTER TABLE reservation DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE reservation DROP COLUMN IF EXISTS revision;
@@ -0,0 +1,6 @@
+-- Filename: migrations/000020_add_reservation_revision.up.sql
+-- Bumped on every change so calendar feeds can tell apps an event was updated
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS revision integer NOT NULL DEFAULT 0;
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+UPDATE reservation SET updated_at = COALESCE(status_changed_at, created_at);
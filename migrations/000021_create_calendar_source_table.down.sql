@@ -0,0 +1,4 @@
+-- Filename: migrations/000021_create_calendar_source_table.down.sql
+DROP INDEX IF EXISTS venue_blackout_source_idx;
+ALTER TABLE venue_blackout DROP COLUMN IF EXISTS source;
+DROP TABLE IF EXISTS venue_calendar_source;
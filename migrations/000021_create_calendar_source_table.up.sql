@@ -0,0 +1,27 @@
+-- Filename: migrations/000021_create_calendar_source_table.up.sql
+-- External calendars whose events block time at a venue. A source is either
+-- a URL fetched on every sync or an uploaded file kept in content.
+CREATE TABLE IF NOT EXISTS venue_calendar_source (
+    id bigserial PRIMARY KEY,
+    venue int NOT NULL,
+    name text NOT NULL,
+    url text NOT NULL DEFAULT '',
+    content text NOT NULL DEFAULT '',
+    sync_status text NOT NULL DEFAULT 'pending',
+    last_error text NOT NULL DEFAULT '',
+    last_synced_at timestamp(0) WITH TIME ZONE,
+    event_count int NOT NULL DEFAULT 0,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (venue) REFERENCES venue(id) ON DELETE CASCADE,
+    CONSTRAINT venue_calendar_source_status CHECK (sync_status IN ('pending', 'ok', 'error')),
+    CONSTRAINT venue_calendar_source_has_data CHECK (url <> '' OR content <> '')
+);
+
+CREATE INDEX IF NOT EXISTS venue_calendar_source_venue_idx ON venue_calendar_source (venue);
+
+-- Blackouts created by a sync belong to their source and are replaced by the
+-- next one
+ALTER TABLE venue_blackout ADD COLUMN IF NOT EXISTS source bigint
+    REFERENCES venue_calendar_source(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS venue_blackout_source_idx ON venue_blackout (source);
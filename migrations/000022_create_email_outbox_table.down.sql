@@ -0,0 +1,2 @@
+-- Filename: migrations/000022_create_email_outbox_table.down.sql
+DROP TABLE IF EXISTS email_outbox;
@@ -0,0 +1,21 @@
+-- Filename: migrations/000022_create_email_outbox_table.up.sql
+-- Emails waiting to be sent. Rows are written in the same transaction as the
+-- reservation change they describe, so an email goes out exactly when the
+-- change is committed. The payload is a snapshot of the reservation taken at
+-- that moment.
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id bigserial PRIMARY KEY,
+    recipient citext NOT NULL,
+    template text NOT NULL,
+    payload jsonb NOT NULL DEFAULT '{}',
+    reservation bigint REFERENCES reservation(id) ON DELETE SET NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    next_attempt_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sent_at timestamp(0) WITH TIME ZONE,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT email_outbox_status CHECK (status IN ('pending', 'sent', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_due_idx ON email_outbox (next_attempt_at) WHERE status = 'pending';
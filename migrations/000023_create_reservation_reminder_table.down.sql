@@ -0,0 +1,5 @@
+-- Filename: migrations/000023_create_reservation_reminder_table.down.sql
+DROP INDEX IF EXISTS reservation_confirmed_start_idx;
+DROP TABLE IF EXISTS reservation_reminder;
+ALTER TABLE reservation DROP COLUMN IF EXISTS reminders_enabled;
+ALTER TABLE users DROP COLUMN IF EXISTS reminders_enabled;
@@ -0,0 +1,16 @@
+-- Filename: migrations/000023_create_reservation_reminder_table.up.sql
+-- Customers can turn reminders off for one reservation or for all of them
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reminders_enabled bool NOT NULL DEFAULT TRUE;
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS reminders_enabled bool NOT NULL DEFAULT TRUE;
+
+-- One row per reminder sent, so a reminder goes out once however often the
+-- scheduler runs or restarts. offset_minutes is how long before the start it
+-- was due.
+CREATE TABLE IF NOT EXISTS reservation_reminder (
+    reservation bigint NOT NULL REFERENCES reservation(id) ON DELETE CASCADE,
+    offset_minutes int NOT NULL CHECK (offset_minutes > 0),
+    sent_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (reservation, offset_minutes)
+);
+
+CREATE INDEX IF NOT EXISTS reservation_confirmed_start_idx ON reservation (start_at) WHERE status = 1;
@@ -0,0 +1,6 @@
+-- Filename: migrations/000024_add_venue_listing_filters.down.sql
+DROP INDEX IF EXISTS venue_created_at_idx;
+DROP INDEX IF EXISTS venue_capacity_idx;
+DROP INDEX IF EXISTS venue_price_idx;
+DROP INDEX IF EXISTS review_venue_idx;
+ALTER TABLE review DROP COLUMN IF EXISTS rating;
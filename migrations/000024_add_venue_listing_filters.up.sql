@@ -0,0 +1,12 @@
+-- Filename: migrations/000024_add_venue_listing_filters.up.sql
+-- Reviews can carry a star rating so venues can be sorted by it. Older
+-- reviews have none.
+ALTER TABLE review ADD COLUMN IF NOT EXISTS rating smallint
+    CONSTRAINT review_rating_range CHECK (rating BETWEEN 1 AND 5);
+
+CREATE INDEX IF NOT EXISTS review_venue_idx ON review (venue);
+
+-- Sort orders offered on the venue listing
+CREATE INDEX IF NOT EXISTS venue_price_idx ON venue (price_per_hour);
+CREATE INDEX IF NOT EXISTS venue_capacity_idx ON venue (max_capacity);
+CREATE INDEX IF NOT EXISTS venue_created_at_idx ON venue (created_at);
@@ -0,0 +1,5 @@
+-- Filename: migrations/000025_add_venue_search.down.sql
+DROP INDEX IF EXISTS venue_location_prefix_idx;
+DROP INDEX IF EXISTS venue_name_prefix_idx;
+DROP INDEX IF EXISTS venue_search_idx;
+ALTER TABLE venue DROP COLUMN IF EXISTS search;
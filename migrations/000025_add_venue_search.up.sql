@@ -0,0 +1,15 @@
+-- Filename: migrations/000025_add_venue_search.up.sql
+-- Full-text search over venues. Matches in the name rank above matches in
+-- the location, which rank above matches in the description.
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(location, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS venue_search_idx ON venue USING GIN (search);
+
+-- Prefix lookups for autocomplete
+CREATE INDEX IF NOT EXISTS venue_name_prefix_idx ON venue (lower(name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS venue_location_prefix_idx ON venue (lower(location) text_pattern_ops);
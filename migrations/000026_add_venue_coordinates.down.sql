@@ -0,0 +1,5 @@
+-- Filename: migrations/000026_add_venue_coordinates.down.sql
+DROP INDEX IF EXISTS venue_coordinates_idx;
+ALTER TABLE venue DROP CONSTRAINT IF EXISTS venue_coordinates_pair;
+ALTER TABLE venue DROP COLUMN IF EXISTS longitude;
+ALTER TABLE venue DROP COLUMN IF EXISTS latitude;
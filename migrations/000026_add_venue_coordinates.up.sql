@@ -0,0 +1,13 @@
+-- Filename: migrations/000026_add_venue_coordinates.up.sql
+-- Where each venue is, for searching by distance. Venues that haven't been
+-- placed on the map have neither.
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS latitude double precision
+    CONSTRAINT venue_latitude_range CHECK (latitude BETWEEN -90 AND 90);
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS longitude double precision
+    CONSTRAINT venue_longitude_range CHECK (longitude BETWEEN -180 AND 180);
+ALTER TABLE venue ADD CONSTRAINT venue_coordinates_pair
+    CHECK ((latitude IS NULL) = (longitude IS NULL));
+
+-- Radius and bounding-box searches narrow down by box first
+CREATE INDEX IF NOT EXISTS venue_coordinates_idx ON venue (latitude, longitude)
+    WHERE latitude IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Filename: migrations/000027_add_venue_image_uploads.down.sql
+UPDATE venue SET image_link = '' WHERE image_link IS NULL;
+ALTER TABLE venue ALTER COLUMN image_link SET NOT NULL;
+ALTER TABLE venue DROP COLUMN IF EXISTS image_key;
@@ -0,0 +1,6 @@
+-- Filename: migrations/000027_add_venue_image_uploads.up.sql
+-- Venue images are uploaded and stored by the app. image_key names the
+-- stored image; image_link keeps the external links owners used to paste,
+-- which are no longer shown.
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS image_key text NOT NULL DEFAULT '';
+ALTER TABLE venue ALTER COLUMN image_link DROP NOT NULL;
@@ -0,0 +1,8 @@
+-- Filename: migrations/000028_create_venue_images_table.down.sql
+ALTER TABLE venue ADD COLUMN IF NOT EXISTS image_key text NOT NULL DEFAULT '';
+
+UPDATE venue v SET image_key = i.image_key
+FROM venue_images i
+WHERE i.venue = v.id AND i.is_cover;
+
+DROP TABLE IF EXISTS venue_images;
@@ -0,0 +1,21 @@
+-- Filename: migrations/000028_create_venue_images_table.up.sql
+-- Each venue has a gallery of images shown in position order. One of them
+-- is the cover used on the venue listing.
+CREATE TABLE IF NOT EXISTS venue_images (
+    id bigserial PRIMARY KEY,
+    venue bigint NOT NULL REFERENCES venue(id) ON DELETE CASCADE,
+    image_key text NOT NULL UNIQUE,
+    caption text NOT NULL DEFAULT '',
+    position int NOT NULL,
+    is_cover boolean NOT NULL DEFAULT false,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS venue_images_venue_idx ON venue_images (venue, position);
+CREATE UNIQUE INDEX IF NOT EXISTS venue_images_cover_idx ON venue_images (venue) WHERE is_cover;
+
+-- The single uploaded image each venue had becomes the cover of its gallery
+INSERT INTO venue_images (venue, image_key, position, is_cover)
+SELECT id, image_key, 1, true FROM venue WHERE image_key <> '';
+
+ALTER TABLE venue DROP COLUMN IF EXISTS image_key;
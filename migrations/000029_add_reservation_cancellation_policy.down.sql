@@ -0,0 +1,3 @@
+-- Filename: migrations/000029_add_reservation_cancellation_policy.down.sql
+ALTER TABLE reservation DROP COLUMN IF EXISTS cancellation_tiers;
+ALTER TABLE reservation DROP COLUMN IF EXISTS cancellation_policy;
@@ -0,0 +1,12 @@
+-- Filename: migrations/000029_add_reservation_cancellation_policy.up.sql
+-- The cancellation policy a booking was made under, so a venue changing its
+-- policy later doesn't change the refunds on bookings it already has
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS cancellation_policy text NOT NULL DEFAULT 'flexible';
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS cancellation_tiers text NOT NULL DEFAULT '';
+
+-- Bookings made before now take the policy their venue has today, the
+-- nearest record there is of the one they were made under
+UPDATE reservation r
+SET cancellation_policy = v.cancellation_policy, cancellation_tiers = v.cancellation_tiers
+FROM venue v
+WHERE r.venue = v.id;
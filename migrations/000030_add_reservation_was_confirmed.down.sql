@@ -0,0 +1,2 @@
+-- Filename: migrations/000030_add_reservation_was_confirmed.down.sql
+ALTER TABLE reservation DROP COLUMN IF EXISTS was_confirmed;
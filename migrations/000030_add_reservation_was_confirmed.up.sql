@@ -0,0 +1,20 @@
+-- Filename: migrations/000030_add_reservation_was_confirmed.up.sql
+-- Whether the booking was ever confirmed, and so shown on the owner's
+-- calendar feed. A cancelled booking is only published to the feed, as
+-- cancelled, when it was.
+ALTER TABLE reservation ADD COLUMN IF NOT EXISTS was_confirmed boolean NOT NULL DEFAULT false;
+
+-- Confirmed, completed and no-show bookings all were. For cancelled ones
+-- this is a best guess: a fee is only charged on a confirmed booking, and an
+-- auto-accepting venue confirms every booking that wasn't a hold.
+UPDATE reservation r
+SET was_confirmed = true
+FROM venue v
+WHERE r.venue = v.id
+AND (
+    r.status IN (1, 5, 6)
+    OR (r.status = 2 AND (
+        r.cancellation_fee > 0
+        OR (v.auto_accept AND r.hold_expires_at IS NULL AND r.status_reason <> 'Hold expired')
+    ))
+);
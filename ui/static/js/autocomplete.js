@@ -0,0 +1,60 @@
+// Filename: ui/static/js/autocomplete.js
+// Description: Suggests venue names and locations as the customer types a search
+
+(function () {
+  const input = document.querySelector("input[data-suggest-url]");
+  const list = input && input.list;
+  if (!input || !list) {
+    return;
+  }
+
+  const minLength = 2;
+  const delay = 200;
+  let timer = null;
+  let controller = null;
+
+  function show(suggestions) {
+    list.replaceChildren();
+    suggestions.forEach(function (suggestion) {
+      const option = document.createElement("option");
+      option.value = suggestion.text;
+      option.label = suggestion.kind === "location" ? "Location" : "Venue";
+      list.appendChild(option);
+    });
+  }
+
+  function refresh() {
+    const prefix = input.value.trim();
+    if (controller) {
+      controller.abort();
+    }
+    if (prefix.length < minLength) {
+      show([]);
+      return;
+    }
+
+    controller = new AbortController();
+    const params = new URLSearchParams({ q: prefix });
+
+    fetch(input.dataset.suggestUrl + "?" + params.toString(), {
+      headers: { Accept: "application/json" },
+      credentials: "same-origin",
+      signal: controller.signal,
+    })
+      .then(function (response) {
+        return response.ok ? response.json() : null;
+      })
+      .then(function (data) {
+        show(data ? data.suggestions : []);
+      })
+      .catch(function () {
+        // Aborted by a newer keystroke, or the request failed; either way
+        // the search box still works without suggestions
+      });
+  }
+
+  input.addEventListener("input", function () {
+    clearTimeout(timer);
+    timer = setTimeout(refresh, delay);
+  });
+})();
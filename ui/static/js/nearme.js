@@ -0,0 +1,41 @@
+// Filename: ui/static/js/nearme.js
+// Description: Searches for venues near the customer's current location
+
+(function () {
+  const form = document.querySelector("form.filter-form");
+  const button = form && form.querySelector("button.near-me");
+  if (!button || !navigator.geolocation) {
+    return;
+  }
+
+  const near = form.elements["near"];
+  const lat = form.elements["lat"];
+  const lng = form.elements["lng"];
+
+  // Typing a place replaces the browser's location
+  near.addEventListener("input", function () {
+    lat.value = "";
+    lng.value = "";
+  });
+
+  button.hidden = false;
+  button.addEventListener("click", function () {
+    button.disabled = true;
+    navigator.geolocation.getCurrentPosition(
+      function (position) {
+        lat.value = position.coords.latitude.toFixed(5);
+        lng.value = position.coords.longitude.toFixed(5);
+        near.value = "";
+        if (!form.elements["radius"].value) {
+          form.elements["radius"].value = "10";
+        }
+        form.submit();
+      },
+      function () {
+        button.disabled = false;
+        button.textContent = "Location unavailable";
+      },
+      { timeout: 10000, maximumAge: 300000 }
+    );
+  });
+})();
@@ -0,0 +1,61 @@
+// Filename: ui/static/js/quote.js
+// Description: Fetches a price quote while the customer fills in a booking form
+
+(function () {
+  const form = document.querySelector("form[data-quote-url]");
+  const breakdown = document.getElementById("quote-breakdown");
+  if (!form || !breakdown) {
+    return;
+  }
+
+  const fields = ["start_date", "start_time", "end_date", "end_time"];
+
+  function show(name, value) {
+    const el = breakdown.querySelector("[data-quote=" + name + "]");
+    if (el) {
+      el.textContent = value;
+    }
+  }
+
+  function refresh() {
+    const params = new URLSearchParams();
+    fields.forEach(function (name) {
+      const input = form.elements[name];
+      if (input && input.value) {
+        params.set(name, input.value);
+      }
+    });
+
+    fetch(form.dataset.quoteUrl + "?" + params.toString(), {
+      headers: { Accept: "application/json" },
+      credentials: "same-origin",
+    })
+      .then(function (response) {
+        return response.ok ? response.json() : null;
+      })
+      .then(function (data) {
+        if (!data) {
+          breakdown.hidden = true;
+          return;
+        }
+        show("rate", data.quote.price_per_hour);
+        show("hours", data.hours);
+        show("subtotal", data.quote.subtotal);
+        show("tax-rate", data.tax_rate);
+        show("tax", data.quote.tax);
+        show("total", data.quote.total);
+        breakdown.hidden = false;
+      })
+      .catch(function () {
+        breakdown.hidden = true;
+      });
+  }
+
+  fields.forEach(function (name) {
+    const input = form.elements[name];
+    if (input) {
+      input.addEventListener("change", refresh);
+    }
+  });
+  refresh();
+})();
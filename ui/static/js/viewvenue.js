@@ -0,0 +1,21 @@
+// Filename: ui/static/js/viewvenue.js
+// Description: Shows the review form and confirms deleting the venue, without
+// inline scripts so the page keeps the default Content Security Policy
+
+(function () {
+  const toggle = document.querySelector(".add-review-btn");
+  const reviewForm = document.getElementById("review-form");
+  if (toggle && reviewForm) {
+    toggle.addEventListener("click", function () {
+      reviewForm.hidden = !reviewForm.hidden;
+    });
+  }
+
+  document.querySelectorAll("form[data-confirm]").forEach(function (form) {
+    form.addEventListener("submit", function (event) {
+      if (!window.confirm(form.dataset.confirm)) {
+        event.preventDefault();
+      }
+    });
+  });
+})();